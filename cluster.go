@@ -0,0 +1,314 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s-resource-autoscaler/config"
+	"k8s-resource-autoscaler/pkg/client"
+	"k8s-resource-autoscaler/pkg/kubernetes/connection"
+	"k8s-resource-autoscaler/pkg/kubernetes/controller"
+	"k8s-resource-autoscaler/pkg/kubernetes/leader"
+	"k8s-resource-autoscaler/pkg/kubernetes/metrics"
+	"k8s-resource-autoscaler/pkg/log"
+	"k8s-resource-autoscaler/pkg/plan"
+	"k8s-resource-autoscaler/pkg/reload"
+	"k8s-resource-autoscaler/pkg/telemetry"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// restartDelay is how long the pipeline of a cluster waits before it is
+// restarted after losing its lease in multi-cluster mode.
+const restartDelay = 10 * time.Second
+
+// readyGrace is added to two cycle intervals to allow for long cycles
+// before a cluster is reported as not ready.
+const readyGrace = time.Minute
+
+// errLeadershipLost is returned by serve when the lease of the cluster was lost.
+var errLeadershipLost = errors.New("leadership lost")
+
+// clusterRunner runs the discovery, resize and scale pipeline of one cluster.
+// Each cluster has its own connection, controller and leader election, so a
+// slow or unreachable cluster does not hold up the others.
+type clusterRunner struct {
+	cluster connection.Cluster
+	options controller.Options
+	// retry keeps reconnecting to an unreachable cluster and restarts the
+	// pipeline after a lost lease instead of returning an error.
+	retry bool
+	log   *log.Logger
+
+	mu        sync.Mutex
+	config    *config.AutoscalerConfig
+	clientset kubernetes.Interface
+	ctrl      *controller.Controller
+	// synced is set once the informer caches of ctrl have synced.
+	synced bool
+	// standby is set while the replica waits for the lease of the cluster.
+	standby bool
+}
+
+func newClusterRunner(cluster connection.Cluster, cfg *config.AutoscalerConfig, options controller.Options, retry bool) *clusterRunner {
+	options.Cluster = cluster.Name
+	return &clusterRunner{
+		cluster: cluster,
+		options: options,
+		retry:   retry,
+		log:     log.With("cluster", cluster.Name),
+		config:  cfg,
+	}
+}
+
+// start connects to the cluster and starts a controller for it with the
+// current configuration.
+func (r *clusterRunner) start(ctx context.Context) (*controller.Controller, error) {
+	var restConfig *rest.Config
+	var clientset *kubernetes.Clientset
+	var err error
+	if r.retry {
+		restConfig, clientset, err = connection.ConnectWithRetry(ctx, r.cluster)
+	} else {
+		restConfig, clientset, err = connection.Connect(r.cluster)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Use AutoscalerPolicies when the CRD is installed, otherwise fall back to annotations only
+	var policies client.Interface
+	if installed, err := client.Installed(clientset); err != nil {
+		r.log.Warning("Error checking for the AutoscalerPolicy CRD: %v", err)
+	} else if !installed {
+		r.log.Warning("AutoscalerPolicy CRD not installed, only annotated deployments are managed.")
+	} else {
+		policyClient, err := client.NewForConfig(restConfig)
+		if err != nil {
+			return nil, fmt.Errorf("error creating AutoscalerPolicy client: %v", err)
+		}
+		policies = policyClient
+	}
+
+	// Hold the lock until the controller is stored so no reload is missed
+	r.mu.Lock()
+	cfg := r.config.ForCluster(r.cluster.Config)
+	source, err := metrics.NewSource(clientset, cfg, r.cluster.Name)
+	if err != nil {
+		r.mu.Unlock()
+		return nil, err
+	}
+	ctrl := controller.NewController(clientset, policies, source, cfg, r.options)
+	r.clientset = clientset
+	r.ctrl = ctrl
+	r.mu.Unlock()
+
+	// Watch managed workloads and reconcile them as they change
+	if err := ctrl.Start(ctx); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	r.synced = true
+	r.mu.Unlock()
+	return ctrl, nil
+}
+
+// plan runs a single dry-run cycle and returns its plan.
+func (r *clusterRunner) plan(ctx context.Context) (*plan.Plan, error) {
+	ctrl, err := r.start(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ctrl.StartWorkers(ctx)
+	return ctrl.RunCycle(ctx)
+}
+
+// run serves the cluster until ctx is cancelled. Without retry it returns
+// the first error, including errLeadershipLost.
+func (r *clusterRunner) run(ctx context.Context) error {
+	for {
+		err := r.serve(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if !r.retry {
+			return err
+		}
+		r.log.Error("Cluster pipeline stopped, restarting in %s: %v", restartDelay, err)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(restartDelay):
+		}
+	}
+}
+
+// serve runs a new controller for the cluster, behind leader election when
+// it is enabled, until ctx is cancelled or the lease is lost.
+func (r *clusterRunner) serve(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	defer r.reset()
+
+	ctrl, err := r.start(ctx)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	clientset := r.clientset
+	leaderElection := r.config.LeaderElection
+	r.standby = leaderElection.Enabled
+	r.mu.Unlock()
+
+	if !leaderElection.Enabled {
+		ctrl.Run(ctx)
+		return nil
+	}
+
+	// Informer caches stay warm on followers so a new leader can act immediately
+	err = leader.Run(ctx, clientset, leaderElection, leader.Identity(), func(ctx context.Context) {
+		r.mu.Lock()
+		r.standby = false
+		r.mu.Unlock()
+		ctrl.Run(ctx)
+	})
+	if err != nil {
+		return err
+	}
+	if ctx.Err() == nil {
+		return errLeadershipLost
+	}
+	return nil
+}
+
+// reset forgets the controller of a stopped pipeline.
+func (r *clusterRunner) reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.clientset = nil
+	r.ctrl = nil
+	r.synced = false
+	r.standby = false
+}
+
+// ready reports whether the cluster completed a successful cycle within two
+// intervals of now. A replica waiting for the lease is ready once its caches
+// have synced, so it can take over at any time.
+func (r *clusterRunner) ready(now time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	switch {
+	case r.ctrl == nil:
+		return errors.New("not connected to the cluster")
+	case !r.synced:
+		return errors.New("informer caches not synced")
+	case r.standby:
+		return nil
+	}
+	last := r.ctrl.LastSuccessfulCycle()
+	if last.IsZero() {
+		return errors.New("no successful cycle yet")
+	}
+	maxAge := 2*time.Duration(r.config.Interval)*time.Minute + readyGrace
+	if age := now.Sub(last); age > maxAge {
+		return fmt.Errorf("last successful cycle was %s ago", age.Round(time.Second))
+	}
+	return nil
+}
+
+// readyAll returns the readiness check of the autoscaler: every cluster
+// must be ready at the time returned by now.
+func readyAll(runners []*clusterRunner, now func() time.Time) telemetry.ReadyFunc {
+	return func() error {
+		var problems []string
+		t := now()
+		for _, r := range runners {
+			if err := r.ready(t); err != nil {
+				if r.cluster.Name != "" {
+					err = fmt.Errorf("cluster %s: %v", r.cluster.Name, err)
+				}
+				problems = append(problems, err.Error())
+			}
+		}
+		if len(problems) > 0 {
+			return errors.New(strings.Join(problems, "\n"))
+		}
+		return nil
+	}
+}
+
+// prepare builds what the running controller needs for a reloaded
+// configuration and returns a function that hands it over. Nothing is
+// changed until the returned function is called.
+func (r *clusterRunner) prepare(updated *config.AutoscalerConfig) (func(), error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cfg := updated.ForCluster(r.cluster.Config)
+	var source metrics.MetricsSource
+	if r.ctrl != nil {
+		var err error
+		if source, err = metrics.NewSource(r.clientset, cfg, r.cluster.Name); err != nil {
+			return nil, err
+		}
+	}
+	return func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.config = updated
+		if r.ctrl == nil {
+			return
+		}
+		if source == nil {
+			// The controller was started after prepare
+			var err error
+			if source, err = metrics.NewSource(r.clientset, cfg, r.cluster.Name); err != nil {
+				r.log.Error("Error creating metrics source for the reloaded configuration: %v", err)
+				return
+			}
+		}
+		r.ctrl.UpdateConfig(cfg, source)
+	}, nil
+}
+
+// reloadRunners returns the function applying a reloaded configuration to
+// every cluster. The configuration is rejected as a whole when it cannot be
+// applied to one of them. Changes that need a restart are warned about once,
+// against the last applied configuration.
+func reloadRunners(runners []*clusterRunner, current *config.AutoscalerConfig) reload.ApplyFunc {
+	applied := current
+	return func(updated *config.AutoscalerConfig) error {
+		commits := make([]func(), 0, len(runners))
+		for _, r := range runners {
+			commit, err := r.prepare(updated)
+			if err != nil {
+				if r.cluster.Name != "" {
+					return fmt.Errorf("cluster %s: %v", r.cluster.Name, err)
+				}
+				return err
+			}
+			commits = append(commits, commit)
+		}
+		if !reflect.DeepEqual(updated.LeaderElection, applied.LeaderElection) {
+			log.Warning("leaderElection changes take effect after a restart.")
+		}
+		if !reflect.DeepEqual(updated.Clusters, applied.Clusters) {
+			log.Warning("clusters changes take effect after a restart.")
+		}
+		if updated.NetworkScaling.History != applied.NetworkScaling.History {
+			log.Warning("networkScaling.history changes take effect after a restart.")
+		}
+		for _, commit := range commits {
+			commit()
+		}
+		applied = updated
+		return nil
+	}
+}
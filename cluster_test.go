@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s-resource-autoscaler/config"
+	"k8s-resource-autoscaler/pkg/kubernetes/connection"
+	"k8s-resource-autoscaler/pkg/kubernetes/controller"
+	"k8s-resource-autoscaler/pkg/log"
+	"k8s-resource-autoscaler/pkg/telemetry"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// newTestRunner returns a runner of the named cluster connected to a fake
+// clientset without workloads.
+func newTestRunner(t *testing.T, name string) *clusterRunner {
+	t.Helper()
+	cfg := &config.AutoscalerConfig{Interval: 5}
+	r := newClusterRunner(connection.Cluster{Name: name}, cfg, controller.Options{}, false)
+	r.clientset = fake.NewSimpleClientset()
+	r.ctrl = controller.NewController(r.clientset, nil, nil, cfg, r.options)
+	return r
+}
+
+// readyz returns the status and body of GET /readyz for runners at now.
+func readyz(t *testing.T, runners []*clusterRunner, now time.Time) (int, string) {
+	t.Helper()
+	server := httptest.NewServer(telemetry.Handler(readyAll(runners, func() time.Time { return now }), false))
+	defer server.Close()
+	resp, err := server.Client().Get(server.URL + "/readyz")
+	if err != nil {
+		t.Fatalf("GET /readyz error = %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("error reading /readyz: %v", err)
+	}
+	return resp.StatusCode, strings.TrimSpace(string(body))
+}
+
+func TestReadyz(t *testing.T) {
+	now := time.Now()
+	r := newTestRunner(t, "")
+
+	check := func(desc string, at time.Time, wantStatus int, wantBody string) {
+		t.Helper()
+		status, body := readyz(t, []*clusterRunner{r}, at)
+		if status != wantStatus || !strings.HasPrefix(body, wantBody) {
+			t.Errorf("GET /readyz %s = %d %q, want %d %q", desc, status, body, wantStatus, wantBody)
+		}
+	}
+
+	check("before the caches synced", now, http.StatusServiceUnavailable, "informer caches not synced")
+	r.synced = true
+	check("before the first cycle", now, http.StatusServiceUnavailable, "no successful cycle yet")
+
+	r.standby = true
+	check("on standby", now, http.StatusOK, "ok")
+	r.standby = false
+
+	if _, err := r.ctrl.RunCycle(context.Background()); err != nil {
+		t.Fatalf("RunCycle() error = %v", err)
+	}
+	check("as leader after a cycle", now, http.StatusOK, "ok")
+	// Two intervals of 5 minutes and the grace minute
+	check("with a stale cycle", now.Add(12*time.Minute), http.StatusServiceUnavailable, "last successful cycle was")
+
+	r.reset()
+	check("after the pipeline stopped", now, http.StatusServiceUnavailable, "not connected to the cluster")
+}
+
+func TestReadyzNamesClusters(t *testing.T) {
+	east, west := newTestRunner(t, "east"), newTestRunner(t, "west")
+	east.synced, east.standby = true, true
+	status, body := readyz(t, []*clusterRunner{east, west}, time.Now())
+	if want := "cluster west: informer caches not synced"; status != http.StatusServiceUnavailable || body != want {
+		t.Errorf("GET /readyz = %d %q, want 503 %q", status, body, want)
+	}
+}
+
+// TestReloadWarnsOncePerRestartChange checks that a change that needs a
+// restart is warned about when it is applied, not again on later reloads.
+func TestReloadWarnsOncePerRestartChange(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "autoscaler.log")
+	level := log.GetLevel()
+	if err := log.Init(log.Options{File: path, Level: level}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { log.Init(log.Options{Level: level}) })
+	warnings := func() int {
+		t.Helper()
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return strings.Count(string(data), "leaderElection changes take effect after a restart")
+	}
+
+	current := &config.AutoscalerConfig{Interval: 5}
+	r := newClusterRunner(connection.Cluster{}, current, controller.Options{}, false)
+	apply := reloadRunners([]*clusterRunner{r}, current)
+
+	changed := &config.AutoscalerConfig{Interval: 5, LeaderElection: config.LeaderElectionConfig{Enabled: true}}
+	if err := apply(changed); err != nil {
+		t.Fatalf("apply() error = %v", err)
+	}
+	if n := warnings(); n != 1 {
+		t.Fatalf("%d warnings after the leaderElection change, want 1", n)
+	}
+
+	// A later reload keeping the change does not warn again
+	interval := &config.AutoscalerConfig{Interval: 10, LeaderElection: config.LeaderElectionConfig{Enabled: true}}
+	if err := apply(interval); err != nil {
+		t.Fatalf("apply() error = %v", err)
+	}
+	if n := warnings(); n != 1 {
+		t.Errorf("%d warnings after a reload without a leaderElection change, want still 1", n)
+	}
+}
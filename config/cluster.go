@@ -0,0 +1,11 @@
+package config
+
+// ForCluster returns a copy of the configuration with the settings of the
+// cluster applied.
+func (c *AutoscalerConfig) ForCluster(cluster ClusterConfig) *AutoscalerConfig {
+	cfg := *c
+	if cluster.PrometheusURL != "" {
+		cfg.Prometheus.URL = cluster.PrometheusURL
+	}
+	return &cfg
+}
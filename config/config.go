@@ -1,13 +1,66 @@
 package config
 
 import (
-	"io/ioutil"
+	"os"
+	"time"
+
 	"gopkg.in/yaml.v2"
 )
 
 // PrometheusConfig holds the configuration for Prometheus.
 type PrometheusConfig struct {
-	URL string `yaml:"url"`
+	URL            string `yaml:"url"`
+	DiskUsageQuery string `yaml:"disk_usage_query"`
+	// InodeUsageQuery returns the used inode percentage of a PVC.
+	InodeUsageQuery     string `yaml:"inode_usage_query"`
+	NetworkUsageQueries struct {
+		Ingress string `yaml:"ingress"`
+		Egress  string `yaml:"egress"`
+	} `yaml:"network_usage_queries"`
+	// BatchQueries fetch a metric for all objects at once, grouped by
+	// (namespace, persistentvolumeclaim) or (namespace, pod).
+	BatchQueries struct {
+		DiskUsage  string `yaml:"disk_usage"`
+		InodeUsage string `yaml:"inode_usage"`
+		// DiskUsedBytes and DiskCapacityBytes are used to forecast.
+		DiskUsedBytes     string `yaml:"disk_used_bytes"`
+		DiskCapacityBytes string `yaml:"disk_capacity_bytes"`
+		Ingress           string `yaml:"ingress"`
+		Egress            string `yaml:"egress"`
+	} `yaml:"batch_queries"`
+	// Queries holds additional named queries.
+	Queries map[string]string `yaml:"queries"`
+
+	BearerToken     string            `yaml:"bearerToken"`
+	BearerTokenFile string            `yaml:"bearerTokenFile"`
+	BasicAuth       *BasicAuthConfig  `yaml:"basicAuth"`
+	Headers         map[string]string `yaml:"headers"`
+	TLS             TLSConfig         `yaml:"tls"`
+	Timeout         time.Duration     `yaml:"timeout"`
+	Retries         int               `yaml:"retries"`
+	RetryBackoff    time.Duration     `yaml:"retryBackoff"`
+}
+
+// BasicAuthConfig holds HTTP basic auth credentials.
+type BasicAuthConfig struct {
+	Username     string `yaml:"username"`
+	Password     string `yaml:"password"`
+	PasswordFile string `yaml:"passwordFile"`
+}
+
+// TLSConfig holds the TLS settings for an HTTPS endpoint.
+type TLSConfig struct {
+	CAFile             string `yaml:"caFile"`
+	CertFile           string `yaml:"certFile"`
+	KeyFile            string `yaml:"keyFile"`
+	ServerName         string `yaml:"serverName"`
+	InsecureSkipVerify bool   `yaml:"insecureSkipVerify"`
+}
+
+// MetricsConfig selects where usage metrics are read from.
+type MetricsConfig struct {
+	// Source is prometheus (the default) or kubelet.
+	Source string `yaml:"source"`
 }
 
 // Thresholds holds the configuration for usage thresholds.
@@ -15,6 +68,14 @@ type Thresholds struct {
 	DiskUsage struct {
 		Resize int `yaml:"resize"`
 	} `yaml:"diskUsage"`
+	// InodeUsage triggers Action when the used inode percentage of a PVC
+	// exceeds Resize. Zero disables the inode check.
+	InodeUsage struct {
+		Resize int `yaml:"resize"`
+		// Action is resize or alert. Growing a volume does not add inodes
+		// on every filesystem, so alert only reports the usage.
+		Action string `yaml:"action"`
+	} `yaml:"inodeUsage"`
 	NetworkUsage struct {
 		Ingress struct {
 			Scale int `yaml:"scale"`
@@ -22,24 +83,143 @@ type Thresholds struct {
 	} `yaml:"networkUsage"`
 }
 
+// LeaderElectionConfig holds the settings for Lease-based leader election.
+type LeaderElectionConfig struct {
+	Enabled        bool          `yaml:"enabled"`
+	LeaseName      string        `yaml:"leaseName"`
+	LeaseNamespace string        `yaml:"leaseNamespace"`
+	LeaseDuration  time.Duration `yaml:"leaseDuration"`
+	RenewDeadline  time.Duration `yaml:"renewDeadline"`
+	RetryPeriod    time.Duration `yaml:"retryPeriod"`
+}
+
+// StatefulSetConfig holds the settings for StatefulSet PVC handling.
+type StatefulSetConfig struct {
+	// SyncTemplates is ignored; volumeClaimTemplates smaller than their
+	// grown PVCs are reported instead. It is still accepted so older files
+	// keep loading.
+	SyncTemplates bool `yaml:"syncTemplates"`
+}
+
+// PVCGrowthConfig holds the default settings for growing PVCs. Workloads can
+// override them with annotations or an AutoscalerPolicy.
+type PVCGrowthConfig struct {
+	// Strategy is percentage, fixed or target-utilization.
+	Strategy          string `yaml:"strategy"`
+	Percent           int    `yaml:"percent"`
+	Increment         string `yaml:"increment"`
+	TargetUtilization int    `yaml:"targetUtilization"`
+	MinStep           string `yaml:"minStep"`
+	MaxSize           string `yaml:"maxSize"`
+	RoundToGi         bool   `yaml:"roundToGi"`
+	// ResizeTimeout bounds the wait for the filesystem of a resized PVC
+	// to be expanded.
+	ResizeTimeout time.Duration `yaml:"resizeTimeout"`
+	// MinInterval is the minimum time between two resizes of a PVC, an
+	// hour when unset. MaxResizesPerDay is the most resizes of a PVC
+	// within a day. Zero means no limit for either.
+	MinInterval      time.Duration  `yaml:"minInterval"`
+	MaxResizesPerDay int            `yaml:"maxResizesPerDay"`
+	Forecast         ForecastConfig `yaml:"forecast"`
+}
+
+// ForecastConfig controls predictive PVC expansion from the fill rate.
+type ForecastConfig struct {
+	// Horizon resizes a PVC projected to be full within it. Zero disables
+	// forecasting.
+	Horizon time.Duration `yaml:"horizon"`
+	// Lookback is the range the fill rate is fitted over.
+	Lookback time.Duration `yaml:"lookback"`
+	// CoverPeriod is how long the new size must last at the projected rate.
+	CoverPeriod time.Duration `yaml:"coverPeriod"`
+}
+
+// NetworkScalingConfig controls how replica counts are computed from the
+// network rate of a workload's pods.
+type NetworkScalingConfig struct {
+	// Metric is ingress, egress or combined (ingress plus egress).
+	Metric string `yaml:"metric"`
+	// Tolerance is the relative deviation of the average rate from the
+	// target within which the replica count is left unchanged.
+	Tolerance float64              `yaml:"tolerance"`
+	ScaleUp   ScalingRulesConfig   `yaml:"scaleUp"`
+	ScaleDown ScalingRulesConfig   `yaml:"scaleDown"`
+	History   ScalingHistoryConfig `yaml:"history"`
+}
+
+// ScalingRulesConfig limits scaling in one direction.
+type ScalingRulesConfig struct {
+	// Cooldown is the minimum time since the last scale of a workload
+	// before it is scaled in this direction.
+	Cooldown time.Duration `yaml:"cooldown"`
+	// StabilizationWindow is how far back recommendations are considered.
+	StabilizationWindow time.Duration `yaml:"stabilizationWindow"`
+	// MaxPods and MaxPercent bound the change within Period; the larger
+	// change is allowed when both are set. Zero means unlimited.
+	MaxPods    int           `yaml:"maxPods"`
+	MaxPercent int           `yaml:"maxPercent"`
+	Period     time.Duration `yaml:"period"`
+}
+
+// ScalingHistoryConfig selects the ConfigMap the scaling history is
+// persisted to.
+type ScalingHistoryConfig struct {
+	Namespace string `yaml:"namespace"`
+	ConfigMap string `yaml:"configMap"`
+}
+
+// ClusterConfig selects one of the clusters managed in multi-cluster mode.
+type ClusterConfig struct {
+	// Name labels the logs, events and plans of the cluster.
+	Name       string `yaml:"name"`
+	Kubeconfig string `yaml:"kubeconfig"`
+	Context    string `yaml:"context"`
+	// PrometheusURL overrides prometheus.url for the cluster.
+	PrometheusURL string `yaml:"prometheusURL"`
+}
+
 // AutoscalerConfig holds the autoscaler settings and related configurations.
 type AutoscalerConfig struct {
-	DesiredReplicaCount int            `yaml:"desiredReplicaCount"`
-	Interval            int            `yaml:"interval"`
-	Prometheus          PrometheusConfig `yaml:"prometheus"`
-	Thresholds          Thresholds      `yaml:"thresholds"`
+	// DesiredReplicaCount is ignored; replica counts are computed from the
+	// network rate. It is still accepted so older files keep loading.
+	DesiredReplicaCount int                  `yaml:"desiredReplicaCount"`
+	Interval            int                  `yaml:"interval"`
+	Metrics             MetricsConfig        `yaml:"metrics"`
+	Prometheus          PrometheusConfig     `yaml:"prometheus"`
+	Thresholds          Thresholds           `yaml:"thresholds"`
+	LeaderElection      LeaderElectionConfig `yaml:"leaderElection"`
+	StatefulSets        StatefulSetConfig    `yaml:"statefulSets"`
+	PVCGrowth           PVCGrowthConfig      `yaml:"pvcGrowth"`
+	NetworkScaling      NetworkScalingConfig `yaml:"networkScaling"`
+	Clusters            []ClusterConfig      `yaml:"clusters"`
 }
 
-// LoadConfig reads the configuration from the specified YAML file.
+// LoadConfig reads the configuration from the specified YAML file. See Parse.
 func LoadConfig(filePath string) (*AutoscalerConfig, error) {
-	var config AutoscalerConfig
-	data, err := ioutil.ReadFile(filePath)
+	data, err := os.ReadFile(filePath)
 	if err != nil {
 		return nil, err
 	}
-	err = yaml.Unmarshal(data, &config)
-	if err != nil {
+	return Parse(data)
+}
+
+// Parse decodes a YAML configuration. Unknown keys are errors. Unset
+// settings get their defaults and the result is validated; a
+// *ValidationError lists every problem found.
+func Parse(data []byte) (*AutoscalerConfig, error) {
+	config := newConfig()
+	var problems []string
+	err := yaml.UnmarshalStrict(data, &config)
+	if typeErr, ok := err.(*yaml.TypeError); ok {
+		problems = append(problems, typeErr.Errors...)
+	} else if err != nil {
 		return nil, err
 	}
+
+	config.setDefaults()
+	problems = append(problems, config.Validate()...)
+	if len(problems) > 0 {
+		return nil, &ValidationError{Problems: problems}
+	}
 	return &config, nil
 }
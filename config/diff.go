@@ -0,0 +1,114 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// redactedKeys are the settings whose values Diff never prints.
+var redactedKeys = map[string]bool{
+	"prometheus.bearerToken":        true,
+	"prometheus.basicAuth.password": true,
+}
+
+// redactedPrefixes are the settings whose values under them Diff never
+// prints, such as request headers that commonly carry credentials.
+var redactedPrefixes = []string{
+	"prometheus.headers.",
+}
+
+// redacted reports whether the value of key is secret.
+func redacted(key string) bool {
+	if redactedKeys[key] {
+		return true
+	}
+	for _, prefix := range redactedPrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Diff returns one line per setting that differs between old and new, in
+// the form "key: old -> new", sorted by key.
+func Diff(old, new *AutoscalerConfig) []string {
+	before, after := flatten(old), flatten(new)
+
+	keys := map[string]bool{}
+	for key := range before {
+		keys[key] = true
+	}
+	for key := range after {
+		keys[key] = true
+	}
+
+	var lines []string
+	for key := range keys {
+		b, inBefore := before[key]
+		a, inAfter := after[key]
+		if inBefore && inAfter && reflect.DeepEqual(a, b) {
+			continue
+		}
+		if redacted(key) {
+			lines = append(lines, fmt.Sprintf("%s: changed", key))
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("%s: %s -> %s", key, format(b, inBefore), format(a, inAfter)))
+	}
+	sort.Strings(lines)
+	return lines
+}
+
+func format(value interface{}, ok bool) string {
+	if !ok {
+		return "<unset>"
+	}
+	return strings.TrimSpace(fmt.Sprintf("%v", value))
+}
+
+// flatten maps the dotted YAML key of every leaf setting to its value.
+func flatten(cfg *AutoscalerConfig) map[string]interface{} {
+	out := map[string]interface{}{}
+	if cfg != nil {
+		flattenInto(out, "", reflect.ValueOf(*cfg))
+	}
+	return out
+}
+
+func flattenInto(out map[string]interface{}, prefix string, v reflect.Value) {
+	join := func(key string) string {
+		if prefix == "" {
+			return key
+		}
+		return prefix + "." + key
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr:
+		if !v.IsNil() {
+			flattenInto(out, prefix, v.Elem())
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			name := strings.Split(t.Field(i).Tag.Get("yaml"), ",")[0]
+			if name == "" || name == "-" {
+				continue
+			}
+			flattenInto(out, join(name), v.Field(i))
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			flattenInto(out, join(fmt.Sprint(i)), v.Index(i))
+		}
+	case reflect.Map:
+		for _, key := range v.MapKeys() {
+			flattenInto(out, join(fmt.Sprintf("%v", key.Interface())), v.MapIndex(key))
+		}
+	default:
+		out[prefix] = v.Interface()
+	}
+}
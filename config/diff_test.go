@@ -0,0 +1,34 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDiffRedactsSecrets(t *testing.T) {
+	old := &AutoscalerConfig{Prometheus: PrometheusConfig{
+		BearerToken: "old-token",
+		Headers:     map[string]string{"X-Scope-OrgID": "old-tenant"},
+	}}
+	new := &AutoscalerConfig{Prometheus: PrometheusConfig{
+		BearerToken: "new-token",
+		Headers:     map[string]string{"X-Scope-OrgID": "new-tenant", "Authorization": "Bearer secret"},
+	}}
+
+	lines := Diff(old, new)
+	want := []string{
+		"prometheus.bearerToken: changed",
+		"prometheus.headers.Authorization: changed",
+		"prometheus.headers.X-Scope-OrgID: changed",
+	}
+	if strings.Join(lines, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("Diff() = %q, want %q", lines, want)
+	}
+	for _, line := range lines {
+		for _, secret := range []string{"old-", "new-", "secret"} {
+			if strings.Contains(line, secret) {
+				t.Errorf("Diff() line %q leaks %q", line, secret)
+			}
+		}
+	}
+}
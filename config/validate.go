@@ -0,0 +1,308 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// DefaultInterval is the cycle interval in minutes used when none is set.
+const DefaultInterval = 5
+
+// DefaultTolerance is the network scaling tolerance used when none is set.
+const DefaultTolerance = 0.1
+
+// Valid values of the enumerated settings.
+var (
+	metricsSources   = []string{"prometheus", "kubelet"}
+	growthStrategies = []string{"percentage", "fixed", "target-utilization"}
+)
+
+// ValidationError lists every problem found in a configuration.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid configuration:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+// newConfig returns the configuration a file is parsed into. The settings
+// for which zero is a valid value, or not a valid value at all, are preset,
+// so that an omitted key keeps the default and an explicit 0 is kept (and
+// rejected by Validate where it is not allowed).
+func newConfig() AutoscalerConfig {
+	var c AutoscalerConfig
+	c.Interval = DefaultInterval
+	c.NetworkScaling.Tolerance = DefaultTolerance
+	c.NetworkScaling.ScaleUp.Period = time.Minute
+	c.NetworkScaling.ScaleDown.Period = time.Minute
+	// Scaling down waits like the HorizontalPodAutoscaler, whose scale-down
+	// stabilization window defaults to 300 seconds
+	c.NetworkScaling.ScaleDown.StabilizationWindow = 5 * time.Minute
+	c.NetworkScaling.ScaleDown.Cooldown = 5 * time.Minute
+	// A stale usage metric must not grow a PVC again right after a resize
+	c.PVCGrowth.MinInterval = time.Hour
+	return c
+}
+
+// setDefaults fills in the settings left unset in the file whose zero value
+// is not meaningful. The others are preset by newConfig.
+func (c *AutoscalerConfig) setDefaults() {
+	if c.Metrics.Source == "" {
+		c.Metrics.Source = "prometheus"
+	}
+	if c.PVCGrowth.Strategy == "" {
+		c.PVCGrowth.Strategy = "percentage"
+	}
+	if c.Thresholds.InodeUsage.Action == "" {
+		c.Thresholds.InodeUsage.Action = "alert"
+	}
+	if c.PVCGrowth.Forecast.Lookback == 0 {
+		c.PVCGrowth.Forecast.Lookback = 6 * time.Hour
+	}
+	if c.PVCGrowth.Forecast.CoverPeriod == 0 {
+		c.PVCGrowth.Forecast.CoverPeriod = 24 * time.Hour
+	}
+	if c.NetworkScaling.Metric == "" {
+		c.NetworkScaling.Metric = "ingress"
+	}
+	if c.NetworkScaling.History.ConfigMap == "" {
+		c.NetworkScaling.History.ConfigMap = "k8s-resource-autoscaler-scaling-history"
+	}
+	if c.NetworkScaling.History.Namespace == "" {
+		c.NetworkScaling.History.Namespace = c.LeaderElection.LeaseNamespace
+	}
+	if c.NetworkScaling.History.Namespace == "" {
+		c.NetworkScaling.History.Namespace = "default"
+	}
+}
+
+// Validate checks the configuration for semantic errors and returns every
+// problem found.
+func (c *AutoscalerConfig) Validate() []string {
+	var problems []string
+	add := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if c.Interval <= 0 {
+		add("interval: %d must be a positive number of minutes", c.Interval)
+	}
+	if r := c.Thresholds.DiskUsage.Resize; r < 1 || r > 100 {
+		add("thresholds.diskUsage.resize: %d must be a percentage between 1 and 100", r)
+	}
+	if r := c.Thresholds.InodeUsage.Resize; r < 0 || r > 100 {
+		add("thresholds.inodeUsage.resize: %d must be a percentage between 1 and 100, or 0 to disable", r)
+	}
+	if a := c.Thresholds.InodeUsage.Action; a != "resize" && a != "alert" {
+		add("thresholds.inodeUsage.action: %q must be resize or alert", a)
+	}
+	switch c.NetworkScaling.Metric {
+	case "ingress", "egress", "combined":
+	default:
+		add("networkScaling.metric: %q must be ingress, egress or combined", c.NetworkScaling.Metric)
+	}
+	if t := c.NetworkScaling.Tolerance; t < 0 || t >= 1 {
+		add("networkScaling.tolerance: %v must be at least 0 and below 1", t)
+	}
+	c.NetworkScaling.ScaleUp.validate("networkScaling.scaleUp", 0, add)
+	c.NetworkScaling.ScaleDown.validate("networkScaling.scaleDown", 100, add)
+	if s := c.Thresholds.NetworkUsage.Ingress.Scale; s <= 0 {
+		add("thresholds.networkUsage.ingress.scale: %d must be a positive rate in bytes per second", s)
+	}
+
+	if !contains(metricsSources, c.Metrics.Source) {
+		add("metrics.source: %q must be one of %s", c.Metrics.Source, strings.Join(metricsSources, ", "))
+	}
+	if c.Metrics.Source == "prometheus" {
+		// prometheus.url is only a default when every cluster sets its own
+		requireURL := len(c.Clusters) == 0
+		for _, cluster := range c.Clusters {
+			if cluster.PrometheusURL == "" {
+				requireURL = true
+			}
+		}
+		problems = append(problems, c.Prometheus.validate(requireURL)...)
+	}
+	problems = append(problems, validateClusters(c.Clusters)...)
+
+	problems = append(problems, c.PVCGrowth.validate()...)
+	if c.PVCGrowth.Forecast.Horizon > 0 && c.Metrics.Source != "prometheus" {
+		add("pvcGrowth.forecast.horizon: forecasting needs metrics.source prometheus")
+	}
+
+	if le := c.LeaderElection; le.Enabled {
+		if le.LeaseDuration < 0 || le.RenewDeadline < 0 || le.RetryPeriod < 0 {
+			add("leaderElection: durations must not be negative")
+		}
+		if le.LeaseDuration > 0 && le.RenewDeadline > 0 && le.LeaseDuration <= le.RenewDeadline {
+			add("leaderElection.leaseDuration: %s must be greater than renewDeadline %s", le.LeaseDuration, le.RenewDeadline)
+		}
+		if le.RenewDeadline > 0 && le.RetryPeriod > 0 && le.RenewDeadline <= le.RetryPeriod {
+			add("leaderElection.renewDeadline: %s must be greater than retryPeriod %s", le.RenewDeadline, le.RetryPeriod)
+		}
+	}
+
+	return problems
+}
+
+func (p PrometheusConfig) validate(requireURL bool) []string {
+	var problems []string
+	add := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if p.URL == "" {
+		if requireURL {
+			add("prometheus.url: must be set when metrics.source is prometheus")
+		}
+	} else if !isHTTPURL(p.URL) {
+		add("prometheus.url: %q must be an http or https URL", p.URL)
+	}
+	if p.DiskUsageQuery == "" {
+		add("prometheus.disk_usage_query: must be set")
+	}
+	if p.NetworkUsageQueries.Ingress == "" {
+		add("prometheus.network_usage_queries.ingress: must be set")
+	}
+	if p.Timeout < 0 {
+		add("prometheus.timeout: %s must not be negative", p.Timeout)
+	}
+	if p.Retries < 0 {
+		add("prometheus.retries: %d must not be negative", p.Retries)
+	}
+	if p.RetryBackoff < 0 {
+		add("prometheus.retryBackoff: %s must not be negative", p.RetryBackoff)
+	}
+	if (p.BearerToken != "" || p.BearerTokenFile != "") && p.BasicAuth != nil {
+		add("prometheus: bearer token and basicAuth are mutually exclusive")
+	}
+	if p.BasicAuth != nil && p.BasicAuth.Username == "" {
+		add("prometheus.basicAuth.username: must be set")
+	}
+	if (p.TLS.CertFile == "") != (p.TLS.KeyFile == "") {
+		add("prometheus.tls: certFile and keyFile must be set together")
+	}
+	return problems
+}
+
+func (g PVCGrowthConfig) validate() []string {
+	var problems []string
+	add := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if !contains(growthStrategies, g.Strategy) {
+		add("pvcGrowth.strategy: %q must be one of %s", g.Strategy, strings.Join(growthStrategies, ", "))
+	}
+	if g.Percent < 0 {
+		add("pvcGrowth.percent: %d must not be negative", g.Percent)
+	}
+	if g.TargetUtilization < 0 || g.TargetUtilization > 99 {
+		add("pvcGrowth.targetUtilization: %d must be a percentage between 1 and 99", g.TargetUtilization)
+	}
+	quantities := []struct {
+		name  string
+		value string
+	}{
+		{"increment", g.Increment},
+		{"minStep", g.MinStep},
+		{"maxSize", g.MaxSize},
+	}
+	for _, q := range quantities {
+		if q.value == "" {
+			continue
+		}
+		if parsed, err := resource.ParseQuantity(q.value); err != nil || parsed.Sign() <= 0 {
+			add("pvcGrowth.%s: %q must be a positive quantity such as 10Gi", q.name, q.value)
+		}
+	}
+	if g.Strategy == "fixed" && g.Increment == "" {
+		add("pvcGrowth.increment: must be set when strategy is fixed")
+	}
+	if g.ResizeTimeout < 0 {
+		add("pvcGrowth.resizeTimeout: %s must not be negative", g.ResizeTimeout)
+	}
+	if g.MinInterval < 0 {
+		add("pvcGrowth.minInterval: %s must not be negative", g.MinInterval)
+	}
+	if g.MaxResizesPerDay < 0 {
+		add("pvcGrowth.maxResizesPerDay: %d must not be negative", g.MaxResizesPerDay)
+	}
+	forecast := []struct {
+		name  string
+		value time.Duration
+	}{
+		{"horizon", g.Forecast.Horizon},
+		{"lookback", g.Forecast.Lookback},
+		{"coverPeriod", g.Forecast.CoverPeriod},
+	}
+	for _, d := range forecast {
+		if d.value < 0 {
+			add("pvcGrowth.forecast.%s: %s must not be negative", d.name, d.value)
+		}
+	}
+	return problems
+}
+
+func validateClusters(clusters []ClusterConfig) []string {
+	var problems []string
+	add := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	seen := map[string]bool{}
+	for i, cluster := range clusters {
+		switch {
+		case cluster.Name == "":
+			add("clusters[%d].name: must be set", i)
+		case seen[cluster.Name]:
+			add("clusters[%d].name: %q is used by another cluster", i, cluster.Name)
+		}
+		seen[cluster.Name] = true
+		if cluster.PrometheusURL != "" && !isHTTPURL(cluster.PrometheusURL) {
+			add("clusters[%d].prometheusURL: %q must be an http or https URL", i, cluster.PrometheusURL)
+		}
+	}
+	return problems
+}
+
+func isHTTPURL(raw string) bool {
+	u, err := url.Parse(raw)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// validate checks the rules of one scaling direction. maxPercent bounds
+// MaxPercent when positive.
+func (r ScalingRulesConfig) validate(path string, maxPercent int, add func(string, ...interface{})) {
+	if r.Cooldown < 0 {
+		add("%s.cooldown: %s must not be negative", path, r.Cooldown)
+	}
+	if r.StabilizationWindow < 0 {
+		add("%s.stabilizationWindow: %s must not be negative", path, r.StabilizationWindow)
+	}
+	if r.MaxPods < 0 {
+		add("%s.maxPods: %d must not be negative", path, r.MaxPods)
+	}
+	if r.MaxPercent < 0 {
+		add("%s.maxPercent: %d must not be negative", path, r.MaxPercent)
+	} else if maxPercent > 0 && r.MaxPercent > maxPercent {
+		add("%s.maxPercent: %d must not exceed %d", path, r.MaxPercent, maxPercent)
+	}
+	if r.Period < 0 {
+		add("%s.period: %s must not be negative", path, r.Period)
+	}
+}
@@ -0,0 +1,136 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// minimalConfig is the smallest configuration Parse accepts.
+const minimalConfig = `
+thresholds:
+  diskUsage:
+    resize: 80
+  networkUsage:
+    ingress:
+      scale: 100
+prometheus:
+  url: http://prometheus:9090
+  disk_usage_query: disk
+  network_usage_queries:
+    ingress: ingress
+`
+
+func TestParseDefaults(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{name: "omitted blocks", data: minimalConfig},
+		// Setting some keys of a block keeps the defaults of the others
+		{name: "partial block", data: minimalConfig + "networkScaling:\n  metric: egress\n  scaleDown:\n    maxPods: 2\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := Parse([]byte(tt.data))
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			checkDefaults(t, cfg)
+		})
+	}
+}
+
+func checkDefaults(t *testing.T, cfg *AutoscalerConfig) {
+	t.Helper()
+	durations := []struct {
+		name string
+		got  time.Duration
+		want time.Duration
+	}{
+		{"networkScaling.scaleUp.cooldown", cfg.NetworkScaling.ScaleUp.Cooldown, 0},
+		{"networkScaling.scaleUp.stabilizationWindow", cfg.NetworkScaling.ScaleUp.StabilizationWindow, 0},
+		{"networkScaling.scaleDown.cooldown", cfg.NetworkScaling.ScaleDown.Cooldown, 5 * time.Minute},
+		{"networkScaling.scaleDown.stabilizationWindow", cfg.NetworkScaling.ScaleDown.StabilizationWindow, 5 * time.Minute},
+		{"networkScaling.scaleUp.period", cfg.NetworkScaling.ScaleUp.Period, time.Minute},
+		{"networkScaling.scaleDown.period", cfg.NetworkScaling.ScaleDown.Period, time.Minute},
+		{"pvcGrowth.minInterval", cfg.PVCGrowth.MinInterval, time.Hour},
+	}
+	for _, d := range durations {
+		if d.got != d.want {
+			t.Errorf("%s = %s, want %s", d.name, d.got, d.want)
+		}
+	}
+	if cfg.NetworkScaling.Tolerance != DefaultTolerance {
+		t.Errorf("networkScaling.tolerance = %v, want %v", cfg.NetworkScaling.Tolerance, DefaultTolerance)
+	}
+}
+
+func TestParseExplicitZero(t *testing.T) {
+	cfg, err := Parse([]byte(minimalConfig + `
+networkScaling:
+  tolerance: 0
+  scaleUp:
+    period: 0s
+  scaleDown:
+    cooldown: 0s
+    stabilizationWindow: 0s
+    period: 0s
+pvcGrowth:
+  minInterval: 0s
+`))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	durations := []struct {
+		name string
+		got  time.Duration
+	}{
+		{"networkScaling.scaleUp.period", cfg.NetworkScaling.ScaleUp.Period},
+		{"networkScaling.scaleDown.cooldown", cfg.NetworkScaling.ScaleDown.Cooldown},
+		{"networkScaling.scaleDown.stabilizationWindow", cfg.NetworkScaling.ScaleDown.StabilizationWindow},
+		{"networkScaling.scaleDown.period", cfg.NetworkScaling.ScaleDown.Period},
+		{"pvcGrowth.minInterval", cfg.PVCGrowth.MinInterval},
+	}
+	for _, d := range durations {
+		if d.got != 0 {
+			t.Errorf("%s = %s, want the explicit 0s", d.name, d.got)
+		}
+	}
+	if cfg.NetworkScaling.Tolerance != 0 {
+		t.Errorf("networkScaling.tolerance = %v, want the explicit 0", cfg.NetworkScaling.Tolerance)
+	}
+}
+
+func TestValidateIngressScale(t *testing.T) {
+	for _, scale := range []int{0, -1} {
+		cfg, err := Parse([]byte(minimalConfig))
+		if err != nil {
+			t.Fatalf("Parse() error = %v", err)
+		}
+		cfg.Thresholds.NetworkUsage.Ingress.Scale = scale
+		problems := cfg.Validate()
+		if len(problems) != 1 || !strings.HasPrefix(problems[0], "thresholds.networkUsage.ingress.scale:") {
+			t.Errorf("Validate() with ingress scale %d = %q, want one ingress scale problem", scale, problems)
+		}
+	}
+}
+
+func TestParseInterval(t *testing.T) {
+	cfg, err := Parse([]byte(minimalConfig))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if cfg.Interval != DefaultInterval {
+		t.Errorf("interval = %d without the key, want %d", cfg.Interval, DefaultInterval)
+	}
+
+	for _, interval := range []string{"0", "-1"} {
+		_, err := Parse([]byte(minimalConfig + "interval: " + interval + "\n"))
+		verr, ok := err.(*ValidationError)
+		if !ok || len(verr.Problems) != 1 || !strings.HasPrefix(verr.Problems[0], "interval:") {
+			t.Errorf("Parse() with interval %s error = %v, want one interval problem", interval, err)
+		}
+	}
+}
@@ -1,28 +1,86 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"os"
+	"os/signal"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"k8s-resource-autoscaler/config"
-	"k8s-resource-autoscaler/pkg/kubernetes/annotations"
 	"k8s-resource-autoscaler/pkg/kubernetes/connection"
-	"k8s-resource-autoscaler/pkg/kubernetes/deployment"
-	"k8s-resource-autoscaler/pkg/kubernetes/metrics"
-	"k8s-resource-autoscaler/pkg/kubernetes/pvc"
+	"k8s-resource-autoscaler/pkg/kubernetes/controller"
 	"k8s-resource-autoscaler/pkg/log"
+	"k8s-resource-autoscaler/pkg/reload"
+	"k8s-resource-autoscaler/pkg/telemetry"
+	"k8s.io/client-go/kubernetes"
 )
 
 func main() {
 	// Define a command-line flag for selecting the mode (pvc, ingress, or both)
 	mode := flag.String("mode", "", "Mode of operation: 'pvc' for PVC resizing, 'ingress' for ingress scaling, 'pvc,ingress' for both")
+	dryRun := flag.Bool("dry-run", false, "Report the planned resizes and scales of every cycle without applying them")
+	output := flag.String("output", "table", "Output format of the dry-run plan: 'table' or 'json'")
+	configPath := flag.String("config", "config.yaml", "Path to the configuration file")
+	configMap := flag.String("config-configmap", "", "Read and watch the configuration from a ConfigMap ('namespace/name') instead of --config")
+	configKey := flag.String("config-key", "config.yaml", "Key of the configuration in the --config-configmap ConfigMap")
+	kubeconfig := flag.String("kubeconfig", "", "Path to a kubeconfig file. Defaults to the in-cluster service account, then $KUBECONFIG or ~/.kube/config")
+	kubeContext := flag.String("context", "", "Kubeconfig context to use instead of the current context")
+	qps := flag.Float64("kube-api-qps", connection.DefaultQPS, "Maximum queries per second to the Kubernetes API server")
+	burst := flag.Int("kube-api-burst", connection.DefaultBurst, "Maximum burst of queries to the Kubernetes API server")
+	workers := flag.Int("workers", 1, "Number of workloads reconciled concurrently in each cluster")
+	metricsAddr := flag.String("metrics-addr", ":8080", "Address serving /metrics, /healthz, /readyz and /loglevel. Empty disables the server")
+	logLevel := flag.String("log-level", "info", "Minimum log level: 'debug', 'info', 'warning' or 'error'. Can be changed at runtime through /loglevel with --allow-log-level-change")
+	allowLogLevelChange := flag.Bool("allow-log-level-change", false, "Allow PUT /loglevel on --metrics-addr to change the log level. The server is unauthenticated, so only enable this when the address is not reachable by untrusted clients")
+	logFormat := flag.String("log-format", log.FormatConsole, "Log format: 'console' or 'json'")
+	logFile := flag.String("log-file", "", "Also write the log to this file, rotating it by size. Empty disables the file")
+	logFileMaxSize := flag.Int("log-file-max-size", log.DefaultMaxSizeMB, "Size in MB at which the log file is rotated")
+	logFileMaxBackups := flag.Int("log-file-max-backups", log.DefaultMaxBackups, "Number of rotated log files to keep")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [plan|validate-config]\n\n", os.Args[0])
+		fmt.Fprintln(flag.CommandLine.Output(), "Commands:")
+		fmt.Fprintln(flag.CommandLine.Output(), "  plan               run a single dry-run cycle, print the plan and exit")
+		fmt.Fprintln(flag.CommandLine.Output(), "  validate-config    check the configuration file, print every problem and exit")
+		fmt.Fprintln(flag.CommandLine.Output(), "\nFlags:")
+		flag.PrintDefaults()
+	}
 	flag.Parse()
 
+	// Allow flags after the subcommand, e.g. "plan --mode=pvc"
+	command := flag.Arg(0)
+	if command != "" {
+		flag.CommandLine.Parse(flag.Args()[1:])
+	}
+	if command != "" && command != "plan" && command != "validate-config" {
+		fmt.Printf("Error: unknown command %q\n", command)
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	if command == "validate-config" {
+		os.Exit(validateConfig(*configPath))
+	}
+
 	// Initialize the logger
-	log.Init()
+	level, err := log.ParseLevel(*logLevel)
+	if err == nil {
+		err = log.Init(log.Options{
+			Level:      level,
+			Format:     *logFormat,
+			File:       *logFile,
+			MaxSizeMB:  *logFileMaxSize,
+			MaxBackups: *logFileMaxBackups,
+		})
+	}
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		flag.Usage()
+		os.Exit(1)
+	}
 	log.Info("Starting Kubernetes Resource Autoscaler...")
 
 	// Ensure a valid mode is provided
@@ -31,124 +89,159 @@ func main() {
 		flag.Usage()
 		os.Exit(1)
 	}
+	if *workers < 1 {
+		fmt.Println("Error: --workers must be at least 1")
+		flag.Usage()
+		os.Exit(1)
+	}
+	if *output != "table" && *output != "json" {
+		fmt.Println("Error: You must specify a valid output format ('table' or 'json')")
+		flag.Usage()
+		os.Exit(1)
+	}
 
 	// Load the configuration from the YAML file
-	configPath := "config.yaml"
-	config, err := config.LoadConfig(configPath)
-	if err != nil {
-		log.Error("Error loading config: %v", err)
-		os.Exit(1)
+	var cfg *config.AutoscalerConfig
+	if *configMap == "" {
+		cfg, err = config.LoadConfig(*configPath)
+		if err != nil {
+			log.Error("Error loading config: %v", err)
+			os.Exit(1)
+		}
 	}
 
-	// Connect to the Kubernetes cluster
-	clientset := connection.ConnectToCluster()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	// Continuous monitoring loop
-	for {
-		log.Info("Starting new monitoring cycle...")
+	defaults := connection.Options{
+		Kubeconfig: *kubeconfig,
+		Context:    *kubeContext,
+		QPS:        float32(*qps),
+		Burst:      *burst,
+	}
 
-		// Check for deployments with the specified annotation
-		results, annotationFound, err := annotations.IsAnnotation(clientset)
+	// The configuration ConfigMap lives in the cluster selected by the flags
+	var configMapNamespace, configMapName string
+	var configMapClientset kubernetes.Interface
+	if *configMap != "" {
+		configMapNamespace, configMapName, err = reload.ParseConfigMapRef(*configMap)
+		if err == nil {
+			_, configMapClientset, err = connection.Connect(connection.Cluster{Options: defaults})
+		}
+		if err == nil {
+			cfg, err = reload.LoadConfigMap(ctx, configMapClientset, configMapNamespace, configMapName, *configKey)
+		}
 		if err != nil {
-			log.Error("Error checking annotations: %v", err)
-			return
+			log.Error("Error loading config: %v", err)
+			os.Exit(1)
 		}
+	}
+
+	// Determine which modes to run
+	options := controller.Options{
+		PVC:        strings.Contains(*mode, "pvc"),
+		Ingress:    strings.Contains(*mode, "ingress"),
+		Workers:    *workers,
+		DryRun:     *dryRun || command == "plan",
+		PlanOutput: *output,
+	}
+
+	// Every cluster runs its own pipeline. In multi-cluster mode an
+	// unreachable cluster is retried in the background instead of failing
+	// the whole autoscaler.
+	multiCluster := len(cfg.Clusters) > 0
+	var runners []*clusterRunner
+	for _, cluster := range connection.Clusters(cfg.Clusters, defaults) {
+		runners = append(runners, newClusterRunner(cluster, cfg, options, multiCluster && command != "plan"))
+	}
+	if multiCluster {
+		log.Info("Managing %d clusters.", len(runners))
+	}
 
-		// Log results of annotation checks
-		if annotationFound {
-			log.Info("Found %d deployments with annotations.", len(results))
-			for _, result := range results {
-				log.Info("Deployment: %s, Namespace: %s, PVCs: %v", result.Deployment, result.Namespace, result.PVCNames)
+	if command == "plan" {
+		// One-shot plan: reconcile every workload once, print the plan and exit
+		failed := runAll(runners, func(r *clusterRunner) error {
+			p, err := r.plan(ctx)
+			if err != nil {
+				return fmt.Errorf("error running plan cycle: %v", err)
+			}
+			if err := p.Write(os.Stdout, *output); err != nil {
+				return fmt.Errorf("error writing plan: %v", err)
 			}
-		} else {
-			log.Error("No deployments with the specified annotation found.")
-			return
+			return nil
+		})
+		if failed {
+			os.Exit(1)
 		}
+		return
+	}
+
+	// Swap in valid configuration changes between cycles
+	apply := reloadRunners(runners, cfg)
+	if *configMap != "" {
+		go reload.WatchConfigMap(ctx, configMapClientset, configMapNamespace, configMapName, *configKey, cfg, apply)
+	} else {
+		go reload.WatchFile(ctx, *configPath, cfg, apply)
+	}
 
-		// Determine which modes to run
-		runPVC := strings.Contains(*mode, "pvc")
-		runIngress := strings.Contains(*mode, "ingress")
-
-		if runPVC {
-			log.Info("Running in PVC resizing mode...")
-			for _, result := range results {
-				log.Info("Checking PVCs for deployment %s in namespace %s", result.Deployment, result.Namespace)
-
-				for _, pvcName := range result.PVCNames {
-					// Fetch disk usage percentage using PVC name and namespace
-					diskUsagePercentage, err := metrics.FetchDiskUsage(config.Prometheus.URL, pvcName, result.Namespace)
-					if err != nil {
-						log.Error("Error fetching disk usage for PVC %s in namespace %s: %v", pvcName, result.Namespace, err)
-						continue
-					}
-
-					log.Info("Disk usage for PVC %s in namespace %s: %.2f%%", pvcName, result.Namespace, diskUsagePercentage)
-
-					// Check if disk usage exceeds threshold (convert to int for comparison)
-					if int(diskUsagePercentage) > config.Thresholds.DiskUsage.Resize {
-						err = pvc.ResizePVC(clientset, pvcName, result.Namespace)
-						if err != nil {
-							log.Error("Error resizing PVC %s in namespace %s: %v", pvcName, result.Namespace, err)
-							continue
-						}
-						log.Info("Resized PVC %s in namespace %s successfully.", pvcName, result.Namespace)
-
-						err = deployment.WaitForPVCReady(clientset, pvcName, result.Namespace)
-						if err != nil {
-							log.Error("Error waiting for PVC %s to be ready: %v", pvcName, result.Namespace, err)
-							continue
-						}
-						log.Info("PVC %s is ready.", pvcName)
-					} else {
-						log.Info("Disk usage for PVC %s is below threshold, no resizing needed.", pvcName)
-					}
-				}
+	if *metricsAddr != "" {
+		go func() {
+			if err := telemetry.Serve(ctx, *metricsAddr, readyAll(runners, time.Now), *allowLogLevelChange); err != nil {
+				log.Error("%v", err)
 			}
+		}()
+	}
+
+	failed := runAll(runners, func(r *clusterRunner) error {
+		err := r.run(ctx)
+		if err == errLeadershipLost {
+			log.Fatal("Leadership lost, exiting so a fresh replica can take over.")
 		}
+		return err
+	})
+	if failed {
+		os.Exit(1)
+	}
+	log.Info("Shutting down Kubernetes Resource Autoscaler.")
+}
+
+// runAll calls fn for every runner concurrently, logs the errors and
+// reports whether any of them failed.
+func runAll(runners []*clusterRunner, fn func(r *clusterRunner) error) bool {
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	failed := false
+	for _, r := range runners {
+		wg.Add(1)
+		go func(r *clusterRunner) {
+			defer wg.Done()
+			if err := fn(r); err != nil {
+				r.log.Error("%v", err)
+				mu.Lock()
+				failed = true
+				mu.Unlock()
+			}
+		}(r)
+	}
+	wg.Wait()
+	return failed
+}
 
-			if runIngress {
-    			log.Info("Running in ingress scaling mode...")
-    			for _, result := range results {
-    				log.Info("Checking network usage for deployment %s in namespace %s", result.Deployment, result.Namespace)
-
-    				// Get the list of pods for the deployment
-    				pods, err := deployment.GetPodsForDeployment(clientset, result.Deployment, result.Namespace)
-    				if err != nil {
-    					log.Error("Error fetching pods for deployment %s in namespace %s: %v", result.Deployment, result.Namespace, err)
-    					continue
-    				}
-
-    				// Iterate over each pod to fetch ingress and egress bandwidth
-    				for _, pod := range pods {
-    					log.Info("Checking network usage for pod %s in namespace %s", pod.Name, result.Namespace)
-
-    					// Fetch ingress and egress bandwidth from Prometheus for the pod
-    					ingressBandwidth, egressBandwidth, err := metrics.FetchNetworkUsage(config.Prometheus.URL, pod.Name, result.Namespace)
-    					if err != nil {
-    						log.Error("Error fetching network usage for pod %s in namespace %s: %v", pod.Name, result.Namespace, err)
-    						continue
-    					}
-
-    					log.Info("\n Ingress Bandwidth: %.2f bytes/sec, Egress Bandwidth: %.2f bytes/sec for pod %s in namespace %s",
-    						ingressBandwidth, egressBandwidth, pod.Name, result.Namespace)
-
-    					// Check if ingress exceeds threshold (convert to int for comparison)
-    					if int(ingressBandwidth) > config.Thresholds.NetworkUsage.Ingress.Scale {
-    						log.Info("Ingress bandwidth for pod %s exceeds threshold. Scaling deployment %s in namespace %s to %d replicas...",
-    							pod.Name, result.Deployment, result.Namespace, config.DesiredReplicaCount)
-
-    						// Scale the deployment based on the network usage
-    						err = deployment.ScalePod(clientset, result.Deployment, result.Namespace, int32(config.DesiredReplicaCount))
-    						if err != nil {
-    							log.Error("Error scaling deployment %s in namespace %s: %v", result.Deployment, result.Namespace, err)
-    							continue
-    						}
-    					}
-    				}
-    			}
-    		}
-		// Wait for the specified interval before running the next cycle
-		log.Info("Monitoring cycle complete. Waiting for %d minutes before the next cycle.", config.Interval)
-		time.Sleep(time.Duration(config.Interval) * time.Minute)
+// validateConfig loads the configuration file, prints every problem found
+// and returns the exit code.
+func validateConfig(path string) int {
+	_, err := config.LoadConfig(path)
+	if validationErr, ok := err.(*config.ValidationError); ok {
+		fmt.Printf("%s has %d problem(s):\n", path, len(validationErr.Problems))
+		for _, problem := range validationErr.Problems {
+			fmt.Printf("  - %s\n", problem)
+		}
+		return 1
+	}
+	if err != nil {
+		fmt.Printf("Error loading %s: %v\n", path, err)
+		return 1
 	}
+	fmt.Printf("%s is valid.\n", path)
+	return 0
 }
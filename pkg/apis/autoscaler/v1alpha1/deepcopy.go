@@ -0,0 +1,173 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// DeepCopyInto copies the receiver into out.
+func (in *AutoscalerPolicy) DeepCopyInto(out *AutoscalerPolicy) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy returns a deep copy of the policy.
+func (in *AutoscalerPolicy) DeepCopy() *AutoscalerPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(AutoscalerPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject implements runtime.Object.
+func (in *AutoscalerPolicy) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto copies the receiver into out.
+func (in *AutoscalerPolicyList) DeepCopyInto(out *AutoscalerPolicyList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		out.Items = make([]AutoscalerPolicy, len(in.Items))
+		for i := range in.Items {
+			in.Items[i].DeepCopyInto(&out.Items[i])
+		}
+	}
+}
+
+// DeepCopy returns a deep copy of the list.
+func (in *AutoscalerPolicyList) DeepCopy() *AutoscalerPolicyList {
+	if in == nil {
+		return nil
+	}
+	out := new(AutoscalerPolicyList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject implements runtime.Object.
+func (in *AutoscalerPolicyList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto copies the receiver into out.
+func (in *AutoscalerPolicySpec) DeepCopyInto(out *AutoscalerPolicySpec) {
+	*out = *in
+	out.TargetRef = in.TargetRef
+	if in.PVC != nil {
+		out.PVC = new(PVCRules)
+		in.PVC.DeepCopyInto(out.PVC)
+	}
+	if in.Network != nil {
+		out.Network = new(NetworkRules)
+		in.Network.DeepCopyInto(out.Network)
+	}
+	in.Limits.DeepCopyInto(&out.Limits)
+}
+
+// DeepCopyInto copies the receiver into out.
+func (in *PVCRules) DeepCopyInto(out *PVCRules) {
+	*out = *in
+	if in.Increment != nil {
+		q := in.Increment.DeepCopy()
+		out.Increment = &q
+	}
+	if in.MinStep != nil {
+		q := in.MinStep.DeepCopy()
+		out.MinStep = &q
+	}
+	if in.MaxSize != nil {
+		q := in.MaxSize.DeepCopy()
+		out.MaxSize = &q
+	}
+	if in.MinResizeInterval != nil {
+		v := *in.MinResizeInterval
+		out.MinResizeInterval = &v
+	}
+	if in.ForecastHorizon != nil {
+		v := *in.ForecastHorizon
+		out.ForecastHorizon = &v
+	}
+}
+
+// DeepCopyInto copies the receiver into out.
+func (in *NetworkRules) DeepCopyInto(out *NetworkRules) {
+	*out = *in
+	if in.IngressThreshold != nil {
+		v := *in.IngressThreshold
+		out.IngressThreshold = &v
+	}
+}
+
+// DeepCopyInto copies the receiver into out.
+func (in *Limits) DeepCopyInto(out *Limits) {
+	*out = *in
+	if in.MinReplicas != nil {
+		v := *in.MinReplicas
+		out.MinReplicas = &v
+	}
+	if in.MaxReplicas != nil {
+		v := *in.MaxReplicas
+		out.MaxReplicas = &v
+	}
+	if in.Cooldown != nil {
+		v := *in.Cooldown
+		out.Cooldown = &v
+	}
+	if in.ScaleUpCooldown != nil {
+		v := *in.ScaleUpCooldown
+		out.ScaleUpCooldown = &v
+	}
+	if in.ScaleDownCooldown != nil {
+		v := *in.ScaleDownCooldown
+		out.ScaleDownCooldown = &v
+	}
+}
+
+// DeepCopyInto copies the receiver into out.
+func (in *AutoscalerPolicyStatus) DeepCopyInto(out *AutoscalerPolicyStatus) {
+	*out = *in
+	if in.LastObservedUsage != nil {
+		out.LastObservedUsage = new(ObservedUsage)
+		in.LastObservedUsage.DeepCopyInto(out.LastObservedUsage)
+	}
+	if in.LastAction != nil {
+		out.LastAction = new(LastAction)
+		in.LastAction.DeepCopyInto(out.LastAction)
+	}
+	if in.Conditions != nil {
+		out.Conditions = make([]metav1.Condition, len(in.Conditions))
+		for i := range in.Conditions {
+			in.Conditions[i].DeepCopyInto(&out.Conditions[i])
+		}
+	}
+}
+
+// DeepCopyInto copies the receiver into out.
+func (in *ObservedUsage) DeepCopyInto(out *ObservedUsage) {
+	*out = *in
+	in.Time.DeepCopyInto(&out.Time)
+	if in.PVCs != nil {
+		out.PVCs = make([]PVCUsage, len(in.PVCs))
+		copy(out.PVCs, in.PVCs)
+	}
+}
+
+// DeepCopyInto copies the receiver into out.
+func (in *LastAction) DeepCopyInto(out *LastAction) {
+	*out = *in
+	in.Time.DeepCopyInto(&out.Time)
+}
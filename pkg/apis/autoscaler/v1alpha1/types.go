@@ -0,0 +1,132 @@
+package v1alpha1
+
+import (
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Condition types reported on an AutoscalerPolicy.
+const (
+	// ConditionValid is true when the policy spec passed validation.
+	ConditionValid = "Valid"
+	// ConditionTargetFound is true when the target workload exists.
+	ConditionTargetFound = "TargetFound"
+)
+
+// AutoscalerPolicy configures PVC resizing and network based scaling for a
+// single workload.
+type AutoscalerPolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   AutoscalerPolicySpec   `json:"spec"`
+	Status AutoscalerPolicyStatus `json:"status,omitempty"`
+}
+
+// AutoscalerPolicySpec describes the target workload and its autoscaling rules.
+type AutoscalerPolicySpec struct {
+	// TargetRef points at the workload in the policy's namespace.
+	TargetRef TargetRef `json:"targetRef"`
+	// PVC holds the PVC resize rules. Nil disables PVC resizing.
+	PVC *PVCRules `json:"pvc,omitempty"`
+	// Network holds the network scaling rules. Nil disables network scaling.
+	Network *NetworkRules `json:"network,omitempty"`
+	// Limits bounds the actions taken on the workload.
+	Limits Limits `json:"limits,omitempty"`
+}
+
+// TargetRef identifies the workload a policy applies to.
+type TargetRef struct {
+	APIVersion string `json:"apiVersion,omitempty"`
+	Kind       string `json:"kind"`
+	Name       string `json:"name"`
+}
+
+// PVCRules controls when and how much the workload's PVCs are grown.
+type PVCRules struct {
+	// ResizeThreshold is the disk usage percentage that triggers a resize.
+	ResizeThreshold int32 `json:"resizeThreshold,omitempty"`
+	// InodeThreshold is the inode usage percentage that triggers InodeAction.
+	InodeThreshold int32 `json:"inodeThreshold,omitempty"`
+	// InodeAction is resize or alert.
+	InodeAction string `json:"inodeAction,omitempty"`
+	// Strategy is percentage, fixed or target-utilization.
+	Strategy string `json:"strategy,omitempty"`
+	// GrowthPercent is the percentage a PVC grows by with the percentage strategy.
+	GrowthPercent int32 `json:"growthPercent,omitempty"`
+	// Increment is the amount a PVC grows by with the fixed strategy.
+	Increment *resource.Quantity `json:"increment,omitempty"`
+	// TargetUtilization is the usage percentage the target-utilization
+	// strategy aims for after a resize.
+	TargetUtilization int32 `json:"targetUtilization,omitempty"`
+	// MinStep is the smallest amount a PVC grows by.
+	MinStep *resource.Quantity `json:"minStep,omitempty"`
+	// MaxSize is the size a PVC is never grown beyond.
+	MaxSize *resource.Quantity `json:"maxSize,omitempty"`
+	// MinResizeInterval is the minimum time between two resizes of a PVC.
+	MinResizeInterval *metav1.Duration `json:"minResizeInterval,omitempty"`
+	// MaxResizesPerDay is the most resizes of a PVC within a day.
+	MaxResizesPerDay int32 `json:"maxResizesPerDay,omitempty"`
+	// ForecastHorizon resizes a PVC projected to be full within it.
+	ForecastHorizon *metav1.Duration `json:"forecastHorizon,omitempty"`
+}
+
+// NetworkRules controls when the workload is scaled on network usage.
+type NetworkRules struct {
+	// IngressThreshold is the target per-pod rate of Metric in bytes/sec.
+	// Replicas are scaled in proportion to the average rate over it. It
+	// must be positive when set.
+	IngressThreshold *int64 `json:"ingressThreshold,omitempty"`
+	// Metric is ingress, egress or combined (ingress plus egress).
+	Metric string `json:"metric,omitempty"`
+}
+
+// Limits bounds the actions the autoscaler takes on the workload.
+type Limits struct {
+	MinReplicas *int32           `json:"minReplicas,omitempty"`
+	MaxReplicas *int32           `json:"maxReplicas,omitempty"`
+	Cooldown    *metav1.Duration `json:"cooldown,omitempty"`
+	// ScaleUpCooldown and ScaleDownCooldown are the minimum time since the
+	// last scale before the workload is scaled up or down again.
+	ScaleUpCooldown   *metav1.Duration `json:"scaleUpCooldown,omitempty"`
+	ScaleDownCooldown *metav1.Duration `json:"scaleDownCooldown,omitempty"`
+}
+
+// AutoscalerPolicyStatus reports what the autoscaler last observed and did.
+type AutoscalerPolicyStatus struct {
+	ObservedGeneration int64              `json:"observedGeneration,omitempty"`
+	LastObservedUsage  *ObservedUsage     `json:"lastObservedUsage,omitempty"`
+	LastAction         *LastAction        `json:"lastAction,omitempty"`
+	Conditions         []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// ObservedUsage is the usage measured during the last reconcile.
+type ObservedUsage struct {
+	Time metav1.Time `json:"time"`
+	// PVCs lists the disk usage of each PVC of the workload.
+	PVCs []PVCUsage `json:"pvcs,omitempty"`
+	// MaxPodIngress is the highest per-pod ingress rate, in bytes/sec.
+	MaxPodIngress string `json:"maxPodIngress,omitempty"`
+}
+
+// PVCUsage is the disk usage of a single PVC.
+type PVCUsage struct {
+	Name         string `json:"name"`
+	UsagePercent string `json:"usagePercent"`
+}
+
+// LastAction describes the last change the autoscaler made to the workload.
+type LastAction struct {
+	Time    metav1.Time `json:"time"`
+	Type    string      `json:"type"`
+	Target  string      `json:"target"`
+	Message string      `json:"message,omitempty"`
+}
+
+// AutoscalerPolicyList is a list of AutoscalerPolicy objects.
+type AutoscalerPolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+
+	Items []AutoscalerPolicy `json:"items"`
+}
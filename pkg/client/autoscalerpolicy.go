@@ -0,0 +1,180 @@
+package client
+
+import (
+	"context"
+	"time"
+
+	"k8s-resource-autoscaler/pkg/apis/autoscaler/v1alpha1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+)
+
+// Scheme knows about the autoscaler custom resources.
+var Scheme = runtime.NewScheme()
+
+var parameterCodec = runtime.NewParameterCodec(Scheme)
+
+func init() {
+	if err := v1alpha1.AddToScheme(Scheme); err != nil {
+		panic(err)
+	}
+	// Make the types known to the shared scheme so Events can reference them
+	if err := v1alpha1.AddToScheme(scheme.Scheme); err != nil {
+		panic(err)
+	}
+}
+
+// Interface gives access to the autoscaler custom resources.
+type Interface interface {
+	AutoscalerPolicies(namespace string) AutoscalerPolicyInterface
+}
+
+// AutoscalerPolicyInterface has methods to work with AutoscalerPolicy resources.
+type AutoscalerPolicyInterface interface {
+	Get(ctx context.Context, name string, opts metav1.GetOptions) (*v1alpha1.AutoscalerPolicy, error)
+	List(ctx context.Context, opts metav1.ListOptions) (*v1alpha1.AutoscalerPolicyList, error)
+	Watch(ctx context.Context, opts metav1.ListOptions) (watch.Interface, error)
+	UpdateStatus(ctx context.Context, policy *v1alpha1.AutoscalerPolicy, opts metav1.UpdateOptions) (*v1alpha1.AutoscalerPolicy, error)
+}
+
+// Clientset is a typed client for the autoscaler API group.
+type Clientset struct {
+	restClient rest.Interface
+}
+
+// NewForConfig creates a Clientset for the given config.
+func NewForConfig(c *rest.Config) (*Clientset, error) {
+	config := *c
+	config.GroupVersion = &v1alpha1.SchemeGroupVersion
+	config.APIPath = "/apis"
+	config.ContentType = runtime.ContentTypeJSON
+	config.NegotiatedSerializer = serializer.NewCodecFactory(Scheme).WithoutConversion()
+	if config.UserAgent == "" {
+		config.UserAgent = rest.DefaultKubernetesUserAgent()
+	}
+
+	restClient, err := rest.RESTClientFor(&config)
+	if err != nil {
+		return nil, err
+	}
+	return &Clientset{restClient: restClient}, nil
+}
+
+// New creates a Clientset around an existing REST client.
+func New(c rest.Interface) *Clientset {
+	return &Clientset{restClient: c}
+}
+
+// AutoscalerPolicies returns the AutoscalerPolicy client for a namespace.
+func (c *Clientset) AutoscalerPolicies(namespace string) AutoscalerPolicyInterface {
+	return &autoscalerPolicies{client: c.restClient, ns: namespace}
+}
+
+type autoscalerPolicies struct {
+	client rest.Interface
+	ns     string
+}
+
+const resourceName = "autoscalerpolicies"
+
+// Get returns the policy with the given name.
+func (c *autoscalerPolicies) Get(ctx context.Context, name string, opts metav1.GetOptions) (*v1alpha1.AutoscalerPolicy, error) {
+	result := &v1alpha1.AutoscalerPolicy{}
+	err := c.client.Get().
+		Namespace(c.ns).
+		Resource(resourceName).
+		Name(name).
+		VersionedParams(&opts, parameterCodec).
+		Do(ctx).
+		Into(result)
+	return result, err
+}
+
+// List returns the policies matching opts.
+func (c *autoscalerPolicies) List(ctx context.Context, opts metav1.ListOptions) (*v1alpha1.AutoscalerPolicyList, error) {
+	var timeout time.Duration
+	if opts.TimeoutSeconds != nil {
+		timeout = time.Duration(*opts.TimeoutSeconds) * time.Second
+	}
+	result := &v1alpha1.AutoscalerPolicyList{}
+	err := c.client.Get().
+		Namespace(c.ns).
+		Resource(resourceName).
+		VersionedParams(&opts, parameterCodec).
+		Timeout(timeout).
+		Do(ctx).
+		Into(result)
+	return result, err
+}
+
+// Watch watches the policies matching opts.
+func (c *autoscalerPolicies) Watch(ctx context.Context, opts metav1.ListOptions) (watch.Interface, error) {
+	var timeout time.Duration
+	if opts.TimeoutSeconds != nil {
+		timeout = time.Duration(*opts.TimeoutSeconds) * time.Second
+	}
+	opts.Watch = true
+	return c.client.Get().
+		Namespace(c.ns).
+		Resource(resourceName).
+		VersionedParams(&opts, parameterCodec).
+		Timeout(timeout).
+		Watch(ctx)
+}
+
+// UpdateStatus writes the status subresource of the policy.
+func (c *autoscalerPolicies) UpdateStatus(ctx context.Context, policy *v1alpha1.AutoscalerPolicy, opts metav1.UpdateOptions) (*v1alpha1.AutoscalerPolicy, error) {
+	result := &v1alpha1.AutoscalerPolicy{}
+	err := c.client.Put().
+		Namespace(c.ns).
+		Resource(resourceName).
+		Name(policy.Name).
+		SubResource("status").
+		VersionedParams(&opts, parameterCodec).
+		Body(policy).
+		Do(ctx).
+		Into(result)
+	return result, err
+}
+
+// Installed reports whether the AutoscalerPolicy CRD is served by the cluster.
+func Installed(clientset kubernetes.Interface) (bool, error) {
+	resources, err := clientset.Discovery().ServerResourcesForGroupVersion(v1alpha1.SchemeGroupVersion.String())
+	if apierrors.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	for _, r := range resources.APIResources {
+		if r.Name == resourceName {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// NewAutoscalerPolicyInformer returns a shared informer for AutoscalerPolicy
+// resources in all namespaces.
+func NewAutoscalerPolicyInformer(c Interface, resync time.Duration, indexers cache.Indexers) cache.SharedIndexInformer {
+	return cache.NewSharedIndexInformer(
+		&cache.ListWatch{
+			ListFunc: func(opts metav1.ListOptions) (runtime.Object, error) {
+				return c.AutoscalerPolicies(metav1.NamespaceAll).List(context.TODO(), opts)
+			},
+			WatchFunc: func(opts metav1.ListOptions) (watch.Interface, error) {
+				return c.AutoscalerPolicies(metav1.NamespaceAll).Watch(context.TODO(), opts)
+			},
+		},
+		&v1alpha1.AutoscalerPolicy{},
+		resync,
+		indexers,
+	)
+}
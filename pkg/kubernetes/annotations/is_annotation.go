@@ -1,57 +1,63 @@
 package annotations
 
 import (
-	"context"
-	"k8s-resource-autoscaler/pkg/log"
+	appsv1 "k8s.io/api/apps/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/client-go/kubernetes"
 )
 
+const (
+	annotationKey   = "autoscaler/enabled"
+	annotationValue = "true"
+)
+
+// Workload kinds that can be discovered.
+const (
+	KindDeployment  = "Deployment"
+	KindStatefulSet = "StatefulSet"
+)
+
+// DeploymentResult describes a discovered workload. Despite its name it is
+// also used for StatefulSets, in which case Kind is KindStatefulSet and
+// Deployment holds the StatefulSet name.
 type DeploymentResult struct {
+	Kind       string
 	Namespace  string
 	Deployment string
 	PVCNames   []string
+	// Templates maps each per-ordinal PVC name of a StatefulSet to the
+	// volumeClaimTemplate it was created from.
+	Templates map[string]string
+	// Policy holds the per-workload overrides parsed from the annotations.
+	Policy Policy
+	// PolicyErrors lists the annotations that could not be parsed.
+	PolicyErrors []error
 }
 
-// IsAnnotation checks for deployments with the specified annotation in all namespaces.
-func IsAnnotation(clientset *kubernetes.Clientset) ([]DeploymentResult, bool, error) {
-	var results []DeploymentResult
-	const annotationKey = "autoscaler/enabled"
-	const annotationValue = "true"
-	log.Info("Checking annotations......")
-	namespaces, err := clientset.CoreV1().Namespaces().List(context.TODO(), metav1.ListOptions{})
-	if err != nil {
-		return nil, false, err
-	}
-
-	for _, ns := range namespaces.Items {
-		deployments, err := clientset.AppsV1().Deployments(ns.Name).List(context.TODO(), metav1.ListOptions{})
-		if err != nil {
-			return nil, false, err
-		}
+// IsEnabled reports whether the workload carries the autoscaler annotation.
+func IsEnabled(obj metav1.Object) bool {
+	val, exists := obj.GetAnnotations()[annotationKey]
+	return exists && val == annotationValue
+}
 
-		for _, deployment := range deployments.Items {
-			if val, exists := deployment.Annotations[annotationKey]; exists && val == annotationValue {
-				// Collect the PVCs used by the deployment, if any
-				pvcNames := []string{}
-				// Assuming your deployment spec has a template with volume claims
-				for _, volume := range deployment.Spec.Template.Spec.Volumes {
-					if volume.PersistentVolumeClaim != nil {
-						pvcNames = append(pvcNames, volume.PersistentVolumeClaim.ClaimName)
-					}
-				}
-
-				results = append(results, DeploymentResult{
-					Namespace:  ns.Name,
-					Deployment: deployment.Name,
-					PVCNames:   pvcNames,
-				})
-			}
+// NewDeploymentResult builds the DeploymentResult for a deployment without
+// checking for the autoscaler annotation.
+func NewDeploymentResult(deployment *appsv1.Deployment) DeploymentResult {
+	// Collect the PVCs used by the deployment, if any
+	pvcNames := []string{}
+	for _, volume := range deployment.Spec.Template.Spec.Volumes {
+		if volume.PersistentVolumeClaim != nil {
+			pvcNames = append(pvcNames, volume.PersistentVolumeClaim.ClaimName)
 		}
 	}
 
-	if len(results) == 0 {
-		return nil, false, nil
+	policy, errs := ParsePolicy(deployment.Annotations)
+
+	return DeploymentResult{
+		Kind:         KindDeployment,
+		Namespace:    deployment.Namespace,
+		Deployment:   deployment.Name,
+		PVCNames:     pvcNames,
+		Policy:       policy,
+		PolicyErrors: errs,
 	}
-	return results, true, nil
 }
@@ -0,0 +1,407 @@
+package annotations
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"k8s-resource-autoscaler/config"
+	"k8s-resource-autoscaler/pkg/kubernetes/deployment"
+	"k8s-resource-autoscaler/pkg/kubernetes/pvc"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// Annotations that override the global thresholds for a single workload.
+const (
+	DiskResizeThresholdAnnotation = "autoscaler/disk-resize-threshold"
+	InodeThresholdAnnotation      = "autoscaler/inode-threshold"
+	InodeActionAnnotation         = "autoscaler/inode-action"
+	DiskGrowthPercentAnnotation   = "autoscaler/disk-growth-percent"
+	DiskGrowthStrategyAnnotation  = "autoscaler/disk-growth-strategy"
+	DiskGrowthIncrementAnnotation = "autoscaler/disk-growth-increment"
+	DiskTargetUtilAnnotation      = "autoscaler/disk-target-utilization"
+	MinPVCStepAnnotation          = "autoscaler/min-pvc-step"
+	MaxPVCSizeAnnotation          = "autoscaler/max-pvc-size"
+	MinResizeIntervalAnnotation   = "autoscaler/min-resize-interval"
+	MaxResizesPerDayAnnotation    = "autoscaler/max-resizes-per-day"
+	DiskForecastHorizonAnnotation = "autoscaler/disk-forecast-horizon"
+	IngressThresholdAnnotation    = "autoscaler/ingress-threshold"
+	ScalingMetricAnnotation       = "autoscaler/scaling-metric"
+	MinReplicasAnnotation         = "autoscaler/min-replicas"
+	MaxReplicasAnnotation         = "autoscaler/max-replicas"
+	CooldownAnnotation            = "autoscaler/cooldown"
+	ScaleUpCooldownAnnotation     = "autoscaler/scale-up-cooldown"
+	ScaleDownCooldownAnnotation   = "autoscaler/scale-down-cooldown"
+)
+
+// defaultDiskGrowthPercent is the growth applied when neither the workload
+// nor the configuration sets one.
+const defaultDiskGrowthPercent = 50
+
+// defaultDiskTargetUtilization is the usage the target-utilization strategy
+// aims for when neither the workload nor the configuration sets one.
+const defaultDiskTargetUtilization = 70
+
+// InodeAction is what is done when the inode usage of a PVC exceeds its
+// threshold.
+type InodeAction string
+
+const (
+	// InodeActionResize resizes the PVC.
+	InodeActionResize InodeAction = "resize"
+	// InodeActionAlert only reports the usage, for filesystems where a
+	// larger volume does not get more inodes.
+	InodeActionAlert InodeAction = "alert"
+)
+
+// ParseInodeAction parses the name of an inode action.
+func ParseInodeAction(s string) (InodeAction, error) {
+	switch a := InodeAction(s); a {
+	case InodeActionResize, InodeActionAlert:
+		return a, nil
+	}
+	return "", fmt.Errorf("unknown inode action %q, expected %s or %s", s, InodeActionResize, InodeActionAlert)
+}
+
+// Policy holds the autoscaling settings of a single workload. Zero values
+// mean "not set" and are filled from the global configuration by WithDefaults.
+type Policy struct {
+	// DiskResizeThreshold is the disk usage percentage above which PVCs are resized.
+	DiskResizeThreshold int
+	// InodeThreshold is the inode usage percentage above which InodeAction
+	// is taken. Zero disables the inode check.
+	InodeThreshold int
+	InodeAction    InodeAction
+	// DiskGrowthStrategy selects how the new size of a PVC is calculated.
+	DiskGrowthStrategy pvc.GrowthStrategy
+	// DiskGrowthPercent is the percentage a PVC grows by with the percentage strategy.
+	DiskGrowthPercent int
+	// DiskGrowthIncrement is the amount a PVC grows by with the fixed strategy.
+	DiskGrowthIncrement resource.Quantity
+	// DiskTargetUtilization is the usage percentage the target-utilization
+	// strategy aims for after a resize.
+	DiskTargetUtilization int
+	// MinPVCStep is the smallest amount a PVC grows by. Zero means no minimum.
+	MinPVCStep resource.Quantity
+	// MaxPVCSize caps the size a PVC is grown to. Zero means unbounded.
+	MaxPVCSize resource.Quantity
+	// MinResizeInterval is the minimum time between two resizes of a PVC
+	// and MaxResizesPerDay the most resizes of a PVC within a day. Zero
+	// means no limit.
+	MinResizeInterval time.Duration
+	MaxResizesPerDay  int
+	// ForecastHorizon resizes a PVC projected to be full within it. Zero
+	// disables forecasting.
+	ForecastHorizon time.Duration
+	// IngressThreshold is the target per-pod rate of ScalingMetric in
+	// bytes/sec. Replicas are scaled in proportion to the average rate over it.
+	IngressThreshold int
+	// ScalingMetric selects the network rate replicas are computed from.
+	ScalingMetric deployment.ScalingMetric
+	// MinReplicas and MaxReplicas bound the replica count. Zero means unbounded.
+	MinReplicas int32
+	MaxReplicas int32
+	// Cooldown is the minimum time between two actions on the workload.
+	Cooldown time.Duration
+	// ScaleUpCooldown and ScaleDownCooldown are the minimum time since the
+	// last scale before the workload is scaled up or down again.
+	ScaleUpCooldown   time.Duration
+	ScaleDownCooldown time.Duration
+}
+
+// DefaultPolicy returns the policy described by the global configuration.
+// Invalid PVC growth settings are ignored.
+func DefaultPolicy(cfg *config.AutoscalerConfig) Policy {
+	policy := Policy{
+		DiskResizeThreshold:   cfg.Thresholds.DiskUsage.Resize,
+		InodeThreshold:        cfg.Thresholds.InodeUsage.Resize,
+		InodeAction:           InodeActionAlert,
+		DiskGrowthStrategy:    pvc.GrowthPercentage,
+		DiskGrowthPercent:     defaultDiskGrowthPercent,
+		DiskTargetUtilization: defaultDiskTargetUtilization,
+		IngressThreshold:      cfg.Thresholds.NetworkUsage.Ingress.Scale,
+		ScalingMetric:         deployment.MetricIngress,
+		MinReplicas:           1,
+		ScaleUpCooldown:       cfg.NetworkScaling.ScaleUp.Cooldown,
+		ScaleDownCooldown:     cfg.NetworkScaling.ScaleDown.Cooldown,
+	}
+	if metric, err := deployment.ParseScalingMetric(cfg.NetworkScaling.Metric); err == nil {
+		policy.ScalingMetric = metric
+	}
+
+	if action, err := ParseInodeAction(cfg.Thresholds.InodeUsage.Action); err == nil {
+		policy.InodeAction = action
+	}
+
+	growth := cfg.PVCGrowth
+	if strategy, err := pvc.ParseGrowthStrategy(growth.Strategy); err == nil {
+		policy.DiskGrowthStrategy = strategy
+	}
+	if growth.Percent > 0 {
+		policy.DiskGrowthPercent = growth.Percent
+	}
+	if growth.TargetUtilization > 0 && growth.TargetUtilization < 100 {
+		policy.DiskTargetUtilization = growth.TargetUtilization
+	}
+	if q, err := resource.ParseQuantity(growth.Increment); err == nil && q.Sign() > 0 {
+		policy.DiskGrowthIncrement = q
+	}
+	if q, err := resource.ParseQuantity(growth.MinStep); err == nil && q.Sign() > 0 {
+		policy.MinPVCStep = q
+	}
+	if q, err := resource.ParseQuantity(growth.MaxSize); err == nil && q.Sign() > 0 {
+		policy.MaxPVCSize = q
+	}
+	if growth.MinInterval > 0 {
+		policy.MinResizeInterval = growth.MinInterval
+	}
+	if growth.MaxResizesPerDay > 0 {
+		policy.MaxResizesPerDay = growth.MaxResizesPerDay
+	}
+	if growth.Forecast.Horizon > 0 {
+		policy.ForecastHorizon = growth.Forecast.Horizon
+	}
+	return policy
+}
+
+// WithDefaults returns the policy with unset fields taken from defaults.
+func (p Policy) WithDefaults(defaults Policy) Policy {
+	if p.DiskResizeThreshold == 0 {
+		p.DiskResizeThreshold = defaults.DiskResizeThreshold
+	}
+	if p.InodeThreshold == 0 {
+		p.InodeThreshold = defaults.InodeThreshold
+	}
+	if p.InodeAction == "" {
+		p.InodeAction = defaults.InodeAction
+	}
+	if p.DiskGrowthStrategy == "" {
+		p.DiskGrowthStrategy = defaults.DiskGrowthStrategy
+	}
+	if p.DiskGrowthPercent == 0 {
+		p.DiskGrowthPercent = defaults.DiskGrowthPercent
+	}
+	if p.DiskGrowthIncrement.IsZero() {
+		p.DiskGrowthIncrement = defaults.DiskGrowthIncrement
+	}
+	if p.DiskTargetUtilization == 0 {
+		p.DiskTargetUtilization = defaults.DiskTargetUtilization
+	}
+	if p.MinPVCStep.IsZero() {
+		p.MinPVCStep = defaults.MinPVCStep
+	}
+	if p.MaxPVCSize.IsZero() {
+		p.MaxPVCSize = defaults.MaxPVCSize
+	}
+	if p.MinResizeInterval == 0 {
+		p.MinResizeInterval = defaults.MinResizeInterval
+	}
+	if p.MaxResizesPerDay == 0 {
+		p.MaxResizesPerDay = defaults.MaxResizesPerDay
+	}
+	if p.ForecastHorizon == 0 {
+		p.ForecastHorizon = defaults.ForecastHorizon
+	}
+	if p.IngressThreshold == 0 {
+		p.IngressThreshold = defaults.IngressThreshold
+	}
+	if p.ScalingMetric == "" {
+		p.ScalingMetric = defaults.ScalingMetric
+	}
+	if p.MinReplicas == 0 {
+		p.MinReplicas = defaults.MinReplicas
+	}
+	if p.MaxReplicas == 0 {
+		p.MaxReplicas = defaults.MaxReplicas
+	}
+	if p.Cooldown == 0 {
+		p.Cooldown = defaults.Cooldown
+	}
+	if p.ScaleUpCooldown == 0 {
+		p.ScaleUpCooldown = defaults.ScaleUpCooldown
+	}
+	if p.ScaleDownCooldown == 0 {
+		p.ScaleDownCooldown = defaults.ScaleDownCooldown
+	}
+	return p
+}
+
+// ParsePolicy parses the policy overrides from a workload's annotations.
+// Invalid values are left unset and reported in the returned errors.
+func ParsePolicy(annotations map[string]string) (Policy, []error) {
+	var policy Policy
+	var errs []error
+
+	if val, ok := annotations[DiskResizeThresholdAnnotation]; ok {
+		n, err := strconv.Atoi(val)
+		if err != nil || n < 1 || n > 100 {
+			errs = append(errs, fmt.Errorf("%s: %q must be a percentage between 1 and 100", DiskResizeThresholdAnnotation, val))
+		} else {
+			policy.DiskResizeThreshold = n
+		}
+	}
+
+	if val, ok := annotations[InodeThresholdAnnotation]; ok {
+		n, err := strconv.Atoi(val)
+		if err != nil || n < 1 || n > 100 {
+			errs = append(errs, fmt.Errorf("%s: %q must be a percentage between 1 and 100", InodeThresholdAnnotation, val))
+		} else {
+			policy.InodeThreshold = n
+		}
+	}
+
+	if val, ok := annotations[InodeActionAnnotation]; ok {
+		action, err := ParseInodeAction(val)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", InodeActionAnnotation, err))
+		} else {
+			policy.InodeAction = action
+		}
+	}
+
+	if val, ok := annotations[DiskGrowthPercentAnnotation]; ok {
+		n, err := strconv.Atoi(val)
+		if err != nil || n < 1 {
+			errs = append(errs, fmt.Errorf("%s: %q must be a positive percentage", DiskGrowthPercentAnnotation, val))
+		} else {
+			policy.DiskGrowthPercent = n
+		}
+	}
+
+	if val, ok := annotations[DiskGrowthStrategyAnnotation]; ok {
+		strategy, err := pvc.ParseGrowthStrategy(val)
+		if err != nil || val == "" {
+			errs = append(errs, fmt.Errorf("%s: %q must be %s, %s or %s", DiskGrowthStrategyAnnotation, val, pvc.GrowthPercentage, pvc.GrowthFixed, pvc.GrowthTargetUtilization))
+		} else {
+			policy.DiskGrowthStrategy = strategy
+		}
+	}
+
+	if val, ok := annotations[DiskGrowthIncrementAnnotation]; ok {
+		q, err := resource.ParseQuantity(val)
+		if err != nil || q.Sign() <= 0 {
+			errs = append(errs, fmt.Errorf("%s: %q must be a positive quantity such as 10Gi", DiskGrowthIncrementAnnotation, val))
+		} else {
+			policy.DiskGrowthIncrement = q
+		}
+	}
+
+	if val, ok := annotations[DiskTargetUtilAnnotation]; ok {
+		n, err := strconv.Atoi(val)
+		if err != nil || n < 1 || n > 99 {
+			errs = append(errs, fmt.Errorf("%s: %q must be a percentage between 1 and 99", DiskTargetUtilAnnotation, val))
+		} else {
+			policy.DiskTargetUtilization = n
+		}
+	}
+
+	if val, ok := annotations[MinPVCStepAnnotation]; ok {
+		q, err := resource.ParseQuantity(val)
+		if err != nil || q.Sign() <= 0 {
+			errs = append(errs, fmt.Errorf("%s: %q must be a positive quantity such as 1Gi", MinPVCStepAnnotation, val))
+		} else {
+			policy.MinPVCStep = q
+		}
+	}
+
+	if val, ok := annotations[MaxPVCSizeAnnotation]; ok {
+		q, err := resource.ParseQuantity(val)
+		if err != nil || q.Sign() <= 0 {
+			errs = append(errs, fmt.Errorf("%s: %q must be a positive quantity such as 100Gi", MaxPVCSizeAnnotation, val))
+		} else {
+			policy.MaxPVCSize = q
+		}
+	}
+
+	if val, ok := annotations[MinResizeIntervalAnnotation]; ok {
+		d, err := time.ParseDuration(val)
+		if err != nil || d <= 0 {
+			errs = append(errs, fmt.Errorf("%s: %q must be a positive duration such as 1h", MinResizeIntervalAnnotation, val))
+		} else {
+			policy.MinResizeInterval = d
+		}
+	}
+
+	if val, ok := annotations[MaxResizesPerDayAnnotation]; ok {
+		n, err := strconv.Atoi(val)
+		if err != nil || n < 1 {
+			errs = append(errs, fmt.Errorf("%s: %q must be a positive number", MaxResizesPerDayAnnotation, val))
+		} else {
+			policy.MaxResizesPerDay = n
+		}
+	}
+
+	if val, ok := annotations[DiskForecastHorizonAnnotation]; ok {
+		d, err := time.ParseDuration(val)
+		if err != nil || d <= 0 {
+			errs = append(errs, fmt.Errorf("%s: %q must be a positive duration such as 6h", DiskForecastHorizonAnnotation, val))
+		} else {
+			policy.ForecastHorizon = d
+		}
+	}
+
+	if val, ok := annotations[IngressThresholdAnnotation]; ok {
+		n, err := strconv.Atoi(val)
+		if err != nil || n < 1 {
+			errs = append(errs, fmt.Errorf("%s: %q must be a positive rate in bytes per second", IngressThresholdAnnotation, val))
+		} else {
+			policy.IngressThreshold = n
+		}
+	}
+
+	if val, ok := annotations[ScalingMetricAnnotation]; ok {
+		metric, err := deployment.ParseScalingMetric(val)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", ScalingMetricAnnotation, err))
+		} else {
+			policy.ScalingMetric = metric
+		}
+	}
+
+	if val, ok := annotations[MinReplicasAnnotation]; ok {
+		n, err := strconv.ParseInt(val, 10, 32)
+		if err != nil || n < 1 {
+			errs = append(errs, fmt.Errorf("%s: %q must be a positive replica count", MinReplicasAnnotation, val))
+		} else {
+			policy.MinReplicas = int32(n)
+		}
+	}
+
+	if val, ok := annotations[MaxReplicasAnnotation]; ok {
+		n, err := strconv.ParseInt(val, 10, 32)
+		if err != nil || n < 1 {
+			errs = append(errs, fmt.Errorf("%s: %q must be a positive replica count", MaxReplicasAnnotation, val))
+		} else {
+			policy.MaxReplicas = int32(n)
+		}
+	}
+
+	if policy.MinReplicas > 0 && policy.MaxReplicas > 0 && policy.MinReplicas > policy.MaxReplicas {
+		errs = append(errs, fmt.Errorf("%s (%d) must not exceed %s (%d)", MinReplicasAnnotation, policy.MinReplicas, MaxReplicasAnnotation, policy.MaxReplicas))
+		policy.MinReplicas = 0
+		policy.MaxReplicas = 0
+	}
+
+	for _, cooldown := range []struct {
+		annotation string
+		field      *time.Duration
+	}{
+		{CooldownAnnotation, &policy.Cooldown},
+		{ScaleUpCooldownAnnotation, &policy.ScaleUpCooldown},
+		{ScaleDownCooldownAnnotation, &policy.ScaleDownCooldown},
+	} {
+		val, ok := annotations[cooldown.annotation]
+		if !ok {
+			continue
+		}
+		// Zero would read as unset and fall back to the default cooldown
+		d, err := time.ParseDuration(val)
+		if err != nil || d <= 0 {
+			errs = append(errs, fmt.Errorf("%s: %q must be a positive duration such as 10m", cooldown.annotation, val))
+		} else {
+			*cooldown.field = d
+		}
+	}
+
+	return policy, errs
+}
@@ -0,0 +1,58 @@
+package annotations
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParsePolicyIngressThreshold(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    int
+		wantErr bool
+	}{
+		{value: "1048576", want: 1048576},
+		{value: "0", wantErr: true},
+		{value: "-1", wantErr: true},
+		{value: "fast", wantErr: true},
+	}
+	for _, tt := range tests {
+		policy, errs := ParsePolicy(map[string]string{IngressThresholdAnnotation: tt.value})
+		if policy.IngressThreshold != tt.want {
+			t.Errorf("ParsePolicy(%q).IngressThreshold = %d, want %d", tt.value, policy.IngressThreshold, tt.want)
+		}
+		if (len(errs) > 0) != tt.wantErr {
+			t.Errorf("ParsePolicy(%q) errors = %v, want errors: %v", tt.value, errs, tt.wantErr)
+		}
+	}
+}
+
+func TestParsePolicyCooldowns(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{value: "10m", want: 10 * time.Minute},
+		{value: "0s", wantErr: true},
+		{value: "0", wantErr: true},
+		{value: "-1m", wantErr: true},
+		{value: "soon", wantErr: true},
+	}
+	for _, annotation := range []string{CooldownAnnotation, ScaleUpCooldownAnnotation, ScaleDownCooldownAnnotation} {
+		for _, tt := range tests {
+			policy, errs := ParsePolicy(map[string]string{annotation: tt.value})
+			got := map[string]time.Duration{
+				CooldownAnnotation:          policy.Cooldown,
+				ScaleUpCooldownAnnotation:   policy.ScaleUpCooldown,
+				ScaleDownCooldownAnnotation: policy.ScaleDownCooldown,
+			}[annotation]
+			if got != tt.want {
+				t.Errorf("ParsePolicy(%s=%q) cooldown = %s, want %s", annotation, tt.value, got, tt.want)
+			}
+			if (len(errs) > 0) != tt.wantErr {
+				t.Errorf("ParsePolicy(%s=%q) errors = %v, want errors: %v", annotation, tt.value, errs, tt.wantErr)
+			}
+		}
+	}
+}
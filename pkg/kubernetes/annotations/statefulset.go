@@ -0,0 +1,50 @@
+package annotations
+
+import (
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+)
+
+// OrdinalPVCName returns the name of the PVC a StatefulSet creates from a
+// volumeClaimTemplate for the given ordinal.
+func OrdinalPVCName(template, statefulSet string, ordinal int32) string {
+	return fmt.Sprintf("%s-%s-%d", template, statefulSet, ordinal)
+}
+
+// NewStatefulSetResult builds the DeploymentResult for a statefulset without
+// checking for the autoscaler annotation. Its PVCs are the per-ordinal claims
+// created from the volumeClaimTemplates plus any PVCs mounted directly.
+func NewStatefulSetResult(sts *appsv1.StatefulSet) DeploymentResult {
+	replicas := int32(1)
+	if sts.Spec.Replicas != nil {
+		replicas = *sts.Spec.Replicas
+	}
+
+	pvcNames := []string{}
+	templates := map[string]string{}
+	for _, template := range sts.Spec.VolumeClaimTemplates {
+		for ordinal := int32(0); ordinal < replicas; ordinal++ {
+			name := OrdinalPVCName(template.Name, sts.Name, ordinal)
+			pvcNames = append(pvcNames, name)
+			templates[name] = template.Name
+		}
+	}
+	for _, volume := range sts.Spec.Template.Spec.Volumes {
+		if volume.PersistentVolumeClaim != nil {
+			pvcNames = append(pvcNames, volume.PersistentVolumeClaim.ClaimName)
+		}
+	}
+
+	policy, errs := ParsePolicy(sts.Annotations)
+
+	return DeploymentResult{
+		Kind:         KindStatefulSet,
+		Namespace:    sts.Namespace,
+		Deployment:   sts.Name,
+		PVCNames:     pvcNames,
+		Templates:    templates,
+		Policy:       policy,
+		PolicyErrors: errs,
+	}
+}
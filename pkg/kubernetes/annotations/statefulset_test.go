@@ -0,0 +1,90 @@
+package annotations
+
+import (
+	"reflect"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestOrdinalPVCName(t *testing.T) {
+	if got, want := OrdinalPVCName("data", "db", 2), "data-db-2"; got != want {
+		t.Errorf("OrdinalPVCName() = %q, want %q", got, want)
+	}
+}
+
+func statefulSet(replicas *int32, templates []string, claims ...string) *appsv1.StatefulSet {
+	sts := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "db", Annotations: map[string]string{"autoscaler/enabled": "true"}},
+		Spec:       appsv1.StatefulSetSpec{Replicas: replicas},
+	}
+	for _, name := range templates {
+		sts.Spec.VolumeClaimTemplates = append(sts.Spec.VolumeClaimTemplates, corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: name}})
+	}
+	for _, claim := range claims {
+		sts.Spec.Template.Spec.Volumes = append(sts.Spec.Template.Spec.Volumes, corev1.Volume{
+			Name:         claim,
+			VolumeSource: corev1.VolumeSource{PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: claim}},
+		})
+	}
+	// A volume that is not a claim is left out
+	sts.Spec.Template.Spec.Volumes = append(sts.Spec.Template.Spec.Volumes, corev1.Volume{
+		Name:         "config",
+		VolumeSource: corev1.VolumeSource{ConfigMap: &corev1.ConfigMapVolumeSource{}},
+	})
+	return sts
+}
+
+func TestNewStatefulSetResult(t *testing.T) {
+	three, zero := int32(3), int32(0)
+	tests := []struct {
+		name          string
+		sts           *appsv1.StatefulSet
+		wantPVCs      []string
+		wantTemplates map[string]string
+	}{
+		{
+			name:          "per-ordinal claims",
+			sts:           statefulSet(&three, []string{"data"}),
+			wantPVCs:      []string{"data-db-0", "data-db-1", "data-db-2"},
+			wantTemplates: map[string]string{"data-db-0": "data", "data-db-1": "data", "data-db-2": "data"},
+		},
+		{
+			name:     "template and direct claims",
+			sts:      statefulSet(&three, []string{"data", "wal"}, "shared"),
+			wantPVCs: []string{"data-db-0", "data-db-1", "data-db-2", "wal-db-0", "wal-db-1", "wal-db-2", "shared"},
+			wantTemplates: map[string]string{
+				"data-db-0": "data", "data-db-1": "data", "data-db-2": "data",
+				"wal-db-0": "wal", "wal-db-1": "wal", "wal-db-2": "wal",
+			},
+		},
+		{
+			name:          "replicas unset",
+			sts:           statefulSet(nil, []string{"data"}, "shared"),
+			wantPVCs:      []string{"data-db-0", "shared"},
+			wantTemplates: map[string]string{"data-db-0": "data"},
+		},
+		{
+			name:          "scaled to zero",
+			sts:           statefulSet(&zero, []string{"data"}, "shared"),
+			wantPVCs:      []string{"shared"},
+			wantTemplates: map[string]string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := NewStatefulSetResult(tt.sts)
+			if result.Kind != KindStatefulSet || result.Namespace != "shop" || result.Deployment != "db" {
+				t.Errorf("result = %s %s/%s, want StatefulSet shop/db", result.Kind, result.Namespace, result.Deployment)
+			}
+			if !reflect.DeepEqual(result.PVCNames, tt.wantPVCs) {
+				t.Errorf("PVCNames = %v, want %v", result.PVCNames, tt.wantPVCs)
+			}
+			if !reflect.DeepEqual(result.Templates, tt.wantTemplates) {
+				t.Errorf("Templates = %v, want %v", result.Templates, tt.wantTemplates)
+			}
+		})
+	}
+}
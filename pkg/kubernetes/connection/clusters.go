@@ -0,0 +1,76 @@
+package connection
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"k8s-resource-autoscaler/config"
+	"k8s-resource-autoscaler/pkg/log"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// Cluster is a cluster managed by the autoscaler.
+type Cluster struct {
+	// Name is empty when a single cluster is managed.
+	Name    string
+	Options Options
+	// Config holds the per-cluster settings from the configuration file.
+	Config config.ClusterConfig
+}
+
+// Clusters returns the clusters to manage: one per configured entry, or the
+// single cluster selected by defaults when none are configured. Entries
+// inherit the rate limits of defaults, and its kubeconfig when they set none.
+func Clusters(configured []config.ClusterConfig, defaults Options) []Cluster {
+	if len(configured) == 0 {
+		return []Cluster{{Options: defaults}}
+	}
+
+	clusters := make([]Cluster, 0, len(configured))
+	for _, c := range configured {
+		opts := defaults
+		opts.Context = c.Context
+		if c.Kubeconfig != "" {
+			opts.Kubeconfig = c.Kubeconfig
+		}
+		clusters = append(clusters, Cluster{Name: c.Name, Options: opts, Config: c})
+	}
+	return clusters
+}
+
+// Connect builds the REST config of the cluster and connects to it.
+func Connect(cluster Cluster) (*rest.Config, *kubernetes.Clientset, error) {
+	restConfig, err := BuildConfig(cluster.Options)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error building the Kubernetes client configuration: %v", err)
+	}
+	clientset, err := ConnectToCluster(restConfig)
+	if err != nil {
+		return nil, nil, err
+	}
+	return restConfig, clientset, nil
+}
+
+// ConnectWithRetry connects to the cluster, retrying with exponential backoff
+// until it succeeds or ctx is cancelled. An unreachable cluster only delays
+// its own pipeline.
+func ConnectWithRetry(ctx context.Context, cluster Cluster) (*rest.Config, *kubernetes.Clientset, error) {
+	logger := log.With("cluster", cluster.Name)
+	backoff := wait.Backoff{Duration: 5 * time.Second, Factor: 2, Jitter: 0.1, Steps: 1 << 30, Cap: 5 * time.Minute}
+	for {
+		restConfig, clientset, err := Connect(cluster)
+		if err == nil {
+			return restConfig, clientset, nil
+		}
+		delay := backoff.Step()
+		logger.Error("Error connecting to the cluster, retrying in %s: %v", delay.Round(time.Second), err)
+		select {
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
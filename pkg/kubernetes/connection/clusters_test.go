@@ -0,0 +1,118 @@
+package connection
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"k8s-resource-autoscaler/config"
+)
+
+func TestClusters(t *testing.T) {
+	defaults := Options{Kubeconfig: "/etc/autoscaler/kubeconfig", Context: "default", QPS: 50, Burst: 80}
+
+	single := Clusters(nil, defaults)
+	if len(single) != 1 || single[0].Name != "" || single[0].Options != defaults {
+		t.Errorf("Clusters() without configured clusters = %+v, want one unnamed cluster with the defaults", single)
+	}
+
+	configured := []config.ClusterConfig{
+		{Name: "east", Context: "east"},
+		{Name: "west", Kubeconfig: "/etc/autoscaler/west", Context: "west", PrometheusURL: "http://prometheus.west:9090"},
+		{Name: "local"},
+	}
+	want := []Options{
+		{Kubeconfig: "/etc/autoscaler/kubeconfig", Context: "east", QPS: 50, Burst: 80},
+		{Kubeconfig: "/etc/autoscaler/west", Context: "west", QPS: 50, Burst: 80},
+		// The context of defaults is not inherited, the entry selects its own
+		{Kubeconfig: "/etc/autoscaler/kubeconfig", QPS: 50, Burst: 80},
+	}
+	clusters := Clusters(configured, defaults)
+	if len(clusters) != len(want) {
+		t.Fatalf("Clusters() returned %d clusters, want %d", len(clusters), len(want))
+	}
+	for i, c := range clusters {
+		if c.Name != configured[i].Name || c.Config != configured[i] {
+			t.Errorf("cluster %d = %q with %+v, want %q with its configuration", i, c.Name, c.Config, configured[i].Name)
+		}
+		if c.Options != want[i] {
+			t.Errorf("cluster %s options = %+v, want %+v", c.Name, c.Options, want[i])
+		}
+	}
+}
+
+// writeKubeconfig writes a kubeconfig with one context per server.
+func writeKubeconfig(t *testing.T, servers map[string]string) string {
+	t.Helper()
+	data := "apiVersion: v1\nkind: Config\nclusters:\n"
+	for name, server := range servers {
+		data += fmt.Sprintf("- name: %s\n  cluster:\n    server: %s\n", name, server)
+	}
+	data += "users:\n- name: autoscaler\n  user:\n    token: secret\ncontexts:\n"
+	for name := range servers {
+		data += fmt.Sprintf("- name: %s\n  context:\n    cluster: %s\n    user: autoscaler\n", name, name)
+	}
+	path := filepath.Join(t.TempDir(), "kubeconfig")
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestConnectWithRetryUnreachableCluster(t *testing.T) {
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/version" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"major": "1", "minor": "28", "gitVersion": "v1.28.0"}`)
+	}))
+	defer up.Close()
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	kubeconfig := writeKubeconfig(t, map[string]string{"up": up.URL, "down": down.URL})
+	clusters := Clusters([]config.ClusterConfig{{Name: "down", Context: "down"}, {Name: "up", Context: "up"}}, Options{Kubeconfig: kubeconfig})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errs := map[string]chan error{}
+	for _, cluster := range clusters {
+		done := make(chan error, 1)
+		errs[cluster.Name] = done
+		go func(cluster Cluster) {
+			_, _, err := ConnectWithRetry(ctx, cluster)
+			done <- err
+		}(cluster)
+	}
+
+	select {
+	case err := <-errs["up"]:
+		if err != nil {
+			t.Fatalf("ConnectWithRetry() to the reachable cluster error = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the unreachable cluster blocked the connection to the reachable one")
+	}
+	select {
+	case err := <-errs["down"]:
+		t.Fatalf("ConnectWithRetry() to the unreachable cluster returned %v before it was cancelled", err)
+	default:
+	}
+
+	cancel()
+	select {
+	case err := <-errs["down"]:
+		if err != context.Canceled {
+			t.Errorf("ConnectWithRetry() to the unreachable cluster error = %v, want %v", err, context.Canceled)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("ConnectWithRetry() kept retrying after the context was cancelled")
+	}
+}
@@ -1,30 +1,93 @@
 package connection
 
 import (
+	"fmt"
+
 	"k8s-resource-autoscaler/pkg/log"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
-	"os"
 )
 
-// ConnectToCluster connects to the Kubernetes cluster using the kubeconfig file
-func ConnectToCluster() *kubernetes.Clientset {
-	kubeconfig := os.Getenv("KUBECONFIG")
-	if kubeconfig == "" {
-		kubeconfig = clientcmd.RecommendedHomeFile
+// Default client-side rate limits. The client-go defaults of 5 QPS and a
+// burst of 10 are too low for the initial informer lists on large clusters.
+const (
+	DefaultQPS   = 20
+	DefaultBurst = 30
+)
+
+// inClusterConfig loads the in-cluster service account configuration. It is
+// replaced in tests, which do not run in a pod.
+var inClusterConfig = rest.InClusterConfig
+
+// Options selects and tunes the connection to the API server.
+type Options struct {
+	// Kubeconfig is the path of a kubeconfig file. When it and Context are
+	// empty, the in-cluster service account is tried first.
+	Kubeconfig string
+	// Context is the kubeconfig context to use instead of the current one.
+	Context string
+	// QPS and Burst limit the requests sent to the API server.
+	QPS   float32
+	Burst int
+}
+
+// BuildConfig builds the REST config. Without an explicit kubeconfig or
+// context it uses the in-cluster service account when running in a pod and
+// falls back to $KUBECONFIG or ~/.kube/config otherwise.
+func BuildConfig(opts Options) (*rest.Config, error) {
+	var config *rest.Config
+	var err error
+
+	if opts.Kubeconfig == "" && opts.Context == "" {
+		config, err = inClusterConfig()
+		if err == nil {
+			log.Info("Using in-cluster service account configuration.")
+		} else if err != rest.ErrNotInCluster {
+			return nil, fmt.Errorf("error loading in-cluster configuration: %v", err)
+		}
 	}
 
-	config, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
-	if err != nil {
-		log.Error("Error building kubeconfig: %v", err)
-		return nil
+	if config == nil {
+		rules := clientcmd.NewDefaultClientConfigLoadingRules()
+		rules.ExplicitPath = opts.Kubeconfig
+		overrides := &clientcmd.ConfigOverrides{CurrentContext: opts.Context}
+		config, err = clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, overrides).ClientConfig()
+		if err != nil {
+			return nil, fmt.Errorf("error loading kubeconfig: %v", err)
+		}
 	}
 
+	config.QPS = opts.QPS
+	if config.QPS <= 0 {
+		config.QPS = DefaultQPS
+	}
+	config.Burst = opts.Burst
+	if config.Burst <= 0 {
+		config.Burst = DefaultBurst
+	}
+	return config, nil
+}
+
+// ConnectToCluster creates a clientset for the config and checks that the
+// API server is reachable and accepts the credentials.
+func ConnectToCluster(config *rest.Config) (*kubernetes.Clientset, error) {
 	clientset, err := kubernetes.NewForConfig(config)
 	if err != nil {
-		log.Error("Error creating Kubernetes clientset: %v", err)
-		return nil
+		return nil, fmt.Errorf("error creating Kubernetes clientset: %v", err)
 	}
 
-	return clientset
+	version, err := clientset.Discovery().ServerVersion()
+	if err != nil {
+		switch {
+		case apierrors.IsUnauthorized(err):
+			return nil, fmt.Errorf("the API server at %s rejected the credentials: %v", config.Host, err)
+		case apierrors.IsForbidden(err):
+			return nil, fmt.Errorf("the API server at %s denied access to the discovery API: %v", config.Host, err)
+		}
+		return nil, fmt.Errorf("cannot reach the API server at %s: %v", config.Host, err)
+	}
+	log.Info("Connected to Kubernetes %s at %s", version.GitVersion, config.Host)
+	return clientset, nil
 }
@@ -0,0 +1,149 @@
+package connection
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"k8s.io/client-go/rest"
+)
+
+// stubInCluster replaces the in-cluster configuration for the test and
+// returns a pointer to the number of times it was loaded.
+func stubInCluster(t *testing.T, config *rest.Config, err error) *int {
+	t.Helper()
+	calls := 0
+	saved := inClusterConfig
+	inClusterConfig = func() (*rest.Config, error) {
+		calls++
+		if err != nil {
+			return nil, err
+		}
+		copied := *config
+		return &copied, nil
+	}
+	t.Cleanup(func() { inClusterConfig = saved })
+	return &calls
+}
+
+func TestBuildConfig(t *testing.T) {
+	inCluster := &rest.Config{Host: "https://10.96.0.1:443"}
+	kubeconfig := writeKubeconfig(t, map[string]string{"east": "https://east.example.com", "west": "https://west.example.com"})
+	current, err := os.OpenFile(kubeconfig, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := current.WriteString("current-context: east\n"); err != nil {
+		t.Fatal(err)
+	}
+	current.Close()
+	t.Setenv("KUBECONFIG", kubeconfig)
+
+	tests := []struct {
+		name         string
+		opts         Options
+		inClusterErr error
+		wantHost     string
+		wantErr      string
+		wantLoaded   int
+		wantQPS      float32
+		wantBurst    int
+	}{
+		{
+			name:       "in-cluster takes precedence over $KUBECONFIG",
+			wantHost:   "https://10.96.0.1:443",
+			wantLoaded: 1,
+			wantQPS:    DefaultQPS,
+			wantBurst:  DefaultBurst,
+		},
+		{
+			name:      "context skips in-cluster",
+			opts:      Options{Context: "west"},
+			wantHost:  "https://west.example.com",
+			wantQPS:   DefaultQPS,
+			wantBurst: DefaultBurst,
+		},
+		{
+			name:      "kubeconfig skips in-cluster",
+			opts:      Options{Kubeconfig: kubeconfig, Context: "east", QPS: 50, Burst: 80},
+			wantHost:  "https://east.example.com",
+			wantQPS:   50,
+			wantBurst: 80,
+		},
+		{
+			name:         "outside a pod falls back to $KUBECONFIG",
+			opts:         Options{QPS: 5},
+			inClusterErr: rest.ErrNotInCluster,
+			wantHost:     "https://east.example.com",
+			wantLoaded:   1,
+			wantQPS:      5,
+			wantBurst:    DefaultBurst,
+		},
+		{
+			name:         "broken in-cluster configuration",
+			inClusterErr: errors.New("token file is empty"),
+			wantErr:      "error loading in-cluster configuration: token file is empty",
+			wantLoaded:   1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loaded := stubInCluster(t, inCluster, tt.inClusterErr)
+			config, err := BuildConfig(tt.opts)
+			if *loaded != tt.wantLoaded {
+				t.Errorf("in-cluster configuration loaded %d times, want %d", *loaded, tt.wantLoaded)
+			}
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("BuildConfig() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("BuildConfig() error = %v", err)
+			}
+			if config.Host != tt.wantHost {
+				t.Errorf("host = %q, want %q", config.Host, tt.wantHost)
+			}
+			if config.QPS != tt.wantQPS || config.Burst != tt.wantBurst {
+				t.Errorf("QPS and burst = %v and %d, want %v and %d", config.QPS, config.Burst, tt.wantQPS, tt.wantBurst)
+			}
+		})
+	}
+}
+
+func TestConnectToClusterErrors(t *testing.T) {
+	status := func(code int) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(code)
+		}))
+	}
+	unauthorized := status(http.StatusUnauthorized)
+	defer unauthorized.Close()
+	forbidden := status(http.StatusForbidden)
+	defer forbidden.Close()
+	unreachable := httptest.NewServer(http.NotFoundHandler())
+	unreachable.Close()
+
+	tests := []struct {
+		name    string
+		host    string
+		wantErr string
+	}{
+		{name: "unauthorized", host: unauthorized.URL, wantErr: fmt.Sprintf("the API server at %s rejected the credentials", unauthorized.URL)},
+		{name: "forbidden", host: forbidden.URL, wantErr: fmt.Sprintf("the API server at %s denied access to the discovery API", forbidden.URL)},
+		{name: "unreachable", host: unreachable.URL, wantErr: fmt.Sprintf("cannot reach the API server at %s", unreachable.URL)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ConnectToCluster(&rest.Config{Host: tt.host})
+			if err == nil || !strings.HasPrefix(err.Error(), tt.wantErr) {
+				t.Errorf("ConnectToCluster() error = %v, want one starting with %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,779 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s-resource-autoscaler/config"
+	"k8s-resource-autoscaler/pkg/client"
+	"k8s-resource-autoscaler/pkg/kubernetes/annotations"
+	"k8s-resource-autoscaler/pkg/kubernetes/deployment"
+	"k8s-resource-autoscaler/pkg/kubernetes/events"
+	"k8s-resource-autoscaler/pkg/kubernetes/metrics"
+	"k8s-resource-autoscaler/pkg/kubernetes/pvc"
+	"k8s-resource-autoscaler/pkg/log"
+	"k8s-resource-autoscaler/pkg/plan"
+	"k8s-resource-autoscaler/pkg/telemetry"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	appslisters "k8s.io/client-go/listers/apps/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// Options selects which reconcile handlers the controller runs.
+type Options struct {
+	PVC     bool
+	Ingress bool
+	Workers int
+
+	// Cluster names the cluster the controller manages. When set it labels
+	// the logs, events and plans of the controller.
+	Cluster string
+
+	// DryRun records the planned changes instead of applying them.
+	DryRun bool
+	// PlanOutput is the format ("table" or "json") the plan of each cycle is
+	// written in when DryRun is set.
+	PlanOutput string
+}
+
+// Controller watches Deployments, StatefulSets, Pods, PVCs and
+// AutoscalerPolicies through shared informers and reconciles the managed
+// workloads from a rate-limited workqueue. A workload is managed when an
+// AutoscalerPolicy targets it or, as a fallback, when it carries the
+// autoscaler annotation.
+type Controller struct {
+	clientset kubernetes.Interface
+	policies  client.Interface
+	metrics   metrics.MetricsSource
+	config    *config.AutoscalerConfig
+	options   Options
+	log       *log.Logger
+
+	informerFactory   informers.SharedInformerFactory
+	deploymentLister  appslisters.DeploymentLister
+	statefulSetLister appslisters.StatefulSetLister
+	podLister         corelisters.PodLister
+	pvcLister         corelisters.PersistentVolumeClaimLister
+	policyInformer    cache.SharedIndexInformer
+	cacheSynced       []cache.InformerSynced
+
+	queue        workqueue.RateLimitingInterface
+	recorder     record.EventRecorder
+	stopRecorder func()
+
+	mu         sync.Mutex
+	pending    *pendingConfig
+	cycle      *cycle
+	plan       *plan.Plan
+	snapshot   *metrics.Snapshot
+	lastAction map[string]time.Time
+	// resizes holds the PVC resizes whose completion has not been observed
+	// yet, keyed by namespace/name of the PVC.
+	resizes map[string]pendingResize
+	// reported holds the invalid settings last reported as Events for each
+	// object, so that they are not sent again on every reconcile.
+	reported map[string]string
+	// forecasts holds the used bytes of the PVCs forecast within the last
+	// lookback, keyed by namespace/name, so that they are not fetched with a
+	// range query every cycle.
+	forecasts map[string]forecastSamples
+	// inodeHigh holds the PVCs, keyed by namespace/name, whose inode usage
+	// was last seen above their threshold, so that it is reported once.
+	inodeHigh map[string]struct{}
+	// history holds the scaling recommendations and events of every
+	// Deployment. It is loaded once before the first cycle.
+	history       *deployment.HistoryStore
+	historyLoaded bool
+	// lastSuccess is when the last cycle completed successfully.
+	lastSuccess time.Time
+	// cycleID numbers the cycles and is logged with every reconcile.
+	cycleID uint64
+}
+
+// pendingConfig is a reloaded configuration waiting for the next cycle.
+type pendingConfig struct {
+	config *config.AutoscalerConfig
+	source metrics.MetricsSource
+}
+
+// pendingResize is a PVC resize of a workload that is waited for without
+// blocking a worker. The workload is reconciled again when the PVC changes
+// and at the deadline.
+type pendingResize struct {
+	key      string
+	size     resource.Quantity
+	deadline time.Time
+}
+
+// forecastSamples are the used bytes of a PVC, from a range query at
+// fetched and the snapshots since.
+type forecastSamples struct {
+	fetched time.Time
+	samples []pvc.Sample
+}
+
+// cycle tracks the keys that still have to be reconciled before a full pass
+// over all annotated workloads is complete.
+type cycle struct {
+	pending map[string]struct{}
+	// started holds the pending keys dequeued after the cycle was published.
+	// Only their reconciles count for the cycle: one already running for an
+	// informer event may have read the state from before the cycle started.
+	started map[string]struct{}
+	done    chan struct{}
+}
+
+// NewController creates a controller and registers its informer event handlers.
+// policies may be nil when the AutoscalerPolicy CRD is not installed, in which
+// case only annotated Deployments are managed. Disk and network usage are read
+// from source.
+func NewController(clientset kubernetes.Interface, policies client.Interface, source metrics.MetricsSource, cfg *config.AutoscalerConfig, options Options) *Controller {
+	if options.Workers <= 0 {
+		options.Workers = 1
+	}
+
+	factory := informers.NewSharedInformerFactory(clientset, 0)
+	deploymentInformer := factory.Apps().V1().Deployments()
+	statefulSetInformer := factory.Apps().V1().StatefulSets()
+	podInformer := factory.Core().V1().Pods()
+	pvcInformer := factory.Core().V1().PersistentVolumeClaims()
+
+	c := &Controller{
+		clientset:         clientset,
+		policies:          policies,
+		metrics:           source,
+		config:            cfg,
+		options:           options,
+		log:               log.With("cluster", options.Cluster),
+		informerFactory:   factory,
+		deploymentLister:  deploymentInformer.Lister(),
+		statefulSetLister: statefulSetInformer.Lister(),
+		podLister:         podInformer.Lister(),
+		pvcLister:         pvcInformer.Lister(),
+		cacheSynced: []cache.InformerSynced{
+			deploymentInformer.Informer().HasSynced,
+			statefulSetInformer.Informer().HasSynced,
+			podInformer.Informer().HasSynced,
+			pvcInformer.Informer().HasSynced,
+		},
+		queue:      workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "autoscaler"),
+		lastAction: map[string]time.Time{},
+		resizes:    map[string]pendingResize{},
+		reported:   map[string]string{},
+		forecasts:  map[string]forecastSamples{},
+		inodeHigh:  map[string]struct{}{},
+		history:    deployment.NewHistoryStore(clientset, cfg.NetworkScaling.History.Namespace, cfg.NetworkScaling.History.ConfigMap),
+	}
+	c.recorder, c.stopRecorder = events.NewRecorder(clientset, options.Cluster)
+
+	workloadHandler := cache.ResourceEventHandlerFuncs{
+		AddFunc:    c.enqueueWorkload,
+		UpdateFunc: c.handleWorkloadUpdate,
+	}
+	deploymentInformer.Informer().AddEventHandler(workloadHandler)
+	statefulSetInformer.Informer().AddEventHandler(workloadHandler)
+	podInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    c.handlePod,
+		DeleteFunc: c.handlePod,
+	})
+	pvcInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    c.handlePVC,
+		UpdateFunc: func(_, obj interface{}) { c.handlePVC(obj) },
+	})
+
+	if policies != nil {
+		c.policyInformer = client.NewAutoscalerPolicyInformer(policies, 0, cache.Indexers{targetIndex: targetKeys})
+		c.policyInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc:    c.handlePolicy,
+			UpdateFunc: c.handlePolicyUpdate,
+			DeleteFunc: c.handlePolicyDelete,
+		})
+		c.cacheSynced = append(c.cacheSynced, c.policyInformer.HasSynced)
+	}
+
+	return c
+}
+
+// Start starts the informers and waits for their caches to sync.
+func (c *Controller) Start(ctx context.Context) error {
+	c.informerFactory.Start(ctx.Done())
+	if c.policyInformer != nil {
+		go c.policyInformer.Run(ctx.Done())
+	}
+	c.log.Info("Waiting for informer caches to sync...")
+	if !cache.WaitForCacheSync(ctx.Done(), c.cacheSynced...) {
+		return fmt.Errorf("timed out waiting for informer caches to sync")
+	}
+	c.log.Info("Informer caches synced.")
+	return nil
+}
+
+// Run starts the workers and enqueues every managed workload once per
+// configured interval until the context is cancelled. Start must have been
+// called first.
+func (c *Controller) Run(ctx context.Context) {
+	defer utilruntime.HandleCrash()
+	defer c.queue.ShutDown()
+	defer c.stopRecorder()
+
+	c.StartWorkers(ctx)
+
+	for {
+		c.log.Info("Starting new monitoring cycle...")
+		p, err := c.RunCycle(ctx)
+		if err != nil {
+			c.log.Error("Monitoring cycle did not complete: %v", err)
+		} else if c.options.DryRun {
+			if err := p.Write(os.Stdout, c.options.PlanOutput); err != nil {
+				c.log.Error("Error writing plan: %v", err)
+			}
+		}
+
+		// The interval is read every cycle so a reloaded value applies
+		interval := time.Duration(c.currentConfig().Interval) * time.Minute
+		if err == nil {
+			c.log.Info("Monitoring cycle complete. Waiting for %s before the next cycle.", interval)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// UpdateConfig hands the controller a reloaded configuration and the metrics
+// source built from it. They are swapped in at the start of the next cycle.
+func (c *Controller) UpdateConfig(cfg *config.AutoscalerConfig, source metrics.MetricsSource) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pending = &pendingConfig{config: cfg, source: source}
+}
+
+// applyPendingConfig swaps in the configuration passed to UpdateConfig.
+func (c *Controller) applyPendingConfig() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.pending == nil {
+		return
+	}
+	c.config = c.pending.config
+	c.metrics = c.pending.source
+	c.snapshot = nil
+	c.pending = nil
+	c.log.Info("Applied the reloaded configuration.")
+}
+
+// currentCycle returns the ID of the running or last cycle.
+func (c *Controller) currentCycle() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.cycleID
+}
+
+// currentConfig returns the configuration in effect.
+func (c *Controller) currentConfig() *config.AutoscalerConfig {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.config
+}
+
+// StartWorkers launches the configured number of queue workers.
+func (c *Controller) StartWorkers(ctx context.Context) {
+	for i := 0; i < c.options.Workers; i++ {
+		go wait.UntilWithContext(ctx, c.runWorker, time.Second)
+	}
+}
+
+// RunCycle enqueues every managed workload and blocks until each of them
+// has been reconciled once. It returns the actions planned during the cycle,
+// which are only populated in dry-run mode.
+func (c *Controller) RunCycle(ctx context.Context) (*plan.Plan, error) {
+	start := time.Now()
+	p, err := c.runCycle(ctx)
+	if !c.options.DryRun {
+		c.saveHistory(ctx)
+	}
+	telemetry.CycleDuration.WithLabelValues(c.options.Cluster).Observe(time.Since(start).Seconds())
+	if err != nil {
+		telemetry.CyclesTotal.WithLabelValues(c.options.Cluster, telemetry.ResultFailure).Inc()
+		return p, err
+	}
+	telemetry.CyclesTotal.WithLabelValues(c.options.Cluster, telemetry.ResultSuccess).Inc()
+
+	now := time.Now()
+	telemetry.LastSuccessfulCycle.WithLabelValues(c.options.Cluster).Set(float64(now.Unix()))
+	c.mu.Lock()
+	c.lastSuccess = now
+	c.mu.Unlock()
+	return p, nil
+}
+
+// LastSuccessfulCycle returns when the last cycle completed successfully,
+// or the zero time when none has yet.
+func (c *Controller) LastSuccessfulCycle() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lastSuccess
+}
+
+func (c *Controller) runCycle(ctx context.Context) (*plan.Plan, error) {
+	c.applyPendingConfig()
+	c.loadHistory(ctx)
+
+	c.mu.Lock()
+	c.cycleID++
+	c.mu.Unlock()
+
+	workloads, err := c.listWorkloads(metav1.NamespaceAll)
+	if err != nil {
+		return nil, err
+	}
+
+	p := plan.New()
+	p.Cluster = c.options.Cluster
+	c.mu.Lock()
+	c.plan = p
+	c.mu.Unlock()
+
+	c.refreshSnapshot(ctx)
+	c.pruneForecasts(time.Now())
+
+	cyc := &cycle{pending: map[string]struct{}{}, started: map[string]struct{}{}, done: make(chan struct{})}
+	for _, w := range workloads {
+		if c.isManaged(w) {
+			cyc.pending[w.key] = struct{}{}
+		}
+	}
+	telemetry.WorkloadsDiscovered.WithLabelValues(c.options.Cluster).Set(float64(len(cyc.pending)))
+	c.history.Retain(cyc.pending)
+
+	if len(cyc.pending) == 0 {
+		c.log.Warning("No workloads with an AutoscalerPolicy or the specified annotation found.")
+		return p, nil
+	}
+	c.log.Info("Found %d managed workloads.", len(cyc.pending))
+
+	// The workers remove keys from the cycle once it is published
+	keys := make([]string, 0, len(cyc.pending))
+	for key := range cyc.pending {
+		keys = append(keys, key)
+	}
+	c.mu.Lock()
+	c.cycle = cyc
+	c.mu.Unlock()
+	for _, key := range keys {
+		c.queue.Add(key)
+	}
+
+	select {
+	case <-cyc.done:
+		return p, nil
+	case <-ctx.Done():
+		return p, ctx.Err()
+	}
+}
+
+// refreshSnapshot fetches the metrics of all objects in bulk when the source
+// supports it, so the reconciles of a cycle issue no per-object queries.
+func (c *Controller) refreshSnapshot(ctx context.Context) {
+	c.mu.Lock()
+	source := c.metrics
+	c.mu.Unlock()
+
+	snapshotter, ok := source.(metrics.Snapshotter)
+	if !ok {
+		return
+	}
+	start := time.Now()
+	snapshot, err := snapshotter.Snapshot(ctx)
+	if err != nil {
+		c.log.Warning("Error fetching metrics snapshot, querying per object: %v", err)
+		snapshot = nil
+	} else {
+		pvcs, pods := snapshot.Len()
+		c.log.Info("Fetched metrics of %d PVCs and %d pods in %s.", pvcs, pods, time.Since(start).Round(time.Millisecond))
+	}
+	c.mu.Lock()
+	c.snapshot = snapshot
+	c.mu.Unlock()
+}
+
+// pruneForecasts drops the used bytes fetched a lookback or more before now,
+// which would be fetched again on their next use, so PVCs that are no
+// longer forecast are forgotten.
+func (c *Controller) pruneForecasts(now time.Time) {
+	lookback := c.currentConfig().PVCGrowth.Forecast.Lookback
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for pvcKey, cached := range c.forecasts {
+		if now.Sub(cached.fetched) >= lookback {
+			delete(c.forecasts, pvcKey)
+		}
+	}
+}
+
+// metricsSource returns the snapshot of the current cycle, or the live
+// source when there is none. Reconciles triggered between cycles reuse the
+// last snapshot, except for the objects acted on since it was taken.
+func (c *Controller) metricsSource() metrics.MetricsSource {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.snapshot != nil {
+		return c.snapshot
+	}
+	return c.metrics
+}
+
+// forgetPVC drops a resized PVC from the snapshot, so the reconciles until
+// the next cycle query its usage after the resize instead of before it.
+func (c *Controller) forgetPVC(namespace, pvcName string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.snapshot != nil {
+		c.snapshot.ForgetPVC(namespace, pvcName)
+	}
+}
+
+// planAction adds an action found while reconciling key to the plan of the
+// running cycle. Reconciles outside a cycle, e.g. triggered by informer
+// events after the plan was written, only log what they would do.
+func (c *Controller) planAction(key string, action plan.Action) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.plan == nil || !c.startedInCycle(key) {
+		return
+	}
+	c.plan.Add(action)
+}
+
+// inCycle reports whether key is reconciled as part of the running cycle,
+// rather than for an informer event.
+func (c *Controller) inCycle(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.startedInCycle(key)
+}
+
+// startedInCycle reports whether the running reconcile of key was dequeued
+// after the running cycle was published. c.mu must be held.
+func (c *Controller) startedInCycle(key string) bool {
+	if c.cycle == nil {
+		return false
+	}
+	_, ok := c.cycle.started[key]
+	return ok
+}
+
+// inCooldown reports whether an action of the given kind was taken on the
+// workload less than cooldown ago.
+func (c *Controller) inCooldown(key, kind string, cooldown time.Duration) bool {
+	if cooldown <= 0 {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	last, ok := c.lastAction[key+"/"+kind]
+	return ok && time.Since(last) < cooldown
+}
+
+// actedSinceSnapshot reports whether an action of the given kind was taken
+// on the workload after the snapshot was fetched, so the snapshot describes
+// the workload as it was before.
+func (c *Controller) actedSinceSnapshot(key, kind string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.snapshot == nil {
+		return false
+	}
+	last, ok := c.lastAction[key+"/"+kind]
+	return ok && last.After(c.snapshot.Time)
+}
+
+// recordAction remembers when an action of the given kind was taken.
+func (c *Controller) recordAction(key, kind string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lastAction[key+"/"+kind] = time.Now()
+}
+
+// trackResize remembers a resize of a PVC of the workload with the given
+// key and reconciles the workload again at the deadline, in case the PVC is
+// not updated before.
+func (c *Controller) trackResize(key, namespace, pvcName string, size resource.Quantity, timeout time.Duration) {
+	c.mu.Lock()
+	c.resizes[namespace+"/"+pvcName] = pendingResize{key: key, size: size, deadline: time.Now().Add(timeout)}
+	c.mu.Unlock()
+	c.queue.AddAfter(key, timeout)
+}
+
+// pendingResizeOf returns the tracked resize of a PVC.
+func (c *Controller) pendingResizeOf(namespace, pvcName string) (pendingResize, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	r, ok := c.resizes[namespace+"/"+pvcName]
+	return r, ok
+}
+
+// forgetResize stops tracking the resize of a PVC.
+func (c *Controller) forgetResize(namespace, pvcName string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.resizes, namespace+"/"+pvcName)
+}
+
+// forgetResizes stops tracking the resizes of a deleted workload.
+func (c *Controller) forgetResizes(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for pvcKey, r := range c.resizes {
+		if r.key == key {
+			delete(c.resizes, pvcKey)
+		}
+	}
+}
+
+// newProblems reports whether errs differ from the problems last reported
+// for the object with the given key, and remembers them. version identifies
+// the object, e.g. its UID, so that a recreated object is reported again.
+// No errors forget the object, so that problems coming back are reported
+// again too.
+func (c *Controller) newProblems(key, version string, errs []error) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(errs) == 0 {
+		delete(c.reported, key)
+		return false
+	}
+	messages := make([]string, 0, len(errs)+1)
+	messages = append(messages, version)
+	for _, err := range errs {
+		messages = append(messages, err.Error())
+	}
+	problems := strings.Join(messages, "\n")
+	if c.reported[key] == problems {
+		return false
+	}
+	c.reported[key] = problems
+	return true
+}
+
+// inodeStateChanged reports whether the inode usage of a PVC crossed its
+// threshold since the last call, and remembers whether it is above.
+func (c *Controller) inodeStateChanged(namespace, pvcName string, high bool) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	pvcKey := namespace + "/" + pvcName
+	_, wasHigh := c.inodeHigh[pvcKey]
+	if high {
+		c.inodeHigh[pvcKey] = struct{}{}
+	} else {
+		delete(c.inodeHigh, pvcKey)
+	}
+	return high != wasHigh
+}
+
+// loadHistory loads the persisted scaling history before the first cycle.
+// A failed load is retried on the next cycle.
+func (c *Controller) loadHistory(ctx context.Context) {
+	c.mu.Lock()
+	loaded := c.historyLoaded
+	c.mu.Unlock()
+	if loaded {
+		return
+	}
+	if err := c.history.Load(ctx); err != nil {
+		c.log.Warning("%v", err)
+		return
+	}
+	c.mu.Lock()
+	c.historyLoaded = true
+	c.mu.Unlock()
+}
+
+// saveHistory persists the scaling history once it has been loaded, so a
+// failed load never overwrites it.
+func (c *Controller) saveHistory(ctx context.Context) {
+	c.mu.Lock()
+	loaded := c.historyLoaded
+	c.mu.Unlock()
+	if !loaded {
+		return
+	}
+	if err := c.history.Save(ctx); err != nil {
+		c.log.Warning("%v", err)
+	}
+}
+
+// startKey stamps a dequeued key with the running cycle if the cycle still
+// has to reconcile it.
+func (c *Controller) startKey(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.cycle == nil {
+		return
+	}
+	if _, ok := c.cycle.pending[key]; ok {
+		c.cycle.started[key] = struct{}{}
+	}
+}
+
+// finishKey marks a key as reconciled for the current cycle. A reconcile
+// that was dequeued before the cycle was published leaves the key pending;
+// the workqueue hands the key out again once it is done.
+func (c *Controller) finishKey(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.startedInCycle(key) {
+		return
+	}
+	delete(c.cycle.started, key)
+	delete(c.cycle.pending, key)
+	if len(c.cycle.pending) == 0 {
+		close(c.cycle.done)
+		c.cycle = nil
+	}
+}
+
+func (c *Controller) runWorker(ctx context.Context) {
+	for c.processNextItem(ctx) {
+	}
+}
+
+func (c *Controller) processNextItem(ctx context.Context) bool {
+	item, shutdown := c.queue.Get()
+	if shutdown {
+		return false
+	}
+	defer c.queue.Done(item)
+
+	key := item.(string)
+	c.startKey(key)
+	defer c.finishKey(key)
+
+	if err := c.reconcile(ctx, key); err != nil {
+		c.log.With("cycle", c.currentCycle()).Error("Error reconciling %s: %v", key, err)
+		c.queue.AddRateLimited(key)
+		return true
+	}
+	c.queue.Forget(key)
+	return true
+}
+
+// everything matches all labels.
+var everything = labels.Everything()
+
+// isManaged reports whether the workload is targeted by an AutoscalerPolicy
+// or carries the autoscaler annotation.
+func (c *Controller) isManaged(w *workload) bool {
+	return annotations.IsEnabled(w.meta) || c.hasPolicy(w.key)
+}
+
+// enqueueWorkload adds a managed Deployment or StatefulSet to the workqueue.
+func (c *Controller) enqueueWorkload(obj interface{}) {
+	if w := newWorkload(obj); w != nil && c.isManaged(w) {
+		c.queue.Add(w.key)
+	}
+}
+
+// handleWorkloadUpdate enqueues a managed Deployment or StatefulSet whose
+// spec or annotations changed. Status-only updates, such as the ones that
+// follow every scale, are ignored.
+func (c *Controller) handleWorkloadUpdate(oldObj, newObj interface{}) {
+	old, ok := oldObj.(metav1.Object)
+	if !ok {
+		return
+	}
+	updated, ok := newObj.(metav1.Object)
+	if !ok {
+		return
+	}
+	if old.GetGeneration() == updated.GetGeneration() && reflect.DeepEqual(old.GetAnnotations(), updated.GetAnnotations()) {
+		return
+	}
+	c.enqueueWorkload(newObj)
+}
+
+// handlePod enqueues the managed workload owning the pod.
+func (c *Controller) handlePod(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	pod, ok := obj.(*corev1.Pod)
+	if !ok {
+		return
+	}
+	kind, name := podOwner(pod)
+	if kind == "" {
+		return
+	}
+	w, err := c.getWorkload(kind, pod.Namespace, name)
+	if err != nil {
+		return
+	}
+	if c.isManaged(w) {
+		c.queue.Add(w.key)
+	}
+}
+
+// podOwner returns the kind and name of the Deployment or StatefulSet
+// owning the pod, or an empty kind when there is none. Deployments own their
+// pods through a ReplicaSet named after the Deployment and the
+// pod-template-hash label of its pods.
+func podOwner(pod *corev1.Pod) (kind, name string) {
+	owner := metav1.GetControllerOf(pod)
+	if owner == nil {
+		return "", ""
+	}
+	switch owner.Kind {
+	case annotations.KindStatefulSet:
+		return annotations.KindStatefulSet, owner.Name
+	case "ReplicaSet":
+		hash := pod.Labels[appsv1.DefaultDeploymentUniqueLabelKey]
+		if hash == "" || !strings.HasSuffix(owner.Name, "-"+hash) {
+			return "", ""
+		}
+		return annotations.KindDeployment, strings.TrimSuffix(owner.Name, "-"+hash)
+	}
+	return "", ""
+}
+
+// handlePVC enqueues the managed workloads that use the PVC.
+func (c *Controller) handlePVC(obj interface{}) {
+	claim, ok := obj.(*corev1.PersistentVolumeClaim)
+	if !ok {
+		return
+	}
+	workloads, err := c.listWorkloads(claim.Namespace)
+	if err != nil {
+		utilruntime.HandleError(err)
+		return
+	}
+	for _, w := range workloads {
+		if !c.isManaged(w) {
+			continue
+		}
+		for _, name := range w.result.PVCNames {
+			if name == claim.Name {
+				c.queue.Add(w.key)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,1308 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"k8s-resource-autoscaler/config"
+	"k8s-resource-autoscaler/pkg/apis/autoscaler/v1alpha1"
+	"k8s-resource-autoscaler/pkg/client"
+	"k8s-resource-autoscaler/pkg/kubernetes/deployment"
+	"k8s-resource-autoscaler/pkg/kubernetes/metrics"
+	"k8s-resource-autoscaler/pkg/log"
+	"k8s-resource-autoscaler/pkg/prometheus"
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/record"
+)
+
+// testConfig is the configuration the tests start from.
+const testConfig = `
+thresholds:
+  diskUsage:
+    resize: 80
+  networkUsage:
+    ingress:
+      scale: 100
+prometheus:
+  url: http://prometheus:9090
+  disk_usage_query: disk
+  network_usage_queries:
+    ingress: ingress
+`
+
+func newTestConfig(t testing.TB) *config.AutoscalerConfig {
+	t.Helper()
+	cfg, err := config.Parse([]byte(testConfig))
+	if err != nil {
+		t.Fatalf("error parsing test configuration: %v", err)
+	}
+	return cfg
+}
+
+// fakeSource serves usage from maps and counts the queries it answers.
+// Snapshots hold the usage at the time they are taken; later lookups of
+// objects missing from a snapshot see the live usage.
+type fakeSource struct {
+	mu     sync.Mutex
+	disk   map[string]float64
+	rx     map[string]float64
+	inodes map[string]float64
+	// bytes holds the used and total bytes of PVCs, ranges the used bytes
+	// returned by range queries.
+	bytes        map[string][2]float64
+	ranges       map[string][]prometheus.Point
+	snapshots    int
+	liveQueries  int
+	rangeQueries int
+}
+
+func newFakeSource() *fakeSource {
+	return &fakeSource{
+		disk:   map[string]float64{},
+		rx:     map[string]float64{},
+		inodes: map[string]float64{},
+		bytes:  map[string][2]float64{},
+		ranges: map[string][]prometheus.Point{},
+	}
+}
+
+func (f *fakeSource) setDisk(namespace, name string, percent float64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.disk[namespace+"/"+name] = percent
+}
+
+func (f *fakeSource) setInodes(namespace, name string, percent float64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.inodes[namespace+"/"+name] = percent
+}
+
+func (f *fakeSource) setBytes(namespace, name string, used, capacity float64, history ...prometheus.Point) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.bytes[namespace+"/"+name] = [2]float64{used, capacity}
+	f.ranges[namespace+"/"+name] = history
+}
+
+func (f *fakeSource) setRx(namespace, name string, rate float64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.rx[namespace+"/"+name] = rate
+}
+
+func (f *fakeSource) counts() (snapshots, liveQueries int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.snapshots, f.liveQueries
+}
+
+func (f *fakeSource) rangeCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.rangeQueries
+}
+
+func (f *fakeSource) DiskUsage(ctx context.Context, namespace, pvcName string) (float64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.liveQueries++
+	percent, ok := f.disk[namespace+"/"+pvcName]
+	if !ok {
+		return 0, fmt.Errorf("no disk usage for %s/%s", namespace, pvcName)
+	}
+	return percent, nil
+}
+
+func (f *fakeSource) NetworkUsage(ctx context.Context, namespace, podName string) (float64, float64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.liveQueries++
+	rx, ok := f.rx[namespace+"/"+podName]
+	if !ok {
+		return 0, 0, fmt.Errorf("no network usage for %s/%s", namespace, podName)
+	}
+	return rx, 0, nil
+}
+
+func (f *fakeSource) Query(ctx context.Context, name string, vars metrics.Vars) (float64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.liveQueries++
+	key := vars.Namespace + "/" + vars.PVC
+	switch name {
+	case metrics.QueryInodeUsage:
+		if percent, ok := f.inodes[key]; ok {
+			return percent, nil
+		}
+	case metrics.QueryDiskUsedBytes, metrics.QueryDiskCapacityBytes:
+		if bytes, ok := f.bytes[key]; ok && name == metrics.QueryDiskUsedBytes {
+			return bytes[0], nil
+		} else if ok {
+			return bytes[1], nil
+		}
+	}
+	return 0, fmt.Errorf("query %s is not supported", name)
+}
+
+func (f *fakeSource) QueryRange(ctx context.Context, name string, vars metrics.Vars, start, end time.Time, step time.Duration) ([]prometheus.Point, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.rangeQueries++
+	points, ok := f.ranges[vars.Namespace+"/"+vars.PVC]
+	if name != metrics.QueryDiskUsedBytes || !ok {
+		return nil, fmt.Errorf("no range of %s for %s/%s", name, vars.Namespace, vars.PVC)
+	}
+	return points, nil
+}
+
+func (f *fakeSource) Snapshot(ctx context.Context) (*metrics.Snapshot, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.snapshots++
+	snapshot := metrics.NewSnapshot(f)
+	for key, percent := range f.disk {
+		namespace, name := splitKey(key)
+		snapshot.SetDiskUsage(namespace, name, percent)
+	}
+	for key, percent := range f.inodes {
+		namespace, name := splitKey(key)
+		snapshot.SetInodeUsage(namespace, name, percent)
+	}
+	for key, bytes := range f.bytes {
+		namespace, name := splitKey(key)
+		snapshot.SetDiskBytes(namespace, name, bytes[0], bytes[1])
+	}
+	for key, rx := range f.rx {
+		namespace, name := splitKey(key)
+		snapshot.SetNetworkUsage(namespace, name, rx, 0)
+	}
+	return snapshot, nil
+}
+
+func splitKey(key string) (namespace, name string) {
+	parts := strings.SplitN(key, "/", 2)
+	return parts[0], parts[1]
+}
+
+// newTestController returns a controller over a fake clientset holding
+// objects, with its informer caches filled from them.
+func newTestController(t testing.TB, source metrics.MetricsSource, cfg *config.AutoscalerConfig, options Options, objects ...runtime.Object) (*Controller, *fake.Clientset) {
+	t.Helper()
+	return newPolicyController(t, nil, source, cfg, options, objects...)
+}
+
+// newPolicyController is newTestController with a client for
+// AutoscalerPolicies.
+func newPolicyController(t testing.TB, policies client.Interface, source metrics.MetricsSource, cfg *config.AutoscalerConfig, options Options, objects ...runtime.Object) (*Controller, *fake.Clientset) {
+	t.Helper()
+	clientset := fake.NewSimpleClientset(objects...)
+	c := NewController(clientset, policies, source, cfg, options)
+	t.Cleanup(c.stopRecorder)
+
+	factory := c.informerFactory
+	for _, obj := range objects {
+		var err error
+		switch obj.(type) {
+		case *appsv1.Deployment:
+			err = factory.Apps().V1().Deployments().Informer().GetIndexer().Add(obj)
+		case *appsv1.StatefulSet:
+			err = factory.Apps().V1().StatefulSets().Informer().GetIndexer().Add(obj)
+		case *corev1.Pod:
+			err = factory.Core().V1().Pods().Informer().GetIndexer().Add(obj)
+		case *corev1.PersistentVolumeClaim:
+			err = factory.Core().V1().PersistentVolumeClaims().Informer().GetIndexer().Add(obj)
+		}
+		if err != nil {
+			t.Fatalf("error adding %T to the informer cache: %v", obj, err)
+		}
+	}
+	return c, clientset
+}
+
+// updateCache replaces an object in the informer cache, as an Update event
+// would before the workload is enqueued again.
+func updateCache(t *testing.T, c *Controller, obj runtime.Object) {
+	t.Helper()
+	var err error
+	switch obj.(type) {
+	case *appsv1.Deployment:
+		err = c.informerFactory.Apps().V1().Deployments().Informer().GetIndexer().Update(obj)
+	case *corev1.PersistentVolumeClaim:
+		err = c.informerFactory.Core().V1().PersistentVolumeClaims().Informer().GetIndexer().Update(obj)
+	}
+	if err != nil {
+		t.Fatalf("error updating %T in the informer cache: %v", obj, err)
+	}
+}
+
+func annotatedDeployment(namespace, name string, replicas int32, claims ...string) *appsv1.Deployment {
+	d := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   namespace,
+			Name:        name,
+			Annotations: map[string]string{"autoscaler/enabled": "true"},
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": name}},
+		},
+	}
+	for _, claim := range claims {
+		d.Spec.Template.Spec.Volumes = append(d.Spec.Template.Spec.Volumes, corev1.Volume{
+			Name: claim,
+			VolumeSource: corev1.VolumeSource{
+				PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: claim},
+			},
+		})
+	}
+	return d
+}
+
+// expandableVolume returns a bound PVC of size, its volume and a StorageClass
+// allowing expansion.
+func expandableVolume(namespace, name, size string) []runtime.Object {
+	class := "standard"
+	allow := true
+	quantity := resource.MustParse(size)
+	storage := corev1.ResourceList{corev1.ResourceStorage: quantity}
+	return []runtime.Object{
+		&storagev1.StorageClass{ObjectMeta: metav1.ObjectMeta{Name: class}, AllowVolumeExpansion: &allow},
+		&corev1.PersistentVolume{
+			ObjectMeta: metav1.ObjectMeta{Name: "pv-" + name},
+			Spec:       corev1.PersistentVolumeSpec{Capacity: storage.DeepCopy()},
+		},
+		&corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+			Spec: corev1.PersistentVolumeClaimSpec{
+				StorageClassName: &class,
+				VolumeName:       "pv-" + name,
+				Resources:        corev1.VolumeResourceRequirements{Requests: storage.DeepCopy()},
+			},
+			Status: corev1.PersistentVolumeClaimStatus{Capacity: storage.DeepCopy()},
+		},
+	}
+}
+
+// expandOnUpdate makes the fake clientset expand the volume and filesystem
+// of a PVC as soon as its request grows, like a CSI driver with online
+// expansion.
+func expandOnUpdate(clientset *fake.Clientset) {
+	pvcs := corev1.SchemeGroupVersion.WithResource("persistentvolumeclaims")
+	pvs := corev1.SchemeGroupVersion.WithResource("persistentvolumes")
+	clientset.PrependReactor("update", "persistentvolumeclaims", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		update := action.(k8stesting.UpdateAction)
+		claim := update.GetObject().(*corev1.PersistentVolumeClaim).DeepCopy()
+		size := claim.Spec.Resources.Requests[corev1.ResourceStorage]
+		claim.Status.Capacity = corev1.ResourceList{corev1.ResourceStorage: size}
+		if err := clientset.Tracker().Update(pvcs, claim, claim.Namespace); err != nil {
+			return true, nil, err
+		}
+		obj, err := clientset.Tracker().Get(pvs, "", claim.Spec.VolumeName)
+		if err != nil {
+			return true, nil, err
+		}
+		pv := obj.(*corev1.PersistentVolume).DeepCopy()
+		pv.Spec.Capacity = corev1.ResourceList{corev1.ResourceStorage: size}
+		return true, claim, clientset.Tracker().Update(pvs, pv, "")
+	})
+}
+
+func getPVC(t *testing.T, clientset *fake.Clientset, namespace, name string) *corev1.PersistentVolumeClaim {
+	t.Helper()
+	claim, err := clientset.CoreV1().PersistentVolumeClaims(namespace).Get(context.Background(), name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("error getting PVC %s/%s: %v", namespace, name, err)
+	}
+	return claim
+}
+
+// TestReconcileAfterResizeIgnoresSnapshot reconciles a workload twice
+// against one snapshot, the second time as the PVC update triggered by the
+// resize would. The second reconcile must see the usage after the resize.
+func TestReconcileAfterResizeIgnoresSnapshot(t *testing.T) {
+	cfg := newTestConfig(t)
+	// Without a minimum interval only the fresh usage stops a second resize
+	cfg.PVCGrowth.MinInterval = 0
+
+	source := newFakeSource()
+	source.setDisk("shop", "data", 90)
+	objects := append(expandableVolume("shop", "data", "10Gi"), annotatedDeployment("shop", "db", 1, "data"))
+	c, clientset := newTestController(t, source, cfg, Options{PVC: true}, objects...)
+	expandOnUpdate(clientset)
+
+	ctx := context.Background()
+	key := workloadKey("Deployment", "shop", "db")
+	c.refreshSnapshot(ctx)
+	if err := c.reconcile(ctx, key); err != nil {
+		t.Fatalf("reconcile() error = %v", err)
+	}
+	claim := getPVC(t, clientset, "shop", "data")
+	if got := claim.Spec.Resources.Requests[corev1.ResourceStorage]; got.Cmp(resource.MustParse("15Gi")) != 0 {
+		t.Fatalf("PVC request after the first reconcile = %s, want 15Gi", got.String())
+	}
+
+	// The resized volume is less full; the snapshot still says 90%
+	source.setDisk("shop", "data", 60)
+	updateCache(t, c, claim)
+	if err := c.reconcile(ctx, key); err != nil {
+		t.Fatalf("reconcile() error = %v", err)
+	}
+	claim = getPVC(t, clientset, "shop", "data")
+	if got := claim.Spec.Resources.Requests[corev1.ResourceStorage]; got.Cmp(resource.MustParse("15Gi")) != 0 {
+		t.Errorf("PVC request after the second reconcile = %s, want it unchanged at 15Gi", got.String())
+	}
+	if snapshots, live := source.counts(); snapshots != 1 || live != 1 {
+		t.Errorf("source answered %d snapshots and %d live queries, want 1 snapshot and 1 live query for the resized PVC", snapshots, live)
+	}
+}
+
+// TestCycleQueriesAreConstant checks that a cycle fetches the usage of
+// every PVC with one snapshot, however many workloads there are.
+func TestCycleQueriesAreConstant(t *testing.T) {
+	for _, n := range []int{1, 10, 50} {
+		t.Run(fmt.Sprintf("%d workloads", n), func(t *testing.T) {
+			source := newFakeSource()
+			var objects []runtime.Object
+			var keys []string
+			for i := 0; i < n; i++ {
+				name := fmt.Sprintf("app-%d", i)
+				source.setDisk("shop", name, 50)
+				objects = append(objects, annotatedDeployment("shop", name, 1, name))
+				keys = append(keys, workloadKey("Deployment", "shop", name))
+			}
+			c, _ := newTestController(t, source, newTestConfig(t), Options{PVC: true}, objects...)
+
+			ctx := context.Background()
+			c.refreshSnapshot(ctx)
+			for _, key := range keys {
+				if err := c.reconcile(ctx, key); err != nil {
+					t.Fatalf("reconcile(%s) error = %v", key, err)
+				}
+			}
+			if snapshots, live := source.counts(); snapshots != 1 || live != 0 {
+				t.Errorf("source answered %d snapshots and %d live queries, want 1 snapshot and no live queries", snapshots, live)
+			}
+		})
+	}
+}
+
+// BenchmarkCycleQueries runs cycles over a growing number of workloads and
+// reports the metric queries issued per cycle, which stay flat.
+func BenchmarkCycleQueries(b *testing.B) {
+	for _, n := range []int{1, 10, 100, 1000} {
+		b.Run(fmt.Sprintf("%d workloads", n), func(b *testing.B) {
+			source := newFakeSource()
+			var objects []runtime.Object
+			var keys []string
+			for i := 0; i < n; i++ {
+				name := fmt.Sprintf("app-%d", i)
+				source.setDisk("shop", name, 50)
+				objects = append(objects, annotatedDeployment("shop", name, 1, name))
+				keys = append(keys, workloadKey("Deployment", "shop", name))
+			}
+			c, _ := newTestController(b, source, newTestConfig(b), Options{PVC: true}, objects...)
+			level := log.GetLevel()
+			log.SetLevel(log.LevelError)
+			b.Cleanup(func() { log.SetLevel(level) })
+
+			ctx := context.Background()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				c.refreshSnapshot(ctx)
+				for _, key := range keys {
+					if err := c.reconcile(ctx, key); err != nil {
+						b.Fatalf("reconcile(%s) error = %v", key, err)
+					}
+				}
+			}
+			b.StopTimer()
+			snapshots, live := source.counts()
+			b.ReportMetric(float64(snapshots+live)/float64(b.N), "queries/op")
+		})
+	}
+}
+
+func runningPod(namespace, name, app string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name, Labels: map[string]string{"app": app}},
+		Status:     corev1.PodStatus{Phase: corev1.PodRunning},
+	}
+}
+
+// serveScale makes the fake clientset serve the scale subresource of
+// deployments from their replica count.
+func serveScale(clientset *fake.Clientset) {
+	deployments := appsv1.SchemeGroupVersion.WithResource("deployments")
+	clientset.PrependReactor("get", "deployments", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		get := action.(k8stesting.GetAction)
+		if get.GetSubresource() != "scale" {
+			return false, nil, nil
+		}
+		obj, err := clientset.Tracker().Get(deployments, get.GetNamespace(), get.GetName())
+		if err != nil {
+			return true, nil, err
+		}
+		d := obj.(*appsv1.Deployment)
+		return true, &autoscalingv1.Scale{
+			ObjectMeta: metav1.ObjectMeta{Namespace: d.Namespace, Name: d.Name},
+			Spec:       autoscalingv1.ScaleSpec{Replicas: *d.Spec.Replicas},
+		}, nil
+	})
+	clientset.PrependReactor("update", "deployments", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		update := action.(k8stesting.UpdateAction)
+		if update.GetSubresource() != "scale" {
+			return false, nil, nil
+		}
+		scale := update.GetObject().(*autoscalingv1.Scale)
+		obj, err := clientset.Tracker().Get(deployments, update.GetNamespace(), scale.Name)
+		if err != nil {
+			return true, nil, err
+		}
+		d := obj.(*appsv1.Deployment).DeepCopy()
+		d.Spec.Replicas = &scale.Spec.Replicas
+		return true, scale, clientset.Tracker().Update(deployments, d, update.GetNamespace())
+	})
+}
+
+func getDeployment(t *testing.T, clientset *fake.Clientset, namespace, name string) *appsv1.Deployment {
+	t.Helper()
+	d, err := clientset.AppsV1().Deployments(namespace).Get(context.Background(), name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("error getting deployment %s/%s: %v", namespace, name, err)
+	}
+	return d
+}
+
+// TestReconcileAfterScaleWaitsForFreshMetrics reconciles a Deployment twice
+// against one snapshot, the second time as the Deployment update triggered
+// by the scale would. The snapshot rates were measured at the old replica
+// count, so the second reconcile must not scale again.
+func TestReconcileAfterScaleWaitsForFreshMetrics(t *testing.T) {
+	source := newFakeSource()
+	source.setRx("shop", "web-1", 400)
+	source.setRx("shop", "web-2", 400)
+	objects := []runtime.Object{
+		annotatedDeployment("shop", "web", 2),
+		runningPod("shop", "web-1", "web"),
+		runningPod("shop", "web-2", "web"),
+	}
+	c, clientset := newTestController(t, source, newTestConfig(t), Options{Ingress: true}, objects...)
+	serveScale(clientset)
+
+	ctx := context.Background()
+	key := workloadKey("Deployment", "shop", "web")
+	c.refreshSnapshot(ctx)
+	if err := c.reconcile(ctx, key); err != nil {
+		t.Fatalf("reconcile() error = %v", err)
+	}
+	d := getDeployment(t, clientset, "shop", "web")
+	if got := *d.Spec.Replicas; got != 8 {
+		t.Fatalf("replicas after the first reconcile = %d, want 8 for 4 times the target rate", got)
+	}
+
+	updateCache(t, c, d)
+	if err := c.reconcile(ctx, key); err != nil {
+		t.Fatalf("reconcile() error = %v", err)
+	}
+	if got := *getDeployment(t, clientset, "shop", "web").Spec.Replicas; got != 8 {
+		t.Errorf("replicas after the second reconcile = %d, want them unchanged at 8", got)
+	}
+
+	// The next cycle's snapshot is measured at the new replica count and
+	// acted on again
+	source.setRx("shop", "web-1", 200)
+	source.setRx("shop", "web-2", 200)
+	c.refreshSnapshot(ctx)
+	if err := c.reconcile(ctx, key); err != nil {
+		t.Fatalf("reconcile() error = %v", err)
+	}
+	if got := *getDeployment(t, clientset, "shop", "web").Spec.Replicas; got != 16 {
+		t.Errorf("replicas after the next cycle = %d, want 16 for twice the target rate", got)
+	}
+	if snapshots, live := source.counts(); snapshots != 2 || live != 0 {
+		t.Errorf("source answered %d snapshots and %d live queries, want 2 snapshots and no live queries", snapshots, live)
+	}
+}
+
+// TestDryRunPlanOnlyHoldsCycleActions checks that reconciles between dry-run
+// cycles do not add to the plan of a cycle that was already returned.
+func TestDryRunPlanOnlyHoldsCycleActions(t *testing.T) {
+	source := newFakeSource()
+	source.setRx("shop", "web-1", 400)
+	objects := []runtime.Object{
+		annotatedDeployment("shop", "web", 2),
+		runningPod("shop", "web-1", "web"),
+	}
+	c, clientset := newTestController(t, source, newTestConfig(t), Options{Ingress: true, DryRun: true}, objects...)
+	serveScale(clientset)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	defer c.queue.ShutDown()
+	c.StartWorkers(ctx)
+
+	for cycle := 1; cycle <= 2; cycle++ {
+		p, err := c.RunCycle(ctx)
+		if err != nil {
+			t.Fatalf("cycle %d: RunCycle() error = %v", cycle, err)
+		}
+		// An informer event between cycles reconciles the Deployment again
+		if err := c.reconcile(ctx, workloadKey("Deployment", "shop", "web")); err != nil {
+			t.Fatalf("cycle %d: reconcile() error = %v", cycle, err)
+		}
+		if len(p.Actions) != 1 || p.Actions[0].Proposed != "8" {
+			t.Errorf("cycle %d: plan = %+v, want one scale to 8 replicas", cycle, p.Actions)
+		}
+	}
+	if got := *getDeployment(t, clientset, "shop", "web").Spec.Replicas; got != 2 {
+		t.Errorf("replicas after dry-run cycles = %d, want them unchanged at 2", got)
+	}
+}
+
+// TestCycleIgnoresReconcilesStartedBefore checks that a reconcile dequeued
+// before a cycle was published does not complete the cycle's key.
+func TestCycleIgnoresReconcilesStartedBefore(t *testing.T) {
+	c, _ := newTestController(t, newFakeSource(), newTestConfig(t), Options{})
+	key := workloadKey("Deployment", "shop", "web")
+
+	// An informer event dequeues the key before the cycle is published
+	c.startKey(key)
+	cyc := &cycle{pending: map[string]struct{}{key: {}}, started: map[string]struct{}{}, done: make(chan struct{})}
+	c.mu.Lock()
+	c.cycle = cyc
+	c.mu.Unlock()
+
+	if c.inCycle(key) {
+		t.Error("inCycle() = true for a reconcile dequeued before the cycle")
+	}
+	c.finishKey(key)
+	select {
+	case <-cyc.done:
+		t.Fatal("the cycle completed on a reconcile dequeued before it was published")
+	default:
+	}
+
+	// The key is handed out again for the cycle
+	c.startKey(key)
+	if !c.inCycle(key) {
+		t.Error("inCycle() = false for a reconcile dequeued after the cycle was published")
+	}
+	c.finishKey(key)
+	select {
+	case <-cyc.done:
+	default:
+		t.Error("the cycle did not complete after its own reconcile of the key")
+	}
+}
+
+// TestWorkloadUpdateIgnoresStatus checks that only spec and annotation
+// changes of a workload enqueue it.
+func TestWorkloadUpdateIgnoresStatus(t *testing.T) {
+	old := annotatedDeployment("shop", "web", 2)
+	old.Generation = 1
+	statusOnly := old.DeepCopy()
+	statusOnly.Status.ReadyReplicas = 2
+	specChange := old.DeepCopy()
+	specChange.Generation = 2
+	annotationChange := old.DeepCopy()
+	annotationChange.Annotations["autoscaler/disk-threshold"] = "90"
+
+	tests := []struct {
+		name    string
+		updated *appsv1.Deployment
+		want    int
+	}{
+		{"status only", statusOnly, 0},
+		{"spec change", specChange, 1},
+		{"annotation change", annotationChange, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := newTestController(t, newFakeSource(), newTestConfig(t), Options{PVC: true})
+			defer c.queue.ShutDown()
+			c.handleWorkloadUpdate(old, tt.updated)
+			if got := c.queue.Len(); got != tt.want {
+				t.Errorf("queue length = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestHandlePodEnqueuesOwner checks that a pod event enqueues the managed
+// workload owning the pod and nothing else.
+func TestHandlePodEnqueuesOwner(t *testing.T) {
+	owned := func(kind, owner, hash string) *corev1.Pod {
+		pod := runningPod("shop", "pod", "web")
+		if hash != "" {
+			pod.Labels[appsv1.DefaultDeploymentUniqueLabelKey] = hash
+		}
+		controller := true
+		pod.OwnerReferences = []metav1.OwnerReference{{Kind: kind, Name: owner, Controller: &controller}}
+		return pod
+	}
+	unmanaged := annotatedDeployment("shop", "batch", 1)
+	unmanaged.Annotations = nil
+
+	tests := []struct {
+		name string
+		pod  *corev1.Pod
+		want []string
+	}{
+		{"deployment", owned("ReplicaSet", "web-5d9f8", "5d9f8"), []string{workloadKey("Deployment", "shop", "web")}},
+		{"unmanaged deployment", owned("ReplicaSet", "batch-5d9f8", "5d9f8"), nil},
+		{"replicaset without deployment", owned("ReplicaSet", "standalone", ""), nil},
+		{"no owner", runningPod("shop", "pod", "web"), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := newTestController(t, newFakeSource(), newTestConfig(t), Options{PVC: true}, annotatedDeployment("shop", "web", 1), unmanaged)
+			defer c.queue.ShutDown()
+			c.handlePod(tt.pod)
+			var got []string
+			for c.queue.Len() > 0 {
+				item, _ := c.queue.Get()
+				got = append(got, item.(string))
+				c.queue.Done(item)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("enqueued %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestInvalidAnnotationReportedOnce checks that an invalid annotation is
+// reported as an Event once, and again only after the annotations change.
+func TestInvalidAnnotationReportedOnce(t *testing.T) {
+	d := annotatedDeployment("shop", "web", 1)
+	d.Annotations["autoscaler/disk-resize-threshold"] = "150"
+	c, _ := newTestController(t, newFakeSource(), newTestConfig(t), Options{PVC: true}, d)
+	recorder := record.NewFakeRecorder(10)
+	c.recorder = recorder
+
+	ctx := context.Background()
+	key := workloadKey("Deployment", "shop", "web")
+	reconcile := func() {
+		t.Helper()
+		if err := c.reconcile(ctx, key); err != nil {
+			t.Fatalf("reconcile() error = %v", err)
+		}
+	}
+	reconcile()
+	reconcile()
+	if n := len(recorder.Events); n != 1 {
+		t.Fatalf("%d Events after two reconciles, want 1", n)
+	}
+
+	changed := d.DeepCopy()
+	changed.Annotations["autoscaler/disk-resize-threshold"] = "0"
+	updateCache(t, c, changed)
+	reconcile()
+	reconcile()
+	if n := len(recorder.Events); n != 2 {
+		t.Errorf("%d Events after the annotation changed, want 2", n)
+	}
+}
+
+// TestPendingResizeDoesNotBlockWorker runs a cycle with a single worker in
+// which one workload's PVC is resized by a driver that does not expand it.
+// The other workload must still be reconciled, and the resize must complete
+// once the PVC is updated.
+func TestPendingResizeDoesNotBlockWorker(t *testing.T) {
+	cfg := newTestConfig(t)
+	cfg.PVCGrowth.ResizeTimeout = time.Hour
+
+	source := newFakeSource()
+	source.setDisk("shop", "data", 90)
+	source.setDisk("shop", "cache", 90)
+	objects := append(expandableVolume("shop", "data", "10Gi"), annotatedDeployment("shop", "db", 1, "data"), annotatedDeployment("shop", "web", 1, "cache"))
+	objects = append(objects, expandableVolume("shop", "cache", "10Gi")[1:]...)
+	c, clientset := newTestController(t, source, cfg, Options{PVC: true, Workers: 1}, objects...)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	defer c.queue.ShutDown()
+	c.StartWorkers(ctx)
+
+	if _, err := c.RunCycle(ctx); err != nil {
+		t.Fatalf("RunCycle() error = %v, want the cycle to finish while the resizes are pending", err)
+	}
+	for _, name := range []string{"data", "cache"} {
+		claim := getPVC(t, clientset, "shop", name)
+		if got := claim.Spec.Resources.Requests[corev1.ResourceStorage]; got.Cmp(resource.MustParse("15Gi")) != 0 {
+			t.Errorf("PVC %s request = %s, want 15Gi", name, got.String())
+		}
+		if _, pending := c.pendingResizeOf("shop", name); !pending {
+			t.Errorf("resize of PVC %s is not tracked", name)
+		}
+	}
+
+	// The driver expands the volume; the PVC update completes the resize
+	claim := getPVC(t, clientset, "shop", "data")
+	claim.Status.Capacity = corev1.ResourceList{corev1.ResourceStorage: resource.MustParse("15Gi")}
+	updateCache(t, c, claim)
+	c.handlePVC(claim)
+	eventually(t, "the resize of PVC data to complete", func() bool {
+		_, pending := c.pendingResizeOf("shop", "data")
+		return !pending
+	})
+	if _, pending := c.pendingResizeOf("shop", "cache"); !pending {
+		t.Errorf("resize of PVC cache completed without the volume being expanded")
+	}
+}
+
+// savedHistory returns the scaling history of key saved to the ConfigMap.
+func savedHistory(t *testing.T, clientset *fake.Clientset, cfg *config.AutoscalerConfig, key string) deployment.History {
+	t.Helper()
+	ref := cfg.NetworkScaling.History
+	cm, err := clientset.CoreV1().ConfigMaps(ref.Namespace).Get(context.Background(), ref.ConfigMap, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("error getting the scaling history: %v", err)
+	}
+	histories := map[string]deployment.History{}
+	if err := json.Unmarshal([]byte(cm.Data["history.json"]), &histories); err != nil {
+		t.Fatalf("error parsing the scaling history: %v", err)
+	}
+	return histories[key]
+}
+
+// TestRecommendationsOnlyFromCycles checks that reconciles for informer
+// events and dry runs do not add recommendations to the stabilization
+// window.
+func TestRecommendationsOnlyFromCycles(t *testing.T) {
+	for _, dryRun := range []bool{false, true} {
+		t.Run(fmt.Sprintf("dry run %t", dryRun), func(t *testing.T) {
+			source := newFakeSource()
+			source.setRx("shop", "web-1", 100)
+			source.setRx("shop", "web-2", 100)
+			objects := []runtime.Object{
+				annotatedDeployment("shop", "web", 2),
+				runningPod("shop", "web-1", "web"),
+				runningPod("shop", "web-2", "web"),
+			}
+			cfg := newTestConfig(t)
+			c, clientset := newTestController(t, source, cfg, Options{Ingress: true, DryRun: dryRun}, objects...)
+			serveScale(clientset)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			defer c.queue.ShutDown()
+			c.StartWorkers(ctx)
+
+			key := workloadKey("Deployment", "shop", "web")
+			for cycle := 1; cycle <= 2; cycle++ {
+				if _, err := c.RunCycle(ctx); err != nil {
+					t.Fatalf("cycle %d: RunCycle() error = %v", cycle, err)
+				}
+				// Informer events between cycles reconcile the Deployment again
+				for i := 0; i < 3; i++ {
+					if err := c.reconcile(ctx, key); err != nil {
+						t.Fatalf("reconcile() error = %v", err)
+					}
+				}
+			}
+
+			if dryRun {
+				c.history.Update(key, time.Hour, func(h *deployment.History) {
+					if len(h.Recommendations) != 0 {
+						t.Errorf("a dry run recorded %d recommendations, want none", len(h.Recommendations))
+					}
+				})
+				return
+			}
+			if got := savedHistory(t, clientset, cfg, key).Recommendations; len(got) != 2 {
+				t.Errorf("saved %d recommendations, want one per cycle: %+v", len(got), got)
+			}
+		})
+	}
+}
+
+// TestScaleCooldownSurvivesRestart starts a controller with a persisted
+// scale event: the scale-down cooldown and the cooldown between actions
+// count from it rather than from the start of the process.
+func TestScaleCooldownSurvivesRestart(t *testing.T) {
+	tests := []struct {
+		name         string
+		cooldown     string
+		scaledAgo    time.Duration
+		wantReplicas int32
+	}{
+		{name: "within the cooldown", scaledAgo: time.Minute, wantReplicas: 4},
+		{name: "after the cooldown", scaledAgo: 10 * time.Minute, wantReplicas: 2},
+		{name: "within the cooldown between actions", cooldown: "15m", scaledAgo: 10 * time.Minute, wantReplicas: 4},
+		{name: "after the cooldown between actions", cooldown: "15m", scaledAgo: 20 * time.Minute, wantReplicas: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := newTestConfig(t)
+			key := workloadKey("Deployment", "shop", "web")
+			history, err := json.Marshal(map[string]deployment.History{
+				key: {Events: []deployment.ScaleEvent{{Time: time.Now().Add(-tt.scaledAgo), From: 2, To: 4}}},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			source := newFakeSource()
+			source.setRx("shop", "web-1", 50)
+			source.setRx("shop", "web-2", 50)
+			d := annotatedDeployment("shop", "web", 4)
+			if tt.cooldown != "" {
+				d.Annotations["autoscaler/cooldown"] = tt.cooldown
+			}
+			objects := []runtime.Object{
+				d,
+				runningPod("shop", "web-1", "web"),
+				runningPod("shop", "web-2", "web"),
+				&corev1.ConfigMap{
+					ObjectMeta: metav1.ObjectMeta{Namespace: cfg.NetworkScaling.History.Namespace, Name: cfg.NetworkScaling.History.ConfigMap},
+					Data:       map[string]string{"history.json": string(history)},
+				},
+			}
+			c, clientset := newTestController(t, source, cfg, Options{Ingress: true}, objects...)
+			serveScale(clientset)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			defer c.queue.ShutDown()
+			c.StartWorkers(ctx)
+			if _, err := c.RunCycle(ctx); err != nil {
+				t.Fatalf("RunCycle() error = %v", err)
+			}
+			if got := *getDeployment(t, clientset, "shop", "web").Spec.Replicas; got != tt.wantReplicas {
+				t.Errorf("replicas = %d, want %d", got, tt.wantReplicas)
+			}
+		})
+	}
+}
+
+// recordedEvents returns the Events recorded so far, as "Type Reason Message".
+func recordedEvents(recorder *record.FakeRecorder) []string {
+	var events []string
+	for {
+		select {
+		case e := <-recorder.Events:
+			events = append(events, e)
+		default:
+			return events
+		}
+	}
+}
+
+// TestStatefulSetTemplateDrift resizes the per-ordinal PVC of a StatefulSet
+// and checks that a template smaller than the grown PVC is reported, and the
+// StatefulSet left alone.
+func TestStatefulSetTemplateDrift(t *testing.T) {
+	tests := []struct {
+		name      string
+		template  string
+		wantEvent bool
+	}{
+		{name: "template smaller than the PVC", template: "10Gi", wantEvent: true},
+		{name: "template large enough", template: "20Gi"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			replicas := int32(1)
+			sts := &appsv1.StatefulSet{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "db", Annotations: map[string]string{"autoscaler/enabled": "true"}},
+				Spec: appsv1.StatefulSetSpec{
+					Replicas: &replicas,
+					VolumeClaimTemplates: []corev1.PersistentVolumeClaim{{
+						ObjectMeta: metav1.ObjectMeta{Name: "data"},
+						Spec: corev1.PersistentVolumeClaimSpec{Resources: corev1.VolumeResourceRequirements{
+							Requests: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse(tt.template)},
+						}},
+					}},
+				},
+			}
+			source := newFakeSource()
+			source.setDisk("shop", "data-db-0", 90)
+			objects := append(expandableVolume("shop", "data-db-0", "10Gi"), sts)
+			c, clientset := newTestController(t, source, newTestConfig(t), Options{PVC: true}, objects...)
+			recorder := record.NewFakeRecorder(10)
+			c.recorder = recorder
+
+			if err := c.reconcile(context.Background(), workloadKey("StatefulSet", "shop", "db")); err != nil {
+				t.Fatalf("reconcile() error = %v", err)
+			}
+			claim := getPVC(t, clientset, "shop", "data-db-0")
+			if got := claim.Spec.Resources.Requests[corev1.ResourceStorage]; got.Cmp(resource.MustParse("15Gi")) != 0 {
+				t.Fatalf("PVC request = %s, want 15Gi", got.String())
+			}
+
+			var drift []string
+			for _, e := range recordedEvents(recorder) {
+				if strings.Contains(e, "VolumeClaimTemplateDrift") {
+					drift = append(drift, e)
+				}
+			}
+			if !tt.wantEvent {
+				if len(drift) != 0 {
+					t.Errorf("drift Events = %q, want none", drift)
+				}
+			} else if want := "Warning VolumeClaimTemplateDrift volumeClaimTemplate data requests 10Gi but PVC data-db-0 was grown to 15Gi"; len(drift) != 1 || !strings.HasPrefix(drift[0], want) {
+				t.Errorf("drift Events = %q, want one starting with %q", drift, want)
+			}
+			for _, action := range clientset.Actions() {
+				if action.GetResource().Resource == "statefulsets" && action.GetVerb() != "get" && action.GetVerb() != "list" && action.GetVerb() != "watch" {
+					t.Errorf("the StatefulSet was changed with a %s request", action.GetVerb())
+				}
+			}
+		})
+	}
+}
+
+// eventsWithReason returns the recorded Events with the given reason.
+func eventsWithReason(recorder *record.FakeRecorder, reason string) []string {
+	var matching []string
+	for _, e := range recordedEvents(recorder) {
+		if strings.Contains(e, " "+reason+" ") {
+			matching = append(matching, e)
+		}
+	}
+	return matching
+}
+
+// TestInodeUsage checks the inode action and threshold set by annotations
+// and by an AutoscalerPolicy: alert only reports, resize grows the PVC by
+// the inode usage when it is above the disk usage.
+func TestInodeUsage(t *testing.T) {
+	inodeAnnotations := func(action string) map[string]string {
+		return map[string]string{
+			"autoscaler/enabled":                 "true",
+			"autoscaler/inode-threshold":         "90",
+			"autoscaler/inode-action":            action,
+			"autoscaler/disk-growth-strategy":    "target-utilization",
+			"autoscaler/disk-target-utilization": "50",
+		}
+	}
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		policy      *v1alpha1.PVCRules
+		wantSize    string
+		wantEvent   string
+		wantReason  string
+	}{
+		{
+			name:        "alert annotation",
+			annotations: inodeAnnotations("alert"),
+			wantSize:    "10Gi",
+			wantEvent:   "Warning InodeUsageHigh Inode usage 95.00% exceeds threshold 90%: alert only, growing the volume may not add inodes",
+		},
+		{
+			name:        "resize annotation",
+			annotations: inodeAnnotations("resize"),
+			// 95% of 10Gi at a target of 50%
+			wantSize:   "19Gi",
+			wantEvent:  "Warning InodeUsageHigh Inode usage 95.00% exceeds threshold 90%: resizing the PVC",
+			wantReason: "Normal PVCExpanded Expanded from 10Gi to 19Gi: inode usage 95.00% > 90%",
+		},
+		{
+			name:        "alert policy",
+			annotations: map[string]string{"autoscaler/enabled": "true"},
+			policy:      &v1alpha1.PVCRules{InodeThreshold: 90, InodeAction: "alert", Strategy: "target-utilization", TargetUtilization: 50},
+			wantSize:    "10Gi",
+			wantEvent:   "Warning InodeUsageHigh Inode usage 95.00% exceeds threshold 90%: alert only, growing the volume may not add inodes",
+		},
+		{
+			name:        "resize policy",
+			annotations: map[string]string{"autoscaler/enabled": "true"},
+			policy:      &v1alpha1.PVCRules{InodeThreshold: 90, InodeAction: "resize", Strategy: "target-utilization", TargetUtilization: 50},
+			wantSize:    "19Gi",
+			wantEvent:   "Warning InodeUsageHigh Inode usage 95.00% exceeds threshold 90%: resizing the PVC",
+			wantReason:  "Normal PVCExpanded Expanded from 10Gi to 19Gi: inode usage 95.00% > 90%",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := newFakeSource()
+			source.setDisk("shop", "data", 50)
+			source.setInodes("shop", "data", 95)
+			d := annotatedDeployment("shop", "db", 1, "data")
+			d.Annotations = tt.annotations
+			objects := append(expandableVolume("shop", "data", "10Gi"), d)
+			var policies []*v1alpha1.AutoscalerPolicy
+			if tt.policy != nil {
+				policies = append(policies, &v1alpha1.AutoscalerPolicy{
+					ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "db"},
+					Spec: v1alpha1.AutoscalerPolicySpec{
+						TargetRef: v1alpha1.TargetRef{Kind: "Deployment", Name: "db"},
+						PVC:       tt.policy,
+					},
+				})
+			}
+			c, clientset := newPolicyController(t, newFakePolicies(policies...), source, newTestConfig(t), Options{PVC: true}, objects...)
+			for _, policy := range policies {
+				if err := c.policyInformer.GetIndexer().Add(policy); err != nil {
+					t.Fatalf("error adding the policy to the informer cache: %v", err)
+				}
+			}
+			expandOnUpdate(clientset)
+			recorder := record.NewFakeRecorder(10)
+			c.recorder = recorder
+
+			if err := c.reconcile(context.Background(), workloadKey("Deployment", "shop", "db")); err != nil {
+				t.Fatalf("reconcile() error = %v", err)
+			}
+			claim := getPVC(t, clientset, "shop", "data")
+			if got := claim.Spec.Resources.Requests[corev1.ResourceStorage]; got.Cmp(resource.MustParse(tt.wantSize)) != 0 {
+				t.Errorf("PVC request = %s, want %s", got.String(), tt.wantSize)
+			}
+			events := recordedEvents(recorder)
+			var inode, expanded []string
+			for _, e := range events {
+				switch {
+				case strings.Contains(e, " InodeUsageHigh "):
+					inode = append(inode, e)
+				case strings.Contains(e, " PVCExpanded "):
+					expanded = append(expanded, e)
+				}
+			}
+			if len(inode) != 1 || inode[0] != tt.wantEvent {
+				t.Errorf("InodeUsageHigh Events = %q, want %q", inode, tt.wantEvent)
+			}
+			if tt.wantReason == "" {
+				if len(expanded) != 0 {
+					t.Errorf("PVCExpanded Events = %q, want none", expanded)
+				}
+			} else if len(expanded) != 1 || expanded[0] != tt.wantReason {
+				t.Errorf("PVCExpanded Events = %q, want %q", expanded, tt.wantReason)
+			}
+		})
+	}
+}
+
+// TestInodeUsageReportedOnChange checks that InodeUsageHigh is only emitted
+// when the inode usage goes above the threshold, not on every reconcile.
+func TestInodeUsageReportedOnChange(t *testing.T) {
+	source := newFakeSource()
+	source.setDisk("shop", "data", 50)
+	source.setInodes("shop", "data", 95)
+	d := annotatedDeployment("shop", "db", 1, "data")
+	d.Annotations["autoscaler/inode-threshold"] = "90"
+	d.Annotations["autoscaler/inode-action"] = "alert"
+	objects := append(expandableVolume("shop", "data", "10Gi"), d)
+	c, _ := newTestController(t, source, newTestConfig(t), Options{PVC: true}, objects...)
+	recorder := record.NewFakeRecorder(10)
+	c.recorder = recorder
+
+	ctx := context.Background()
+	key := workloadKey("Deployment", "shop", "db")
+	reconcile := func() int {
+		t.Helper()
+		if err := c.reconcile(ctx, key); err != nil {
+			t.Fatalf("reconcile() error = %v", err)
+		}
+		return len(eventsWithReason(recorder, "InodeUsageHigh"))
+	}
+	if n := reconcile(); n != 1 {
+		t.Fatalf("%d InodeUsageHigh Events after the first reconcile, want 1", n)
+	}
+	if n := reconcile(); n != 0 {
+		t.Errorf("%d InodeUsageHigh Events while the usage stays high, want 0", n)
+	}
+	source.setInodes("shop", "data", 60)
+	if n := reconcile(); n != 0 {
+		t.Errorf("%d InodeUsageHigh Events below the threshold, want 0", n)
+	}
+	source.setInodes("shop", "data", 96)
+	if n := reconcile(); n != 1 {
+		t.Errorf("%d InodeUsageHigh Events after the usage went up again, want 1", n)
+	}
+}
+
+// TestEventMessages checks the reason and message of the Events of resizes
+// and scales, which carry the observed usage and the threshold acted on.
+func TestEventMessages(t *testing.T) {
+	pvcFailure := func(clientset *fake.Clientset) {
+		clientset.PrependReactor("update", "persistentvolumeclaims", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, fmt.Errorf("volume is being detached")
+		})
+	}
+	scaleFailure := func(clientset *fake.Clientset) {
+		clientset.PrependReactor("update", "deployments", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, fmt.Errorf("admission webhook denied the request")
+		})
+	}
+	web := func(replicas int32, rate float64) (*fakeSource, []runtime.Object) {
+		source := newFakeSource()
+		objects := []runtime.Object{annotatedDeployment("shop", "web", replicas)}
+		for i := 1; i <= int(replicas); i++ {
+			pod := fmt.Sprintf("web-%d", i)
+			source.setRx("shop", pod, rate)
+			objects = append(objects, runningPod("shop", pod, "web"))
+		}
+		return source, objects
+	}
+	db := func(annotations map[string]string) (*fakeSource, []runtime.Object) {
+		source := newFakeSource()
+		source.setDisk("shop", "data", 90)
+		d := annotatedDeployment("shop", "db", 1, "data")
+		for k, v := range annotations {
+			d.Annotations[k] = v
+		}
+		return source, append(expandableVolume("shop", "data", "10Gi"), d)
+	}
+
+	tests := []struct {
+		name     string
+		workload func() (*fakeSource, []runtime.Object)
+		key      string
+		options  Options
+		react    func(*fake.Clientset)
+		reason   string
+		want     string
+	}{
+		{
+			name:     "PVC expanded",
+			workload: func() (*fakeSource, []runtime.Object) { return db(nil) },
+			key:      workloadKey("Deployment", "shop", "db"),
+			options:  Options{PVC: true},
+			react:    expandOnUpdate,
+			reason:   "PVCExpanded",
+			want:     "Normal PVCExpanded Expanded from 10Gi to 15Gi: disk usage 90.00% > 80%",
+		},
+		{
+			name: "PVC expansion skipped",
+			workload: func() (*fakeSource, []runtime.Object) {
+				return db(map[string]string{"autoscaler/max-pvc-size": "10Gi"})
+			},
+			key:     workloadKey("Deployment", "shop", "db"),
+			options: Options{PVC: true},
+			reason:  "PVCExpansionSkipped",
+			want:    "Warning PVCExpansionSkipped Expansion skipped (MaxSizeReached): PVC data is already at its maximum size 10Gi (disk usage 90.00% > 80%)",
+		},
+		{
+			name:     "PVC expansion failed",
+			workload: func() (*fakeSource, []runtime.Object) { return db(nil) },
+			key:      workloadKey("Deployment", "shop", "db"),
+			options:  Options{PVC: true},
+			react:    pvcFailure,
+			reason:   "PVCExpansionFailed",
+			want:     "Warning PVCExpansionFailed Expansion failed: error updating PVC data: volume is being detached (disk usage 90.00% > 80%)",
+		},
+		{
+			name:     "scaled up",
+			workload: func() (*fakeSource, []runtime.Object) { return web(2, 400) },
+			key:      workloadKey("Deployment", "shop", "web"),
+			options:  Options{Ingress: true},
+			reason:   "ScaledUp",
+			want:     "Normal ScaledUp Scaled from 2 to 8 replicas: average ingress 400.00 B/s per pod over 2 pods vs target 100 B/s",
+		},
+		{
+			name:     "scaled down",
+			workload: func() (*fakeSource, []runtime.Object) { return web(4, 50) },
+			key:      workloadKey("Deployment", "shop", "web"),
+			options:  Options{Ingress: true},
+			reason:   "ScaledDown",
+			want:     "Normal ScaledDown Scaled from 4 to 2 replicas: average ingress 50.00 B/s per pod over 4 pods vs target 100 B/s",
+		},
+		{
+			name:     "scale failed",
+			workload: func() (*fakeSource, []runtime.Object) { return web(2, 400) },
+			key:      workloadKey("Deployment", "shop", "web"),
+			options:  Options{Ingress: true},
+			react:    scaleFailure,
+			reason:   "ScaleFailed",
+			want:     "Warning ScaleFailed Scaling to 8 replicas failed: error scaling deployment web in namespace shop: admission webhook denied the request (average ingress 400.00 B/s per pod over 2 pods vs target 100 B/s)",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source, objects := tt.workload()
+			c, clientset := newTestController(t, source, newTestConfig(t), tt.options, objects...)
+			serveScale(clientset)
+			if tt.react != nil {
+				tt.react(clientset)
+			}
+			recorder := record.NewFakeRecorder(10)
+			c.recorder = recorder
+
+			if err := c.reconcile(context.Background(), tt.key); err != nil {
+				t.Fatalf("reconcile() error = %v", err)
+			}
+			if got := eventsWithReason(recorder, tt.reason); len(got) != 1 || got[0] != tt.want {
+				t.Errorf("%s Events = %q, want %q", tt.reason, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestForecastQueriesPerCycle checks that forecasting a PVC reads its
+// capacity from the snapshot and issues one range query per lookback,
+// extending the used bytes from the snapshots in between.
+func TestForecastQueriesPerCycle(t *testing.T) {
+	cfg := newTestConfig(t)
+	lookback := cfg.PVCGrowth.Forecast.Lookback
+	now := time.Now()
+	source := newFakeSource()
+	source.setDisk("shop", "data", 50)
+	// 1Gi in the last lookback, full in far more than the horizon
+	source.setBytes("shop", "data", 5<<30, 10<<30,
+		prometheus.Point{Time: now.Add(-lookback), Value: 4 << 30},
+		prometheus.Point{Time: now.Add(-lookback / 2), Value: 4.5 * (1 << 30)},
+		prometheus.Point{Time: now, Value: 5 << 30})
+	d := annotatedDeployment("shop", "db", 1, "data")
+	d.Annotations["autoscaler/disk-forecast-horizon"] = "24h"
+	objects := append(expandableVolume("shop", "data", "10Gi"), d)
+	c, clientset := newTestController(t, source, cfg, Options{PVC: true}, objects...)
+
+	ctx := context.Background()
+	key := workloadKey("Deployment", "shop", "db")
+	for cycle := 1; cycle <= 3; cycle++ {
+		c.refreshSnapshot(ctx)
+		if err := c.reconcile(ctx, key); err != nil {
+			t.Fatalf("reconcile() error = %v", err)
+		}
+	}
+	if got := getPVC(t, clientset, "shop", "data").Spec.Resources.Requests[corev1.ResourceStorage]; got.Cmp(resource.MustParse("10Gi")) != 0 {
+		t.Errorf("PVC request = %s, want it unchanged at 10Gi", got.String())
+	}
+	_, live := source.counts()
+	if ranges := source.rangeCount(); live != 0 || ranges != 1 {
+		t.Errorf("three cycles issued %d live and %d range queries, want none and one", live, ranges)
+	}
+
+	// Later cycles add the used bytes of their snapshot and drop the ones
+	// older than the lookback
+	vars := metrics.Vars{Namespace: "shop", PVC: "data"}
+	source.setBytes("shop", "data", 6<<30, 10<<30)
+	c.refreshSnapshot(ctx)
+	samples, err := c.usedBytes(ctx, c.metricsSource(), vars, lookback, now.Add(10*time.Minute))
+	if err != nil {
+		t.Fatalf("usedBytes() error = %v", err)
+	}
+	if n := len(samples); n != 3 || samples[0].Value != 4.5*(1<<30) || samples[n-1].Value != 6<<30 {
+		t.Errorf("used bytes after a later snapshot = %v, want the last two of the range and 6Gi", samples)
+	}
+	if ranges := source.rangeCount(); ranges != 1 {
+		t.Errorf("%d range queries, want 1 within the lookback", ranges)
+	}
+
+	// A lookback later they are fetched again
+	if _, err := c.usedBytes(ctx, c.metricsSource(), vars, lookback, now.Add(lookback+time.Minute)); err != nil {
+		t.Fatalf("usedBytes() error = %v", err)
+	}
+	if ranges := source.rangeCount(); ranges != 2 {
+		t.Errorf("%d range queries, want 2 after the lookback", ranges)
+	}
+	c.pruneForecasts(now.Add(2*lookback + time.Minute))
+	if n := len(c.forecasts); n != 0 {
+		t.Errorf("%d PVCs cached after a lookback without forecasts, want none", n)
+	}
+}
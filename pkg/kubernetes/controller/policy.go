@@ -0,0 +1,368 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"k8s-resource-autoscaler/pkg/apis/autoscaler/v1alpha1"
+	"k8s-resource-autoscaler/pkg/kubernetes/annotations"
+	"k8s-resource-autoscaler/pkg/kubernetes/deployment"
+	"k8s-resource-autoscaler/pkg/kubernetes/pvc"
+	"k8s-resource-autoscaler/pkg/log"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/tools/cache"
+)
+
+// usageStatusInterval is the minimum time between two status updates that
+// would only refresh the observation time of an unchanged usage.
+const usageStatusInterval = time.Minute
+
+// targetIndex indexes AutoscalerPolicies by the queue key of the workload
+// they target.
+const targetIndex = "target"
+
+// targetKeys is the index function for targetIndex.
+func targetKeys(obj interface{}) ([]string, error) {
+	p, ok := obj.(*v1alpha1.AutoscalerPolicy)
+	if !ok || p.Spec.TargetRef.Name == "" {
+		return nil, nil
+	}
+	switch p.Spec.TargetRef.Kind {
+	case annotations.KindDeployment, annotations.KindStatefulSet:
+		return []string{workloadKey(p.Spec.TargetRef.Kind, p.Namespace, p.Spec.TargetRef.Name)}, nil
+	}
+	return nil, nil
+}
+
+// handlePolicy enqueues the workload targeted by a policy.
+func (c *Controller) handlePolicy(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	keys, _ := targetKeys(obj)
+	for _, key := range keys {
+		c.queue.Add(key)
+	}
+}
+
+// handlePolicyDelete enqueues the workload targeted by a deleted policy and
+// forgets the problems reported for it.
+func (c *Controller) handlePolicyDelete(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	if policy, ok := obj.(*v1alpha1.AutoscalerPolicy); ok {
+		c.newProblems(policyKey(policy), "", nil)
+	}
+	c.handlePolicy(obj)
+}
+
+// policyKey returns the key the problems of a policy are reported under.
+func policyKey(policy *v1alpha1.AutoscalerPolicy) string {
+	return "AutoscalerPolicy/" + policy.Namespace + "/" + policy.Name
+}
+
+// handlePolicyUpdate enqueues the workloads targeted by the old and the new
+// version of a policy when its spec changed. Status updates, including the
+// ones written by reconciles, leave the generation alone and are ignored.
+func (c *Controller) handlePolicyUpdate(oldObj, newObj interface{}) {
+	old, ok := oldObj.(*v1alpha1.AutoscalerPolicy)
+	if !ok {
+		return
+	}
+	policy, ok := newObj.(*v1alpha1.AutoscalerPolicy)
+	if !ok || policy.Generation == old.Generation {
+		return
+	}
+	c.handlePolicy(old)
+	c.handlePolicy(policy)
+}
+
+// policyFor returns the AutoscalerPolicy targeting the workload with the
+// given key, or nil when there is none. If several policies target the same
+// workload the first by name wins.
+func (c *Controller) policyFor(key string) *v1alpha1.AutoscalerPolicy {
+	if c.policyInformer == nil {
+		return nil
+	}
+	objs, err := c.policyInformer.GetIndexer().ByIndex(targetIndex, key)
+	if err != nil {
+		utilruntime.HandleError(err)
+		return nil
+	}
+	if len(objs) == 0 {
+		return nil
+	}
+
+	policies := make([]*v1alpha1.AutoscalerPolicy, 0, len(objs))
+	for _, obj := range objs {
+		policies = append(policies, obj.(*v1alpha1.AutoscalerPolicy))
+	}
+	sort.Slice(policies, func(i, j int) bool { return policies[i].Name < policies[j].Name })
+	if len(policies) > 1 {
+		c.log.Warning("%d AutoscalerPolicies target %s, using %s.", len(policies), key, policies[0].Name)
+	}
+	return policies[0]
+}
+
+// hasPolicy reports whether an AutoscalerPolicy targets the workload.
+func (c *Controller) hasPolicy(key string) bool {
+	return c.policyFor(key) != nil
+}
+
+// policyFromSpec converts an AutoscalerPolicy spec into the policy used by
+// the reconcile handlers. Invalid fields are left unset and reported.
+func policyFromSpec(spec v1alpha1.AutoscalerPolicySpec) (annotations.Policy, []error) {
+	var policy annotations.Policy
+	var errs []error
+
+	if spec.PVC != nil {
+		if spec.PVC.ResizeThreshold < 0 || spec.PVC.ResizeThreshold > 100 {
+			errs = append(errs, fmt.Errorf("pvc.resizeThreshold %d must be between 1 and 100", spec.PVC.ResizeThreshold))
+		} else {
+			policy.DiskResizeThreshold = int(spec.PVC.ResizeThreshold)
+		}
+		if spec.PVC.InodeThreshold < 0 || spec.PVC.InodeThreshold > 100 {
+			errs = append(errs, fmt.Errorf("pvc.inodeThreshold %d must be between 1 and 100", spec.PVC.InodeThreshold))
+		} else {
+			policy.InodeThreshold = int(spec.PVC.InodeThreshold)
+		}
+		if spec.PVC.InodeAction != "" {
+			action, err := annotations.ParseInodeAction(spec.PVC.InodeAction)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("pvc.inodeAction: %v", err))
+			} else {
+				policy.InodeAction = action
+			}
+		}
+		if spec.PVC.GrowthPercent < 0 {
+			errs = append(errs, fmt.Errorf("pvc.growthPercent %d must be positive", spec.PVC.GrowthPercent))
+		} else {
+			policy.DiskGrowthPercent = int(spec.PVC.GrowthPercent)
+		}
+		if spec.PVC.Strategy != "" {
+			strategy, err := pvc.ParseGrowthStrategy(spec.PVC.Strategy)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("pvc.strategy: %v", err))
+			} else {
+				policy.DiskGrowthStrategy = strategy
+			}
+		}
+		if spec.PVC.Increment != nil {
+			if spec.PVC.Increment.Sign() <= 0 {
+				errs = append(errs, fmt.Errorf("pvc.increment %s must be positive", spec.PVC.Increment.String()))
+			} else {
+				policy.DiskGrowthIncrement = spec.PVC.Increment.DeepCopy()
+			}
+		}
+		if spec.PVC.TargetUtilization < 0 || spec.PVC.TargetUtilization > 99 {
+			errs = append(errs, fmt.Errorf("pvc.targetUtilization %d must be between 1 and 99", spec.PVC.TargetUtilization))
+		} else {
+			policy.DiskTargetUtilization = int(spec.PVC.TargetUtilization)
+		}
+		if spec.PVC.MinStep != nil {
+			if spec.PVC.MinStep.Sign() <= 0 {
+				errs = append(errs, fmt.Errorf("pvc.minStep %s must be positive", spec.PVC.MinStep.String()))
+			} else {
+				policy.MinPVCStep = spec.PVC.MinStep.DeepCopy()
+			}
+		}
+		if spec.PVC.MaxSize != nil {
+			if spec.PVC.MaxSize.Sign() <= 0 {
+				errs = append(errs, fmt.Errorf("pvc.maxSize %s must be positive", spec.PVC.MaxSize.String()))
+			} else {
+				policy.MaxPVCSize = spec.PVC.MaxSize.DeepCopy()
+			}
+		}
+		if spec.PVC.MinResizeInterval != nil {
+			if spec.PVC.MinResizeInterval.Duration <= 0 {
+				errs = append(errs, fmt.Errorf("pvc.minResizeInterval %s must be positive", spec.PVC.MinResizeInterval.Duration))
+			} else {
+				policy.MinResizeInterval = spec.PVC.MinResizeInterval.Duration
+			}
+		}
+		if spec.PVC.ForecastHorizon != nil {
+			if spec.PVC.ForecastHorizon.Duration <= 0 {
+				errs = append(errs, fmt.Errorf("pvc.forecastHorizon %s must be positive", spec.PVC.ForecastHorizon.Duration))
+			} else {
+				policy.ForecastHorizon = spec.PVC.ForecastHorizon.Duration
+			}
+		}
+		if spec.PVC.MaxResizesPerDay < 0 {
+			errs = append(errs, fmt.Errorf("pvc.maxResizesPerDay %d must be positive", spec.PVC.MaxResizesPerDay))
+		} else {
+			policy.MaxResizesPerDay = int(spec.PVC.MaxResizesPerDay)
+		}
+	}
+
+	if spec.Network != nil {
+		if t := spec.Network.IngressThreshold; t != nil {
+			if *t <= 0 {
+				errs = append(errs, fmt.Errorf("network.ingressThreshold %d must be positive", *t))
+			} else {
+				policy.IngressThreshold = int(*t)
+			}
+		}
+		if spec.Network.Metric != "" {
+			metric, err := deployment.ParseScalingMetric(spec.Network.Metric)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("network.metric: %v", err))
+			} else {
+				policy.ScalingMetric = metric
+			}
+		}
+	}
+
+	limits := spec.Limits
+	if limits.MinReplicas != nil {
+		policy.MinReplicas = *limits.MinReplicas
+	}
+	if limits.MaxReplicas != nil {
+		policy.MaxReplicas = *limits.MaxReplicas
+	}
+	if policy.MinReplicas > 0 && policy.MaxReplicas > 0 && policy.MinReplicas > policy.MaxReplicas {
+		errs = append(errs, fmt.Errorf("limits.minReplicas %d must not exceed limits.maxReplicas %d", policy.MinReplicas, policy.MaxReplicas))
+		policy.MinReplicas = 0
+		policy.MaxReplicas = 0
+	}
+	for _, d := range []struct {
+		name  string
+		spec  *metav1.Duration
+		field *time.Duration
+	}{
+		{"cooldown", limits.Cooldown, &policy.Cooldown},
+		{"scaleUpCooldown", limits.ScaleUpCooldown, &policy.ScaleUpCooldown},
+		{"scaleDownCooldown", limits.ScaleDownCooldown, &policy.ScaleDownCooldown},
+	} {
+		if d.spec == nil {
+			continue
+		}
+		// Zero would read as unset and fall back to the default
+		if d.spec.Duration <= 0 {
+			errs = append(errs, fmt.Errorf("limits.%s %s must be positive", d.name, d.spec.Duration))
+		} else {
+			*d.field = d.spec.Duration
+		}
+	}
+
+	return policy, errs
+}
+
+// observation collects what a reconcile measured and did, so it can be
+// reported in the status of the workload's AutoscalerPolicy.
+type observation struct {
+	pvcUsage   []v1alpha1.PVCUsage
+	maxIngress *float64
+	action     *v1alpha1.LastAction
+}
+
+func (o *observation) observePVC(name string, usagePercent float64) {
+	if o == nil {
+		return
+	}
+	o.pvcUsage = append(o.pvcUsage, v1alpha1.PVCUsage{Name: name, UsagePercent: fmt.Sprintf("%.2f", usagePercent)})
+}
+
+func (o *observation) observeIngress(bytesPerSecond float64) {
+	if o == nil {
+		return
+	}
+	if o.maxIngress == nil || bytesPerSecond > *o.maxIngress {
+		o.maxIngress = &bytesPerSecond
+	}
+}
+
+func (o *observation) recordAction(actionType, target, message string) {
+	if o == nil {
+		return
+	}
+	o.action = &v1alpha1.LastAction{
+		Time:    metav1.Now(),
+		Type:    actionType,
+		Target:  target,
+		Message: message,
+	}
+}
+
+// statusUpToDate reports whether updated need not be written over current:
+// they are equal, or differ only in the time of an unchanged usage observed
+// less than usageStatusInterval after the written one. Skipping the update
+// rather than keeping the old time leaves the status on the time of the
+// observation it holds.
+func statusUpToDate(current, updated v1alpha1.AutoscalerPolicyStatus) bool {
+	last, usage := current.LastObservedUsage, updated.LastObservedUsage
+	if last != nil && usage != nil && usage.Time.Sub(last.Time.Time) < usageStatusInterval {
+		unchanged := *usage
+		unchanged.Time = last.Time
+		updated.LastObservedUsage = &unchanged
+	}
+	return equality.Semantic.DeepEqual(current, updated)
+}
+
+// updatePolicyStatus writes the observation, validation result and target
+// state to the status of the AutoscalerPolicy.
+func (c *Controller) updatePolicyStatus(ctx context.Context, policy *v1alpha1.AutoscalerPolicy, obs *observation, targetFound bool, errs []error) {
+	if c.options.DryRun {
+		return
+	}
+
+	updated := policy.DeepCopy()
+	updated.Status.ObservedGeneration = policy.Generation
+
+	valid := metav1.Condition{
+		Type:               v1alpha1.ConditionValid,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: policy.Generation,
+		Reason:             "Valid",
+		Message:            "Policy spec is valid.",
+	}
+	if len(errs) > 0 {
+		messages := make([]string, 0, len(errs))
+		for _, err := range errs {
+			messages = append(messages, err.Error())
+		}
+		valid.Status = metav1.ConditionFalse
+		valid.Reason = "InvalidSpec"
+		valid.Message = strings.Join(messages, "; ")
+	}
+	meta.SetStatusCondition(&updated.Status.Conditions, valid)
+
+	target := metav1.Condition{
+		Type:               v1alpha1.ConditionTargetFound,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: policy.Generation,
+		Reason:             "TargetFound",
+		Message:            fmt.Sprintf("%s %s found.", policy.Spec.TargetRef.Kind, policy.Spec.TargetRef.Name),
+	}
+	if !targetFound {
+		target.Status = metav1.ConditionFalse
+		target.Reason = "TargetNotFound"
+		target.Message = fmt.Sprintf("%s %s not found.", policy.Spec.TargetRef.Kind, policy.Spec.TargetRef.Name)
+	}
+	meta.SetStatusCondition(&updated.Status.Conditions, target)
+
+	if obs != nil && (len(obs.pvcUsage) > 0 || obs.maxIngress != nil) {
+		usage := &v1alpha1.ObservedUsage{Time: metav1.NewTime(time.Now()), PVCs: obs.pvcUsage}
+		if obs.maxIngress != nil {
+			usage.MaxPodIngress = fmt.Sprintf("%.2f", *obs.maxIngress)
+		}
+		updated.Status.LastObservedUsage = usage
+	}
+	if obs != nil && obs.action != nil {
+		updated.Status.LastAction = obs.action
+	}
+
+	if statusUpToDate(policy.Status, updated.Status) {
+		return
+	}
+	_, err := c.policies.AutoscalerPolicies(policy.Namespace).UpdateStatus(ctx, updated, metav1.UpdateOptions{})
+	if err != nil {
+		log.FromContext(ctx).Error("Error updating status of AutoscalerPolicy %s/%s: %v", policy.Namespace, policy.Name, err)
+	}
+}
@@ -0,0 +1,305 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"k8s-resource-autoscaler/pkg/apis/autoscaler/v1alpha1"
+	"k8s-resource-autoscaler/pkg/client"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestPolicyFromSpecIngressThreshold(t *testing.T) {
+	threshold := func(v int64) *int64 { return &v }
+
+	tests := []struct {
+		name      string
+		threshold *int64
+		want      int
+		wantErr   bool
+	}{
+		{name: "unset", threshold: nil, want: 0},
+		{name: "positive", threshold: threshold(1048576), want: 1048576},
+		{name: "zero", threshold: threshold(0), wantErr: true},
+		{name: "negative", threshold: threshold(-5), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec := v1alpha1.AutoscalerPolicySpec{Network: &v1alpha1.NetworkRules{IngressThreshold: tt.threshold}}
+			policy, errs := policyFromSpec(spec)
+			if policy.IngressThreshold != tt.want {
+				t.Errorf("IngressThreshold = %d, want %d", policy.IngressThreshold, tt.want)
+			}
+			if tt.wantErr != (len(errs) == 1 && strings.HasPrefix(errs[0].Error(), "network.ingressThreshold")) {
+				t.Errorf("errors = %v, want an ingressThreshold error: %v", errs, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPolicyFromSpecDurations(t *testing.T) {
+	duration := func(d time.Duration) *metav1.Duration { return &metav1.Duration{Duration: d} }
+
+	tests := []struct {
+		name    string
+		value   *metav1.Duration
+		want    time.Duration
+		wantErr bool
+	}{
+		{name: "unset", value: nil, want: 0},
+		{name: "positive", value: duration(time.Minute), want: time.Minute},
+		{name: "zero", value: duration(0), wantErr: true},
+		{name: "negative", value: duration(-time.Minute), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec := v1alpha1.AutoscalerPolicySpec{
+				PVC: &v1alpha1.PVCRules{MinResizeInterval: tt.value, ForecastHorizon: tt.value},
+				Limits: v1alpha1.Limits{
+					Cooldown:          tt.value,
+					ScaleUpCooldown:   tt.value,
+					ScaleDownCooldown: tt.value,
+				},
+			}
+			policy, errs := policyFromSpec(spec)
+			for name, got := range map[string]time.Duration{
+				"MinResizeInterval": policy.MinResizeInterval,
+				"ForecastHorizon":   policy.ForecastHorizon,
+				"Cooldown":          policy.Cooldown,
+				"ScaleUpCooldown":   policy.ScaleUpCooldown,
+				"ScaleDownCooldown": policy.ScaleDownCooldown,
+			} {
+				if got != tt.want {
+					t.Errorf("%s = %s, want %s", name, got, tt.want)
+				}
+			}
+			if wantErrs := map[bool]int{true: 5}[tt.wantErr]; len(errs) != wantErrs {
+				t.Errorf("errors = %v, want %d", errs, wantErrs)
+			}
+		})
+	}
+}
+
+// fakePolicies is an in-memory AutoscalerPolicy client whose writes reach
+// the informer through a fake watch, like status updates on a real cluster.
+type fakePolicies struct {
+	mu            sync.Mutex
+	objects       map[string]*v1alpha1.AutoscalerPolicy
+	watcher       *watch.RaceFreeFakeWatcher
+	statusUpdates int
+}
+
+func newFakePolicies(policies ...*v1alpha1.AutoscalerPolicy) *fakePolicies {
+	f := &fakePolicies{objects: map[string]*v1alpha1.AutoscalerPolicy{}, watcher: watch.NewRaceFreeFake()}
+	for _, p := range policies {
+		f.objects[p.Namespace+"/"+p.Name] = p.DeepCopy()
+	}
+	return f
+}
+
+func (f *fakePolicies) AutoscalerPolicies(namespace string) client.AutoscalerPolicyInterface {
+	return &fakePolicyClient{fakePolicies: f, namespace: namespace}
+}
+
+// update replaces a policy, as a spec change by a user would.
+func (f *fakePolicies) update(policy *v1alpha1.AutoscalerPolicy) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.objects[policy.Namespace+"/"+policy.Name] = policy.DeepCopy()
+	f.watcher.Modify(policy.DeepCopy())
+}
+
+func (f *fakePolicies) updates() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.statusUpdates
+}
+
+type fakePolicyClient struct {
+	*fakePolicies
+	namespace string
+}
+
+func (c *fakePolicyClient) Get(ctx context.Context, name string, opts metav1.GetOptions) (*v1alpha1.AutoscalerPolicy, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	p, ok := c.objects[c.namespace+"/"+name]
+	if !ok {
+		return nil, fmt.Errorf("AutoscalerPolicy %s/%s not found", c.namespace, name)
+	}
+	return p.DeepCopy(), nil
+}
+
+func (c *fakePolicyClient) List(ctx context.Context, opts metav1.ListOptions) (*v1alpha1.AutoscalerPolicyList, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	list := &v1alpha1.AutoscalerPolicyList{}
+	for _, p := range c.objects {
+		list.Items = append(list.Items, *p.DeepCopy())
+	}
+	return list, nil
+}
+
+func (c *fakePolicyClient) Watch(ctx context.Context, opts metav1.ListOptions) (watch.Interface, error) {
+	return c.watcher, nil
+}
+
+func (c *fakePolicyClient) UpdateStatus(ctx context.Context, policy *v1alpha1.AutoscalerPolicy, opts metav1.UpdateOptions) (*v1alpha1.AutoscalerPolicy, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.statusUpdates++
+	stored := c.objects[policy.Namespace+"/"+policy.Name].DeepCopy()
+	stored.Status = policy.DeepCopy().Status
+	c.objects[policy.Namespace+"/"+policy.Name] = stored
+	c.watcher.Modify(stored.DeepCopy())
+	return stored.DeepCopy(), nil
+}
+
+// eventually polls condition until it holds or a few seconds have passed.
+func eventually(t *testing.T, description string, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", description)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// TestPolicyStatusUpdateDoesNotReconcile checks that the status a reconcile
+// writes to an AutoscalerPolicy does not enqueue its workload again, and
+// that only spec changes do.
+func TestPolicyStatusUpdateDoesNotReconcile(t *testing.T) {
+	policy := &v1alpha1.AutoscalerPolicy{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "db", Generation: 1},
+		Spec: v1alpha1.AutoscalerPolicySpec{
+			TargetRef: v1alpha1.TargetRef{Kind: "Deployment", Name: "db"},
+			PVC:       &v1alpha1.PVCRules{},
+		},
+	}
+	policies := newFakePolicies(policy)
+	source := newFakeSource()
+	source.setDisk("shop", "data", 50)
+	source.setDisk("shop", "cache", 50)
+	// db falls back to its annotation once the policy no longer targets it
+	objects := append(expandableVolume("shop", "data", "10Gi"), annotatedDeployment("shop", "db", 1, "data"), annotatedDeployment("shop", "web", 1, "cache"))
+	// The StorageClass of the second volume is already there
+	objects = append(objects, expandableVolume("shop", "cache", "10Gi")[1:]...)
+	c, _ := newPolicyController(t, policies, source, newTestConfig(t), Options{PVC: true}, objects...)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	defer c.queue.ShutDown()
+	go c.policyInformer.Run(ctx.Done())
+	c.StartWorkers(ctx)
+
+	// Adding the policy reconciles its target once, which writes the status
+	queries := func() int { _, live := source.counts(); return live }
+	eventually(t, "the status update", func() bool { return policies.updates() == 1 })
+	time.Sleep(500 * time.Millisecond)
+	if n := queries(); n != 1 {
+		t.Fatalf("workload reconciled %d times after the policy was added, want once", n)
+	}
+
+	// A reconcile observing the same usage leaves the status alone
+	c.queue.Add(workloadKey("Deployment", "shop", "db"))
+	eventually(t, "the second reconcile", func() bool { return queries() == 2 })
+	time.Sleep(200 * time.Millisecond)
+	if n := policies.updates(); n != 1 {
+		t.Errorf("status updated %d times, want once for an unchanged status", n)
+	}
+
+	// Retargeting the policy reconciles the old and the new target
+	retargeted := policy.DeepCopy()
+	retargeted.Generation = 2
+	retargeted.Spec.TargetRef.Name = "web"
+	policies.update(retargeted)
+	eventually(t, "the reconciles of both targets", func() bool { return queries() == 4 })
+	time.Sleep(500 * time.Millisecond)
+	if n := queries(); n != 4 {
+		t.Errorf("workloads reconciled %d times after the policy was retargeted, want once each", n-2)
+	}
+}
+
+// TestInvalidPolicyReportedOnce checks that the invalid fields of a policy
+// are reported as an Event once per generation.
+func TestInvalidPolicyReportedOnce(t *testing.T) {
+	invalid := int64(0)
+	policy := &v1alpha1.AutoscalerPolicy{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "web", Generation: 1},
+		Spec: v1alpha1.AutoscalerPolicySpec{
+			TargetRef: v1alpha1.TargetRef{Kind: "Deployment", Name: "web"},
+			Network:   &v1alpha1.NetworkRules{IngressThreshold: &invalid},
+		},
+	}
+	c, _ := newPolicyController(t, newFakePolicies(policy), newFakeSource(), newTestConfig(t), Options{}, annotatedDeployment("shop", "web", 1))
+	recorder := record.NewFakeRecorder(10)
+	c.recorder = recorder
+	if err := c.policyInformer.GetIndexer().Add(policy); err != nil {
+		t.Fatalf("error adding the policy to the informer cache: %v", err)
+	}
+
+	ctx := context.Background()
+	key := workloadKey("Deployment", "shop", "web")
+	reconcile := func() {
+		t.Helper()
+		if err := c.reconcile(ctx, key); err != nil {
+			t.Fatalf("reconcile() error = %v", err)
+		}
+	}
+	reconcile()
+	reconcile()
+	if n := len(recorder.Events); n != 1 {
+		t.Fatalf("%d Events after two reconciles, want 1", n)
+	}
+
+	changed := policy.DeepCopy()
+	changed.Generation = 2
+	if err := c.policyInformer.GetIndexer().Update(changed); err != nil {
+		t.Fatalf("error updating the policy in the informer cache: %v", err)
+	}
+	reconcile()
+	if n := len(recorder.Events); n != 2 {
+		t.Errorf("%d Events after the generation changed, want 2", n)
+	}
+}
+
+func TestStatusUpToDate(t *testing.T) {
+	observed := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	status := func(at time.Time, usage string) v1alpha1.AutoscalerPolicyStatus {
+		return v1alpha1.AutoscalerPolicyStatus{
+			ObservedGeneration: 1,
+			LastObservedUsage: &v1alpha1.ObservedUsage{
+				Time: metav1.NewTime(at),
+				PVCs: []v1alpha1.PVCUsage{{Name: "data", UsagePercent: usage}},
+			},
+		}
+	}
+	current := status(observed, "50.00")
+
+	tests := []struct {
+		name    string
+		updated v1alpha1.AutoscalerPolicyStatus
+		want    bool
+	}{
+		{name: "same observation", updated: status(observed, "50.00"), want: true},
+		{name: "unchanged usage within the interval", updated: status(observed.Add(10*time.Second), "50.00"), want: true},
+		// The observation time is refreshed rather than kept at the old one
+		{name: "unchanged usage after the interval", updated: status(observed.Add(usageStatusInterval), "50.00")},
+		{name: "changed usage", updated: status(observed.Add(10*time.Second), "60.00")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := statusUpToDate(current, tt.updated); got != tt.want {
+				t.Errorf("statusUpToDate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,624 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"k8s-resource-autoscaler/config"
+	"k8s-resource-autoscaler/pkg/kubernetes/annotations"
+	"k8s-resource-autoscaler/pkg/kubernetes/deployment"
+	"k8s-resource-autoscaler/pkg/kubernetes/events"
+	"k8s-resource-autoscaler/pkg/kubernetes/metrics"
+	"k8s-resource-autoscaler/pkg/kubernetes/pvc"
+	"k8s-resource-autoscaler/pkg/kubernetes/statefulset"
+	"k8s-resource-autoscaler/pkg/log"
+	"k8s-resource-autoscaler/pkg/plan"
+	"k8s-resource-autoscaler/pkg/telemetry"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// Action kinds used for per-workload cooldown tracking.
+const (
+	actionResize = "resize"
+	actionScale  = "scale"
+)
+
+// reconcile evaluates a single managed workload identified by its queue key.
+// Settings come from the AutoscalerPolicy targeting the workload, falling
+// back to its annotations when there is none.
+func (c *Controller) reconcile(ctx context.Context, key string) error {
+	kind, namespace, name, err := splitWorkloadKey(key)
+	if err != nil {
+		return err
+	}
+	logger := c.log.With("cycle", c.currentCycle(), strings.ToLower(kind), name, "namespace", namespace)
+	ctx = log.IntoContext(ctx, logger)
+
+	autoscalerPolicy := c.policyFor(key)
+
+	w, err := c.getWorkload(kind, namespace, name)
+	if apierrors.IsNotFound(err) {
+		logger.Info("%s %s/%s no longer exists, skipping.", kind, namespace, name)
+		c.newProblems(key, "", nil)
+		c.forgetResizes(key)
+		if autoscalerPolicy != nil {
+			c.updatePolicyStatus(ctx, autoscalerPolicy, nil, false, nil)
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	result := w.result
+	var overrides annotations.Policy
+	var obs *observation
+	runPVC, runIngress := c.options.PVC, c.options.Ingress
+
+	if autoscalerPolicy != nil {
+		var errs []error
+		overrides, errs = policyFromSpec(autoscalerPolicy.Spec)
+		// The Events are only sent when the generation of the policy changes
+		report := c.newProblems(policyKey(autoscalerPolicy), fmt.Sprintf("%s/%d", autoscalerPolicy.UID, autoscalerPolicy.Generation), errs)
+		for _, err := range errs {
+			logger.Warning("Invalid AutoscalerPolicy %s/%s: %v", autoscalerPolicy.Namespace, autoscalerPolicy.Name, err)
+			if report {
+				c.recorder.Eventf(autoscalerPolicy, corev1.EventTypeWarning, events.ReasonInvalidPolicy, "Ignoring invalid field %v", err)
+			}
+		}
+		runPVC = runPVC && autoscalerPolicy.Spec.PVC != nil
+		runIngress = runIngress && autoscalerPolicy.Spec.Network != nil
+		obs = &observation{}
+		defer func() { c.updatePolicyStatus(ctx, autoscalerPolicy, obs, true, errs) }()
+		logger.Info("%s: %s, Namespace: %s, PVCs: %v, AutoscalerPolicy: %s", result.Kind, result.Deployment, result.Namespace, result.PVCNames, autoscalerPolicy.Name)
+	} else {
+		if !annotations.IsEnabled(w.meta) {
+			return nil
+		}
+		overrides = result.Policy
+		// Report invalid overrides on the workload; the global defaults apply
+		// instead. The Events are only sent when the annotations change.
+		report := c.newProblems(key, string(w.meta.GetUID()), result.PolicyErrors)
+		for _, err := range result.PolicyErrors {
+			logger.Warning("Invalid policy annotation on %s %s/%s: %v", kind, namespace, name, err)
+			if report {
+				c.recorder.Eventf(w.object, corev1.EventTypeWarning, events.ReasonInvalidPolicy, "Ignoring invalid annotation %v", err)
+			}
+		}
+		logger.Info("%s: %s, Namespace: %s, PVCs: %v", result.Kind, result.Deployment, result.Namespace, result.PVCNames)
+	}
+	policy := overrides.WithDefaults(annotations.DefaultPolicy(c.currentConfig()))
+
+	if runPVC {
+		c.reconcilePVCs(ctx, key, w, policy, obs)
+	}
+	if runIngress {
+		if result.Kind != annotations.KindDeployment {
+			logger.Info("Network scaling is only supported for Deployments, skipping %s %s/%s.", kind, namespace, name)
+			return nil
+		}
+		if err := c.reconcileIngress(ctx, key, w, policy, obs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reconcilePVCs resizes the PVCs of a workload whose disk usage exceeds the threshold.
+func (c *Controller) reconcilePVCs(ctx context.Context, key string, w *workload, policy annotations.Policy, obs *observation) {
+	result := w.result
+	cfg := c.currentConfig()
+	logger := log.FromContext(ctx)
+	logger.Info("Checking PVCs for %s %s in namespace %s", result.Kind, result.Deployment, result.Namespace)
+
+	if c.inCooldown(key, actionResize, policy.Cooldown) {
+		logger.Info("%s is in its %s cooldown, skipping PVC checks.", key, policy.Cooldown)
+		for _, pvcName := range result.PVCNames {
+			c.resizeInProgress(logger.With("pvc", pvcName), w, pvcName)
+		}
+		return
+	}
+
+	opts := pvc.ResizeOptions{
+		Strategy:          policy.DiskGrowthStrategy,
+		GrowthPercent:     policy.DiskGrowthPercent,
+		Increment:         policy.DiskGrowthIncrement,
+		TargetUtilization: policy.DiskTargetUtilization,
+		MinStep:           policy.MinPVCStep,
+		RoundToGi:         cfg.PVCGrowth.RoundToGi,
+		MaxSize:           policy.MaxPVCSize,
+		MinInterval:       policy.MinResizeInterval,
+		MaxResizesPerDay:  policy.MaxResizesPerDay,
+	}
+
+	for _, pvcName := range result.PVCNames {
+		logger := logger.With("pvc", pvcName)
+		if c.resizeInProgress(logger, w, pvcName) {
+			continue
+		}
+		// Fetch disk usage percentage using PVC name and namespace
+		diskUsagePercentage, err := c.metricsSource().DiskUsage(ctx, result.Namespace, pvcName)
+		if err != nil {
+			logger.Error("Error fetching disk usage for PVC %s in namespace %s: %v", pvcName, result.Namespace, err)
+			continue
+		}
+
+		logger.Info("Disk usage for PVC %s in namespace %s: %.2f%%", pvcName, result.Namespace, diskUsagePercentage)
+		obs.observePVC(pvcName, diskUsagePercentage)
+
+		// Check if disk usage exceeds threshold (convert to int for comparison)
+		triggered := int(diskUsagePercentage) > policy.DiskResizeThreshold
+		opts.Reason = fmt.Sprintf("disk usage %.2f%% > %d%%", diskUsagePercentage, policy.DiskResizeThreshold)
+		opts.Forecast = nil
+		if policy.ForecastHorizon > 0 {
+			forecast, err := c.forecastDisk(ctx, result.Namespace, pvcName, cfg.PVCGrowth.Forecast.Lookback)
+			if err != nil {
+				logger.Warning("Error forecasting disk usage of PVC %s in namespace %s, using the threshold only: %v", pvcName, result.Namespace, err)
+			} else {
+				if remaining, growing := forecast.TimeToFull(); growing {
+					logger.Info("PVC %s in namespace %s grows by %.2fGi/h and is projected to be full in %s.",
+						pvcName, result.Namespace, forecast.GrowthPerHour()/(1<<30), remaining.Round(time.Minute))
+					if remaining <= policy.ForecastHorizon && !triggered {
+						triggered = true
+						opts.Reason = fmt.Sprintf("projected full in %s at %.2fGi/h, within %s", remaining.Round(time.Minute), forecast.GrowthPerHour()/(1<<30), policy.ForecastHorizon)
+					}
+				}
+				opts.Forecast = &forecast
+				opts.CoverPeriod = cfg.PVCGrowth.Forecast.CoverPeriod
+				opts.ForecastUtilization = policy.DiskResizeThreshold
+			}
+		}
+		// Inode usage is a second trigger, reported separately
+		usagePercent := diskUsagePercentage
+		if policy.InodeThreshold > 0 {
+			inodeUsage, err := c.metricsSource().Query(ctx, metrics.QueryInodeUsage, metrics.Vars{Namespace: result.Namespace, PVC: pvcName})
+			if err != nil {
+				logger.Warning("Error fetching inode usage for PVC %s in namespace %s: %v", pvcName, result.Namespace, err)
+			} else {
+				logger.Info("Inode usage for PVC %s in namespace %s: %.2f%%", pvcName, result.Namespace, inodeUsage)
+				high := int(inodeUsage) > policy.InodeThreshold
+				if c.inodeStateChanged(result.Namespace, pvcName, high) {
+					if high {
+						c.inodeUsageHigh(logger, w, pvcName, inodeUsage, policy)
+					} else {
+						logger.Info("Inode usage for PVC %s in namespace %s is back below the threshold %d%%.", pvcName, result.Namespace, policy.InodeThreshold)
+					}
+				}
+				if high {
+					if policy.InodeAction == annotations.InodeActionResize {
+						if !triggered {
+							triggered = true
+							opts.Reason = fmt.Sprintf("inode usage %.2f%% > %d%%", inodeUsage, policy.InodeThreshold)
+						}
+						if inodeUsage > usagePercent {
+							usagePercent = inodeUsage
+						}
+					}
+				}
+			}
+		}
+		if !triggered {
+			logger.Info("Disk usage for PVC %s is below threshold, no resizing needed.", pvcName)
+			continue
+		}
+		opts.UsagePercent = usagePercent
+
+		if c.options.DryRun {
+			r := pvc.PlanResize(c.clientset, pvcName, result.Namespace, opts)
+			if r.Status != pvc.Resized {
+				c.resizeNotDone(logger, w, pvcName, r, opts.Reason)
+				continue
+			}
+			c.planAction(key, plan.Action{
+				Kind:      plan.ResizePVC,
+				Namespace: result.Namespace,
+				Workload:  result.Deployment,
+				Target:    pvcName,
+				Current:   r.Current.String(),
+				Proposed:  r.Size.String(),
+				Reason:    opts.Reason,
+			})
+			logger.Info("[dry-run] Would resize PVC %s in namespace %s from %s to %s.", pvcName, result.Namespace, r.Current.String(), r.Size.String())
+			continue
+		}
+
+		r := pvc.ResizePVC(c.clientset, pvcName, result.Namespace, opts)
+		c.countResize(result.Namespace, r)
+		if r.Status != pvc.Resized {
+			c.resizeNotDone(logger, w, pvcName, r, opts.Reason)
+			continue
+		}
+		newSize := r.Size
+		if r.Capped {
+			logger.Warning("PVC %s in namespace %s reached its maximum size %s.", pvcName, result.Namespace, opts.MaxSize.String())
+			c.recorder.Eventf(w.object, corev1.EventTypeWarning, events.ReasonPVCMaxSize, "PVC %s was grown to its maximum size %s", pvcName, opts.MaxSize.String())
+		}
+		c.recorder.Eventf(c.pvcObject(w, pvcName), corev1.EventTypeNormal, events.ReasonPVCExpanded,
+			"Expanded from %s to %s: %s", r.Current.String(), newSize.String(), opts.Reason)
+		c.recordAction(key, actionResize)
+		c.forgetPVC(result.Namespace, pvcName)
+		obs.recordAction("PVCResized", pvcName, opts.Reason)
+		logger.Info("Resized PVC %s in namespace %s from %s to %s.", pvcName, result.Namespace, r.Current.String(), newSize.String())
+
+		// New replicas start at the size of the immutable volumeClaimTemplate
+		if template, ok := result.Templates[pvcName]; ok {
+			c.reportTemplateDrift(logger, w, template, pvcName, newSize)
+		}
+
+		// The completion is checked by the reconciles triggered by the
+		// PVC updates, so the worker is free for other workloads meanwhile
+		timeout := cfg.PVCGrowth.ResizeTimeout
+		if timeout <= 0 {
+			timeout = pvc.DefaultResizeTimeout
+		}
+		c.trackResize(key, result.Namespace, pvcName, newSize, timeout)
+	}
+}
+
+// reportTemplateDrift reports a volumeClaimTemplate of a StatefulSet that
+// requests less than the PVC created from it was grown to.
+func (c *Controller) reportTemplateDrift(logger *log.Logger, w *workload, template, pvcName string, size resource.Quantity) {
+	sts, ok := w.object.(*appsv1.StatefulSet)
+	if !ok {
+		return
+	}
+	current, drift, err := statefulset.TemplateDrift(sts, template, size)
+	if err != nil {
+		logger.Error("Error checking the volumeClaimTemplates of statefulset %s in namespace %s: %v", sts.Name, sts.Namespace, err)
+		return
+	}
+	if !drift {
+		return
+	}
+	logger.Warning("volumeClaimTemplate %s of statefulset %s in namespace %s requests %s, but PVC %s was grown to %s; new replicas start smaller.",
+		template, sts.Name, sts.Namespace, current.String(), pvcName, size.String())
+	c.recorder.Eventf(w.object, corev1.EventTypeWarning, events.ReasonTemplateDrift,
+		"volumeClaimTemplate %s requests %s but PVC %s was grown to %s; new replicas start at %s", template, current.String(), pvcName, size.String(), current.String())
+}
+
+// resizeInProgress reports whether a tracked resize of the PVC is still
+// waiting for its volume and filesystem to be expanded. A resize that did not
+// finish within its timeout is reported and no longer tracked; when its
+// filesystem expansion is pending, the pod using the PVC has to be restarted.
+func (c *Controller) resizeInProgress(logger *log.Logger, w *workload, pvcName string) bool {
+	namespace := w.result.Namespace
+	r, ok := c.pendingResizeOf(namespace, pvcName)
+	if !ok {
+		return false
+	}
+	claim, err := c.pvcLister.PersistentVolumeClaims(namespace).Get(pvcName)
+	if err == nil && pvc.ResizeDone(claim, r.size) {
+		c.forgetResize(namespace, pvcName)
+		logger.Info("PVC %s in namespace %s was resized to %s and is ready.", pvcName, namespace, r.size.String())
+		return false
+	}
+	if time.Now().Before(r.deadline) {
+		logger.Info("PVC %s in namespace %s is still being resized to %s, skipping it.", pvcName, namespace, r.size.String())
+		return true
+	}
+
+	c.forgetResize(namespace, pvcName)
+	switch {
+	case err != nil:
+		logger.Error("Error getting PVC %s in namespace %s after resizing it to %s: %v", pvcName, namespace, r.size.String(), err)
+	case pvc.FileSystemResizePending(claim):
+		logger.Warning("PVC %s in namespace %s needs a pod restart to finish its filesystem resize.", pvcName, namespace)
+		c.recorder.Eventf(w.object, corev1.EventTypeWarning, events.ReasonRestartNeeded, "Restart the pod using PVC %s to finish its filesystem resize to %s", pvcName, r.size.String())
+	default:
+		capacity := claim.Status.Capacity[corev1.ResourceStorage]
+		logger.Error("Timed out waiting for PVC %s in namespace %s to grow from %s to %s.", pvcName, namespace, capacity.String(), r.size.String())
+	}
+	return true
+}
+
+// forecastDisk fits the fill rate of a PVC over lookback.
+func (c *Controller) forecastDisk(ctx context.Context, namespace, pvcName string, lookback time.Duration) (pvc.Forecast, error) {
+	source := c.metricsSource()
+	vars := metrics.Vars{Namespace: namespace, PVC: pvcName}
+	capacity, err := source.Query(ctx, metrics.QueryDiskCapacityBytes, vars)
+	if err != nil {
+		return pvc.Forecast{}, fmt.Errorf("error fetching capacity: %v", err)
+	}
+	now := time.Now()
+	samples, err := c.usedBytes(ctx, source, vars, lookback, now)
+	if err != nil {
+		return pvc.Forecast{}, err
+	}
+	return pvc.NewForecast(samples, capacity, now)
+}
+
+// usedBytes returns the used bytes of a PVC over lookback. They are fetched
+// with a range query once per lookback and extended in between with the
+// used bytes of the snapshot, so a cycle issues no range query for PVCs
+// forecast recently.
+func (c *Controller) usedBytes(ctx context.Context, source metrics.MetricsSource, vars metrics.Vars, lookback time.Duration, now time.Time) ([]pvc.Sample, error) {
+	step := lookback / 120
+	if step < time.Minute {
+		step = time.Minute
+	}
+	pvcKey := vars.Namespace + "/" + vars.PVC
+	c.mu.Lock()
+	cached, ok := c.forecasts[pvcKey]
+	c.mu.Unlock()
+
+	var samples []pvc.Sample
+	switch {
+	case !ok || now.Sub(cached.fetched) >= lookback:
+		querier, ok := source.(metrics.RangeQuerier)
+		if !ok {
+			return nil, fmt.Errorf("the metrics source does not support range queries")
+		}
+		points, err := querier.QueryRange(ctx, metrics.QueryDiskUsedBytes, vars, now.Add(-lookback), now, step)
+		if err != nil {
+			return nil, fmt.Errorf("error fetching used bytes: %v", err)
+		}
+		samples = make([]pvc.Sample, 0, len(points))
+		for _, p := range points {
+			samples = append(samples, pvc.Sample{Time: p.Time, Value: p.Value})
+		}
+		cached = forecastSamples{fetched: now}
+	case len(cached.samples) == 0 || now.Sub(cached.samples[len(cached.samples)-1].Time) >= step:
+		used, err := source.Query(ctx, metrics.QueryDiskUsedBytes, vars)
+		if err != nil {
+			return nil, fmt.Errorf("error fetching used bytes: %v", err)
+		}
+		// The cached samples are shared, the appended ones go to a copy
+		samples = make([]pvc.Sample, 0, len(cached.samples)+1)
+		for _, s := range cached.samples {
+			if now.Sub(s.Time) <= lookback {
+				samples = append(samples, s)
+			}
+		}
+		samples = append(samples, pvc.Sample{Time: now, Value: used})
+	default:
+		return cached.samples, nil
+	}
+	cached.samples = samples
+	c.mu.Lock()
+	c.forecasts[pvcKey] = cached
+	c.mu.Unlock()
+	return samples, nil
+}
+
+// countResize exports the outcome of a resize attempt. Skipped attempts only
+// count as attempted.
+func (c *Controller) countResize(namespace string, r pvc.Result) {
+	telemetry.PVCResizesTotal.WithLabelValues(c.options.Cluster, namespace, telemetry.ResultAttempted).Inc()
+	switch r.Status {
+	case pvc.Resized:
+		telemetry.PVCResizesTotal.WithLabelValues(c.options.Cluster, namespace, telemetry.ResultSucceeded).Inc()
+	case pvc.Failed:
+		telemetry.PVCResizesTotal.WithLabelValues(c.options.Cluster, namespace, telemetry.ResultFailed).Inc()
+	}
+}
+
+// resizeNotDone reports a skipped or failed PVC resize, with an Event on the
+// PVC. Reaching the maximum size is also reported on the workload.
+func (c *Controller) resizeNotDone(logger *log.Logger, w *workload, pvcName string, r pvc.Result, reason string) {
+	obj := c.pvcObject(w, pvcName)
+	if r.Status == pvc.Failed {
+		logger.Error("Error resizing PVC %s in namespace %s: %v", pvcName, w.result.Namespace, r.Err)
+		c.recorder.Eventf(obj, corev1.EventTypeWarning, events.ReasonPVCExpansionFailed,
+			"Expansion failed: %v (%s)", r.Err, reason)
+		return
+	}
+	c.recorder.Eventf(obj, corev1.EventTypeWarning, events.ReasonPVCExpansionSkipped,
+		"Expansion skipped (%s): %s (%s)", r.Reason, r.Message, reason)
+	if r.Reason == pvc.SkipMaxSize {
+		logger.Warning("PVC %s in namespace %s needs more space but is already at its maximum size %s.", pvcName, w.result.Namespace, r.Current.String())
+		c.recorder.Eventf(w.object, corev1.EventTypeWarning, events.ReasonPVCMaxSize, "PVC %s needs more space but is already at its maximum size %s", pvcName, r.Current.String())
+		return
+	}
+	logger.Warning("Skipped resizing PVC %s in namespace %s (%s): %s.", pvcName, w.result.Namespace, r.Reason, r.Message)
+}
+
+// inodeUsageHigh reports a PVC whose inode usage went above the threshold,
+// with an Event on the PVC.
+func (c *Controller) inodeUsageHigh(logger *log.Logger, w *workload, pvcName string, usage float64, policy annotations.Policy) {
+	action := "resizing the PVC"
+	if policy.InodeAction == annotations.InodeActionAlert {
+		action = "alert only, growing the volume may not add inodes"
+	}
+	logger.Warning("Inode usage for PVC %s in namespace %s is %.2f%%, above the threshold %d%% (%s).",
+		pvcName, w.result.Namespace, usage, policy.InodeThreshold, action)
+	c.recorder.Eventf(c.pvcObject(w, pvcName), corev1.EventTypeWarning, events.ReasonInodeUsageHigh,
+		"Inode usage %.2f%% exceeds threshold %d%%: %s", usage, policy.InodeThreshold, action)
+}
+
+// pvcObject returns the cached PVC to attach Events to, or the workload when
+// the PVC is not in the cache.
+func (c *Controller) pvcObject(w *workload, pvcName string) runtime.Object {
+	claim, err := c.pvcLister.PersistentVolumeClaims(w.result.Namespace).Get(pvcName)
+	if err != nil {
+		return w.object
+	}
+	return claim
+}
+
+// reconcileIngress scales a Deployment so the average per-pod rate of the
+// policy's scaling metric approaches its target, the way the
+// HorizontalPodAutoscaler does.
+func (c *Controller) reconcileIngress(ctx context.Context, key string, w *workload, policy annotations.Policy, obs *observation) error {
+	result := w.result
+	logger := log.FromContext(ctx)
+	logger.Info("Checking network usage for deployment %s in namespace %s", result.Deployment, result.Namespace)
+
+	// The snapshot rates were measured at the old replica count; scaling
+	// on them again would compound the last scale
+	if c.actedSinceSnapshot(key, actionScale) {
+		logger.Info("%s was scaled after the metrics were fetched, skipping network checks until the next cycle.", key)
+		return nil
+	}
+
+	selector, err := metav1.LabelSelectorAsSelector(w.selector)
+	if err != nil {
+		return err
+	}
+	pods, err := c.podLister.Pods(result.Namespace).List(selector)
+	if err != nil {
+		return err
+	}
+
+	// Sum the rate over the running pods that report network usage
+	var total float64
+	measured := 0
+	for _, pod := range pods {
+		if pod.DeletionTimestamp != nil || pod.Status.Phase != corev1.PodRunning {
+			continue
+		}
+		logger := logger.With("pod", pod.Name)
+
+		ingressBandwidth, egressBandwidth, err := c.metricsSource().NetworkUsage(ctx, result.Namespace, pod.Name)
+		if err != nil {
+			logger.Error("Error fetching network usage for pod %s in namespace %s: %v", pod.Name, result.Namespace, err)
+			continue
+		}
+
+		logger.Debug("Ingress Bandwidth: %.2f bytes/sec, Egress Bandwidth: %.2f bytes/sec for pod %s in namespace %s",
+			ingressBandwidth, egressBandwidth, pod.Name, result.Namespace)
+		obs.observeIngress(ingressBandwidth)
+		total += policy.ScalingMetric.Rate(ingressBandwidth, egressBandwidth)
+		measured++
+	}
+	if measured == 0 {
+		logger.Warning("No network usage available for the pods of deployment %s in namespace %s, skipping scaling.", result.Deployment, result.Namespace)
+		return nil
+	}
+
+	current := int32(1)
+	if d, ok := w.object.(*appsv1.Deployment); ok && d.Spec.Replicas != nil {
+		current = *d.Spec.Replicas
+	}
+	scaling := c.currentConfig().NetworkScaling
+	average := total / float64(measured)
+	target := float64(policy.IngressThreshold)
+	recommended := deployment.ProportionalReplicas(current, average, target, scaling.Tolerance)
+	reason := fmt.Sprintf("average %s %.2f B/s per pod over %d pods vs target %d B/s", policy.ScalingMetric, average, measured, policy.IngressThreshold)
+	logger.Info("Deployment %s in namespace %s: %s, %d replicas recommended of %d.", result.Deployment, result.Namespace, reason, recommended, current)
+
+	// Stabilize against the recent recommendations and limit the rate of
+	// change before recording this recommendation. Only the periodic cycle
+	// records recommendations, so informer events do not fill the window.
+	up, down := scalingRules(scaling.ScaleUp), scalingRules(scaling.ScaleDown)
+	up.Cooldown, down.Cooldown = policy.ScaleUpCooldown, policy.ScaleDownCooldown
+	// The cooldown between any two actions bounds both directions, and
+	// counts from the persisted scale events like theirs
+	if policy.Cooldown > up.Cooldown {
+		up.Cooldown = policy.Cooldown
+	}
+	if policy.Cooldown > down.Cooldown {
+		down.Cooldown = policy.Cooldown
+	}
+	retention := historyRetention(up, down)
+	record := !c.options.DryRun && c.inCycle(key)
+	now := time.Now()
+	var desired int32
+	var cooling bool
+	c.history.Update(key, retention, func(h *deployment.History) {
+		desired = h.Stabilize(now, current, recommended, up, down)
+		desired = h.Limit(now, current, desired, up, down)
+		cooling = h.InCooldown(now, current, desired, up, down)
+		if record {
+			h.Recommend(now, recommended)
+		}
+	})
+	if desired != recommended {
+		logger.Info("Holding deployment %s in namespace %s at %d replicas instead of %d (stabilization window and rate limits).",
+			result.Deployment, result.Namespace, desired, recommended)
+	}
+	if desired == current {
+		return nil
+	}
+	// The cooldowns count from the persisted scale events, so they hold
+	// across restarts
+	if cooling && desired > current {
+		logger.Info("%s is in its %s scale-up cooldown, not scaling up to %d replicas.", key, up.Cooldown, desired)
+		return nil
+	}
+	if cooling {
+		logger.Info("%s is in its %s scale-down cooldown, not scaling down to %d replicas.", key, down.Cooldown, desired)
+		return nil
+	}
+
+	bounds := deployment.Bounds{Min: policy.MinReplicas, Max: policy.MaxReplicas}
+	if c.options.DryRun {
+		change, err := deployment.PlanScale(ctx, c.clientset, result.Namespace, result.Deployment, desired, bounds)
+		if err != nil {
+			logger.Error("Error planning scale of deployment %s in namespace %s: %v", result.Deployment, result.Namespace, err)
+			return nil
+		}
+		if change.Current != change.Desired {
+			c.planAction(key, plan.Action{
+				Kind:      plan.Scale,
+				Namespace: result.Namespace,
+				Workload:  result.Deployment,
+				Target:    change.Deployment,
+				Current:   fmt.Sprintf("%d", change.Current),
+				Proposed:  fmt.Sprintf("%d", change.Desired),
+				Reason:    reason,
+			})
+			logger.Info("[dry-run] Would scale deployment %s in namespace %s from %d to %d replicas.", result.Deployment, result.Namespace, change.Current, change.Desired)
+		}
+		return nil
+	}
+
+	change, err := deployment.ScalePod(ctx, c.clientset, result.Namespace, result.Deployment, desired, bounds)
+	if err != nil {
+		telemetry.ScaleOperationsTotal.WithLabelValues(c.options.Cluster, result.Namespace, telemetry.ResultFailure).Inc()
+		logger.Error("Error scaling deployment %s in namespace %s: %v", result.Deployment, result.Namespace, err)
+		c.recorder.Eventf(w.object, corev1.EventTypeWarning, events.ReasonScaleFailed,
+			"Scaling to %d replicas failed: %v (%s)", desired, err, reason)
+		return nil
+	}
+	if change.Current == change.Desired {
+		return nil
+	}
+	telemetry.ScaleOperationsTotal.WithLabelValues(c.options.Cluster, result.Namespace, telemetry.ResultSuccess).Inc()
+	eventReason := events.ReasonScaledUp
+	if change.Desired < change.Current {
+		eventReason = events.ReasonScaledDown
+	}
+	c.recorder.Eventf(w.object, corev1.EventTypeNormal, eventReason,
+		"Scaled from %d to %d replicas: %s", change.Current, change.Desired, reason)
+	c.recordAction(key, actionScale)
+	c.history.Update(key, retention, func(h *deployment.History) {
+		h.RecordScale(now, change.Current, change.Desired)
+	})
+	obs.recordAction("Scaled", result.Deployment, fmt.Sprintf("%s, scaled from %d to %d replicas", reason, change.Current, change.Desired))
+	return nil
+}
+
+// scalingRules converts the configured rules of a scaling direction.
+func scalingRules(cfg config.ScalingRulesConfig) deployment.ScalingRules {
+	return deployment.ScalingRules{
+		StabilizationWindow: cfg.StabilizationWindow,
+		MaxPods:             int32(cfg.MaxPods),
+		MaxPercent:          int32(cfg.MaxPercent),
+		Period:              cfg.Period,
+		Cooldown:            cfg.Cooldown,
+	}
+}
+
+// historyRetention returns how long scaling history is needed by the rules.
+func historyRetention(rules ...deployment.ScalingRules) time.Duration {
+	var keep time.Duration
+	for _, r := range rules {
+		if r.StabilizationWindow > keep {
+			keep = r.StabilizationWindow
+		}
+		if r.Period > keep {
+			keep = r.Period
+		}
+		if r.Cooldown > keep {
+			keep = r.Cooldown
+		}
+	}
+	return keep
+}
@@ -0,0 +1,112 @@
+package controller
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s-resource-autoscaler/pkg/kubernetes/annotations"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// workloadKey returns the queue key "Kind/namespace/name" of a workload.
+func workloadKey(kind, namespace, name string) string {
+	return kind + "/" + namespace + "/" + name
+}
+
+// splitWorkloadKey splits a queue key built by workloadKey.
+func splitWorkloadKey(key string) (kind, namespace, name string, err error) {
+	parts := strings.Split(key, "/")
+	if len(parts) != 3 {
+		return "", "", "", fmt.Errorf("unexpected workload key %q", key)
+	}
+	return parts[0], parts[1], parts[2], nil
+}
+
+// workload is a Deployment or StatefulSet looked up from the informer cache.
+type workload struct {
+	key      string
+	object   runtime.Object
+	meta     metav1.Object
+	selector *metav1.LabelSelector
+	// result is built without checking for the autoscaler annotation.
+	result annotations.DeploymentResult
+}
+
+// newWorkload wraps a Deployment or StatefulSet. It returns nil for any
+// other object.
+func newWorkload(obj interface{}) *workload {
+	switch o := obj.(type) {
+	case *appsv1.Deployment:
+		return &workload{
+			key:      workloadKey(annotations.KindDeployment, o.Namespace, o.Name),
+			object:   o,
+			meta:     o,
+			selector: o.Spec.Selector,
+			result:   annotations.NewDeploymentResult(o),
+		}
+	case *appsv1.StatefulSet:
+		return &workload{
+			key:      workloadKey(annotations.KindStatefulSet, o.Namespace, o.Name),
+			object:   o,
+			meta:     o,
+			selector: o.Spec.Selector,
+			result:   annotations.NewStatefulSetResult(o),
+		}
+	}
+	return nil
+}
+
+// getWorkload looks up the workload with the given kind from the informer cache.
+func (c *Controller) getWorkload(kind, namespace, name string) (*workload, error) {
+	switch kind {
+	case annotations.KindDeployment:
+		d, err := c.deploymentLister.Deployments(namespace).Get(name)
+		if err != nil {
+			return nil, err
+		}
+		return newWorkload(d), nil
+	case annotations.KindStatefulSet:
+		sts, err := c.statefulSetLister.StatefulSets(namespace).Get(name)
+		if err != nil {
+			return nil, err
+		}
+		return newWorkload(sts), nil
+	}
+	return nil, fmt.Errorf("unsupported workload kind %q", kind)
+}
+
+// listWorkloads returns every Deployment and StatefulSet in the namespace,
+// or in all namespaces when namespace is empty.
+func (c *Controller) listWorkloads(namespace string) ([]*workload, error) {
+	var workloads []*workload
+
+	var deployments []*appsv1.Deployment
+	var statefulSets []*appsv1.StatefulSet
+	var err error
+	if namespace == metav1.NamespaceAll {
+		deployments, err = c.deploymentLister.List(everything)
+	} else {
+		deployments, err = c.deploymentLister.Deployments(namespace).List(everything)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if namespace == metav1.NamespaceAll {
+		statefulSets, err = c.statefulSetLister.List(everything)
+	} else {
+		statefulSets, err = c.statefulSetLister.StatefulSets(namespace).List(everything)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, d := range deployments {
+		workloads = append(workloads, newWorkload(d))
+	}
+	for _, sts := range statefulSets {
+		workloads = append(workloads, newWorkload(sts))
+	}
+	return workloads, nil
+}
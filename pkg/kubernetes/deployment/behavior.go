@@ -0,0 +1,195 @@
+package deployment
+
+import (
+	"math"
+	"time"
+)
+
+// ScalingRules limit how fast replicas change in one direction.
+type ScalingRules struct {
+	// StabilizationWindow is how far back recommendations are considered.
+	// Scaling down uses the highest recommendation in the window, scaling
+	// up the lowest.
+	StabilizationWindow time.Duration
+	// MaxPods and MaxPercent bound the change within Period. When both are
+	// set the larger change is allowed. Zero means unlimited.
+	MaxPods    int32
+	MaxPercent int32
+	Period     time.Duration
+	// Cooldown is the minimum time since the last scale event, in either
+	// direction, before scaling in this direction.
+	Cooldown time.Duration
+}
+
+// Recommendation is a replica count computed from the metrics at a time.
+type Recommendation struct {
+	Time     time.Time `json:"time"`
+	Replicas int32     `json:"replicas"`
+}
+
+// ScaleEvent is a change of the replica count made by the autoscaler.
+type ScaleEvent struct {
+	Time time.Time `json:"time"`
+	From int32     `json:"from"`
+	To   int32     `json:"to"`
+}
+
+// History holds the recent recommendations and scale events of a deployment.
+type History struct {
+	Recommendations []Recommendation `json:"recommendations,omitempty"`
+	Events          []ScaleEvent     `json:"events,omitempty"`
+}
+
+// Recommend records a recommendation.
+func (h *History) Recommend(now time.Time, replicas int32) {
+	h.Recommendations = append(h.Recommendations, Recommendation{Time: now, Replicas: replicas})
+}
+
+// RecordScale records a change of the replica count.
+func (h *History) RecordScale(now time.Time, from, to int32) {
+	h.Events = append(h.Events, ScaleEvent{Time: now, From: from, To: to})
+}
+
+// Prune drops the entries older than keep.
+func (h *History) Prune(now time.Time, keep time.Duration) {
+	cutoff := now.Add(-keep)
+	recommendations := h.Recommendations[:0]
+	for _, r := range h.Recommendations {
+		if r.Time.After(cutoff) {
+			recommendations = append(recommendations, r)
+		}
+	}
+	h.Recommendations = recommendations
+	events := h.Events[:0]
+	for _, e := range h.Events {
+		if e.Time.After(cutoff) {
+			events = append(events, e)
+		}
+	}
+	h.Events = events
+}
+
+// Stabilize returns the replica count to move to from current given the
+// latest recommendation desired, the way the HorizontalPodAutoscaler
+// stabilizes: scaling down only goes as low as the highest recommendation
+// within the scale-down window, and scaling up only as high as the lowest
+// recommendation within the scale-up window.
+func (h History) Stabilize(now time.Time, current, desired int32, up, down ScalingRules) int32 {
+	upRecommendation, downRecommendation := desired, desired
+	for _, r := range h.Recommendations {
+		age := now.Sub(r.Time)
+		if age < up.StabilizationWindow && r.Replicas < upRecommendation {
+			upRecommendation = r.Replicas
+		}
+		if age < down.StabilizationWindow && r.Replicas > downRecommendation {
+			downRecommendation = r.Replicas
+		}
+	}
+
+	replicas := current
+	if replicas < upRecommendation {
+		replicas = upRecommendation
+	}
+	if replicas > downRecommendation {
+		replicas = downRecommendation
+	}
+	return replicas
+}
+
+// InCooldown reports whether the move from current to desired is held back
+// by the cooldown of its direction.
+func (h History) InCooldown(now time.Time, current, desired int32, up, down ScalingRules) bool {
+	cooldown := up.Cooldown
+	if desired < current {
+		cooldown = down.Cooldown
+	}
+	if desired == current || cooldown <= 0 {
+		return false
+	}
+	for _, e := range h.Events {
+		if now.Sub(e.Time) < cooldown {
+			return true
+		}
+	}
+	return false
+}
+
+// Limit bounds the move from current to desired by the rate limits of the
+// direction, counting the scale events within their period.
+func (h History) Limit(now time.Time, current, desired int32, up, down ScalingRules) int32 {
+	switch {
+	case desired > current:
+		if limit, ok := h.maxReplicas(now, current, up); ok && desired > limit {
+			return limit
+		}
+	case desired < current:
+		if limit, ok := h.minReplicas(now, current, down); ok && desired < limit {
+			return limit
+		}
+	}
+	return desired
+}
+
+// maxReplicas returns the highest replica count scaling up may reach.
+func (h History) maxReplicas(now time.Time, current int32, rules ScalingRules) (int32, bool) {
+	if rules.MaxPods <= 0 && rules.MaxPercent <= 0 {
+		return 0, false
+	}
+	// The count at the start of the period, before the pods added since
+	start := current - h.changed(now, rules.Period, true)
+	if start < 0 {
+		start = 0
+	}
+	limit := int32(0)
+	if rules.MaxPods > 0 {
+		limit = start + rules.MaxPods
+	}
+	if rules.MaxPercent > 0 {
+		if byPercent := int32(math.Ceil(float64(start) * (1 + float64(rules.MaxPercent)/100))); byPercent > limit {
+			limit = byPercent
+		}
+	}
+	if limit < current {
+		limit = current
+	}
+	return limit, true
+}
+
+// minReplicas returns the lowest replica count scaling down may reach.
+func (h History) minReplicas(now time.Time, current int32, rules ScalingRules) (int32, bool) {
+	if rules.MaxPods <= 0 && rules.MaxPercent <= 0 {
+		return 0, false
+	}
+	// The count at the start of the period, before the pods removed since
+	start := current + h.changed(now, rules.Period, false)
+	limit := int32(math.MaxInt32)
+	if rules.MaxPods > 0 {
+		limit = start - rules.MaxPods
+	}
+	if rules.MaxPercent > 0 {
+		if byPercent := int32(math.Floor(float64(start) * (1 - float64(rules.MaxPercent)/100))); byPercent < limit {
+			limit = byPercent
+		}
+	}
+	if limit > current {
+		limit = current
+	}
+	return limit, true
+}
+
+// changed returns the number of pods added (up) or removed within period.
+func (h History) changed(now time.Time, period time.Duration, up bool) int32 {
+	var n int32
+	for _, e := range h.Events {
+		if now.Sub(e.Time) >= period {
+			continue
+		}
+		if up && e.To > e.From {
+			n += e.To - e.From
+		}
+		if !up && e.To < e.From {
+			n += e.From - e.To
+		}
+	}
+	return n
+}
@@ -0,0 +1,196 @@
+package deployment
+
+import (
+	"testing"
+	"time"
+)
+
+var behaviorNow = time.Date(2024, 1, 2, 12, 0, 0, 0, time.UTC)
+
+// ago returns the time d before behaviorNow.
+func ago(d time.Duration) time.Time {
+	return behaviorNow.Add(-d)
+}
+
+func TestStabilize(t *testing.T) {
+	tests := []struct {
+		name            string
+		recommendations []Recommendation
+		current         int32
+		desired         int32
+		upWindow        time.Duration
+		want            int32
+	}{
+		{name: "no history", current: 10, desired: 4, want: 4},
+		{name: "unchanged", current: 5, desired: 5, recommendations: []Recommendation{{ago(time.Minute), 8}}, want: 5},
+		{
+			name:            "scale down to the highest recommendation in the window",
+			recommendations: []Recommendation{{ago(time.Minute), 8}, {ago(2 * time.Minute), 6}, {ago(10 * time.Minute), 12}},
+			current:         10,
+			desired:         4,
+			want:            8,
+		},
+		{
+			name:            "scale down held at current",
+			recommendations: []Recommendation{{ago(time.Minute), 11}},
+			current:         10,
+			desired:         4,
+			want:            10,
+		},
+		{
+			name:            "scale up without a window",
+			recommendations: []Recommendation{{ago(time.Minute), 2}},
+			current:         4,
+			desired:         10,
+			want:            10,
+		},
+		{
+			name:            "scale up to the lowest recommendation in the window",
+			recommendations: []Recommendation{{ago(time.Minute), 6}, {ago(5 * time.Minute), 2}},
+			current:         4,
+			desired:         10,
+			upWindow:        3 * time.Minute,
+			want:            6,
+		},
+		{
+			name:            "recommendation at the window edge",
+			recommendations: []Recommendation{{ago(5 * time.Minute), 9}},
+			current:         10,
+			desired:         4,
+			want:            4,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := History{Recommendations: tt.recommendations}
+			up := ScalingRules{StabilizationWindow: tt.upWindow}
+			down := ScalingRules{StabilizationWindow: 5 * time.Minute}
+			if got := h.Stabilize(behaviorNow, tt.current, tt.desired, up, down); got != tt.want {
+				t.Errorf("Stabilize(%d -> %d) = %d, want %d", tt.current, tt.desired, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLimit(t *testing.T) {
+	tests := []struct {
+		name    string
+		events  []ScaleEvent
+		rules   ScalingRules
+		current int32
+		desired int32
+		want    int32
+	}{
+		{name: "unlimited up", rules: ScalingRules{Period: time.Minute}, current: 4, desired: 20, want: 20},
+		{name: "unlimited down", rules: ScalingRules{Period: time.Minute}, current: 20, desired: 1, want: 1},
+		{name: "unchanged", rules: ScalingRules{MaxPods: 1, Period: time.Minute}, current: 4, desired: 4, want: 4},
+		{name: "max pods up", rules: ScalingRules{MaxPods: 4, Period: time.Minute}, current: 4, desired: 20, want: 8},
+		{name: "max percent up", rules: ScalingRules{MaxPercent: 100, Period: time.Minute}, current: 4, desired: 20, want: 8},
+		{name: "max percent up rounds up", rules: ScalingRules{MaxPercent: 10, Period: time.Minute}, current: 4, desired: 20, want: 5},
+		{name: "larger change up", rules: ScalingRules{MaxPods: 10, MaxPercent: 50, Period: time.Minute}, current: 4, desired: 20, want: 14},
+		{name: "within the limit up", rules: ScalingRules{MaxPods: 10, Period: time.Minute}, current: 4, desired: 6, want: 6},
+		{
+			name:    "pods added within the period count",
+			events:  []ScaleEvent{{Time: ago(30 * time.Second), From: 4, To: 6}},
+			rules:   ScalingRules{MaxPods: 4, Period: time.Minute},
+			current: 6,
+			desired: 20,
+			want:    8,
+		},
+		{
+			name:    "limit already used up",
+			events:  []ScaleEvent{{Time: ago(30 * time.Second), From: 4, To: 8}},
+			rules:   ScalingRules{MaxPods: 4, Period: time.Minute},
+			current: 8,
+			desired: 20,
+			want:    8,
+		},
+		{
+			name:    "events before the period do not count",
+			events:  []ScaleEvent{{Time: ago(2 * time.Minute), From: 4, To: 8}},
+			rules:   ScalingRules{MaxPods: 4, Period: time.Minute},
+			current: 8,
+			desired: 20,
+			want:    12,
+		},
+		{name: "max pods down", rules: ScalingRules{MaxPods: 2, Period: time.Minute}, current: 10, desired: 2, want: 8},
+		{name: "max percent down", rules: ScalingRules{MaxPercent: 50, Period: time.Minute}, current: 10, desired: 2, want: 5},
+		{name: "max percent down rounds down", rules: ScalingRules{MaxPercent: 10, Period: time.Minute}, current: 5, desired: 1, want: 4},
+		{name: "larger change down", rules: ScalingRules{MaxPods: 2, MaxPercent: 50, Period: time.Minute}, current: 10, desired: 2, want: 5},
+		{
+			name:    "pods removed within the period count",
+			events:  []ScaleEvent{{Time: ago(30 * time.Second), From: 12, To: 10}},
+			rules:   ScalingRules{MaxPods: 4, Period: time.Minute},
+			current: 10,
+			desired: 2,
+			want:    8,
+		},
+		{
+			name:    "scaling up does not count against scaling down",
+			events:  []ScaleEvent{{Time: ago(30 * time.Second), From: 6, To: 10}},
+			rules:   ScalingRules{MaxPods: 4, Period: time.Minute},
+			current: 10,
+			desired: 2,
+			want:    6,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := History{Events: tt.events}
+			// The rules apply to the direction of the move only
+			up, down := tt.rules, ScalingRules{MaxPods: 1, Period: time.Minute}
+			if tt.desired < tt.current {
+				up, down = ScalingRules{MaxPods: 1, Period: time.Minute}, tt.rules
+			}
+			if got := h.Limit(behaviorNow, tt.current, tt.desired, up, down); got != tt.want {
+				t.Errorf("Limit(%d -> %d) = %d, want %d", tt.current, tt.desired, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInCooldown(t *testing.T) {
+	up := ScalingRules{Cooldown: 3 * time.Minute}
+	down := ScalingRules{Cooldown: 10 * time.Minute}
+	tests := []struct {
+		name    string
+		events  []ScaleEvent
+		current int32
+		desired int32
+		want    bool
+	}{
+		{name: "never scaled", current: 4, desired: 8},
+		{name: "scale up within its cooldown", events: []ScaleEvent{{Time: ago(time.Minute), From: 2, To: 4}}, current: 4, desired: 8, want: true},
+		{name: "scale up after its cooldown", events: []ScaleEvent{{Time: ago(5 * time.Minute), From: 2, To: 4}}, current: 4, desired: 8},
+		{name: "scale down within its cooldown", events: []ScaleEvent{{Time: ago(5 * time.Minute), From: 2, To: 4}}, current: 4, desired: 2, want: true},
+		{name: "scale down after its cooldown", events: []ScaleEvent{{Time: ago(15 * time.Minute), From: 2, To: 4}}, current: 4, desired: 2},
+		{name: "unchanged", events: []ScaleEvent{{Time: ago(time.Minute), From: 2, To: 4}}, current: 4, desired: 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := History{Events: tt.events}
+			if got := h.InCooldown(behaviorNow, tt.current, tt.desired, up, down); got != tt.want {
+				t.Errorf("InCooldown(%d -> %d) = %t, want %t", tt.current, tt.desired, got, tt.want)
+			}
+		})
+	}
+
+	h := History{Events: []ScaleEvent{{Time: ago(time.Second), From: 2, To: 4}}}
+	if h.InCooldown(behaviorNow, 4, 8, ScalingRules{}, down) {
+		t.Error("InCooldown() without a scale-up cooldown = true, want false")
+	}
+}
+
+func TestPrune(t *testing.T) {
+	h := History{
+		Recommendations: []Recommendation{{ago(10 * time.Minute), 2}, {ago(time.Minute), 4}},
+		Events:          []ScaleEvent{{Time: ago(10 * time.Minute), From: 1, To: 2}, {Time: ago(time.Minute), From: 2, To: 4}},
+	}
+	h.Prune(behaviorNow, 5*time.Minute)
+	if len(h.Recommendations) != 1 || h.Recommendations[0].Replicas != 4 {
+		t.Errorf("recommendations after Prune() = %+v, want the one from a minute ago", h.Recommendations)
+	}
+	if len(h.Events) != 1 || h.Events[0].To != 4 {
+		t.Errorf("events after Prune() = %+v, want the one from a minute ago", h.Events)
+	}
+}
@@ -12,7 +12,7 @@ type Pod struct {
 }
 
 // GetPodsForDeployment retrieves the pods associated with a given deployment
-func GetPodsForDeployment(clientset *kubernetes.Clientset, deploymentName, namespace string) ([]Pod, error) {
+func GetPodsForDeployment(clientset kubernetes.Interface, deploymentName, namespace string) ([]Pod, error) {
 	deployment, err := clientset.AppsV1().Deployments(namespace).Get(context.TODO(), deploymentName, metav1.GetOptions{}) // Use metav1.GetOptions
 	if err != nil {
 		return nil, err
@@ -0,0 +1,137 @@
+package deployment
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// historyKey is the ConfigMap key holding the histories as JSON.
+const historyKey = "history.json"
+
+// HistoryStore keeps the scaling history of every deployment in memory and
+// persists it to a ConfigMap so it survives restarts.
+type HistoryStore struct {
+	clientset kubernetes.Interface
+	namespace string
+	name      string
+
+	mu        sync.Mutex
+	histories map[string]*History
+	dirty     bool
+}
+
+// NewHistoryStore returns a store persisted to the ConfigMap namespace/name.
+func NewHistoryStore(clientset kubernetes.Interface, namespace, name string) *HistoryStore {
+	return &HistoryStore{
+		clientset: clientset,
+		namespace: namespace,
+		name:      name,
+		histories: map[string]*History{},
+	}
+}
+
+// Load replaces the histories in memory with the persisted ones. A missing
+// ConfigMap leaves the store empty.
+func (s *HistoryStore) Load(ctx context.Context) error {
+	cm, err := s.clientset.CoreV1().ConfigMaps(s.namespace).Get(ctx, s.name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error reading scaling history %s/%s: %v", s.namespace, s.name, err)
+	}
+
+	histories := map[string]*History{}
+	if data := cm.Data[historyKey]; data != "" {
+		if err := json.Unmarshal([]byte(data), &histories); err != nil {
+			return fmt.Errorf("error parsing scaling history %s/%s: %v", s.namespace, s.name, err)
+		}
+	}
+	s.mu.Lock()
+	s.histories = histories
+	s.dirty = false
+	s.mu.Unlock()
+	return nil
+}
+
+// Update calls fn with the history of key, pruned to keep, while holding
+// the store's lock. A history left empty is dropped.
+func (s *HistoryStore) Update(key string, keep time.Duration, fn func(h *History)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	h, ok := s.histories[key]
+	if !ok {
+		h = &History{}
+	}
+	h.Prune(time.Now(), keep)
+	fn(h)
+	if len(h.Recommendations) == 0 && len(h.Events) == 0 {
+		if ok {
+			delete(s.histories, key)
+			s.dirty = true
+		}
+		return
+	}
+	s.histories[key] = h
+	s.dirty = true
+}
+
+// Retain drops the histories of the keys not in keys, such as those of
+// deleted deployments.
+func (s *HistoryStore) Retain(keys map[string]struct{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key := range s.histories {
+		if _, ok := keys[key]; !ok {
+			delete(s.histories, key)
+			s.dirty = true
+		}
+	}
+}
+
+// Save writes the histories to the ConfigMap when they changed since the
+// last Load or Save.
+func (s *HistoryStore) Save(ctx context.Context) error {
+	s.mu.Lock()
+	if !s.dirty {
+		s.mu.Unlock()
+		return nil
+	}
+	data, err := json.Marshal(s.histories)
+	s.dirty = false
+	s.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("error encoding scaling history: %v", err)
+	}
+
+	configMaps := s.clientset.CoreV1().ConfigMaps(s.namespace)
+	cm, err := configMaps.Get(ctx, s.name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		cm = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: s.namespace, Name: s.name},
+			Data:       map[string]string{historyKey: string(data)},
+		}
+		_, err = configMaps.Create(ctx, cm, metav1.CreateOptions{})
+	} else if err == nil {
+		if cm.Data == nil {
+			cm.Data = map[string]string{}
+		}
+		cm.Data[historyKey] = string(data)
+		_, err = configMaps.Update(ctx, cm, metav1.UpdateOptions{})
+	}
+	if err != nil {
+		s.mu.Lock()
+		s.dirty = true
+		s.mu.Unlock()
+		return fmt.Errorf("error saving scaling history %s/%s: %v", s.namespace, s.name, err)
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+package deployment
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// writes counts the ConfigMap creates and updates sent to clientset.
+func writes(clientset *fake.Clientset) int {
+	n := 0
+	for _, action := range clientset.Actions() {
+		if action.GetVerb() == "create" || action.GetVerb() == "update" {
+			n++
+		}
+	}
+	return n
+}
+
+// equalHistory reports whether a and b hold the same entries at the same
+// instants.
+func equalHistory(a, b History) bool {
+	if len(a.Recommendations) != len(b.Recommendations) || len(a.Events) != len(b.Events) {
+		return false
+	}
+	for i, r := range a.Recommendations {
+		if !r.Time.Equal(b.Recommendations[i].Time) || r.Replicas != b.Recommendations[i].Replicas {
+			return false
+		}
+	}
+	for i, e := range a.Events {
+		if !e.Time.Equal(b.Events[i].Time) || e.From != b.Events[i].From || e.To != b.Events[i].To {
+			return false
+		}
+	}
+	return true
+}
+
+func TestHistoryStoreRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	clientset := fake.NewSimpleClientset()
+	now := time.Now().Truncate(time.Second)
+
+	store := NewHistoryStore(clientset, "autoscaler", "scaling-history")
+	if err := store.Load(ctx); err != nil {
+		t.Fatalf("Load() without the ConfigMap error = %v", err)
+	}
+	store.Update("Deployment/shop/web", time.Hour, func(h *History) {
+		h.Recommend(now, 4)
+		h.RecordScale(now, 2, 4)
+	})
+	store.Update("Deployment/shop/api", time.Hour, func(h *History) {
+		h.Recommend(now, 3)
+	})
+	if err := store.Save(ctx); err != nil {
+		t.Fatalf("Save() creating the ConfigMap error = %v", err)
+	}
+	// The second save updates the ConfigMap
+	store.Update("Deployment/shop/api", time.Hour, func(h *History) {
+		h.Recommend(now, 5)
+	})
+	if err := store.Save(ctx); err != nil {
+		t.Fatalf("Save() updating the ConfigMap error = %v", err)
+	}
+	if n := writes(clientset); n != 2 {
+		t.Errorf("saves sent %d writes, want 2", n)
+	}
+
+	restored := NewHistoryStore(clientset, "autoscaler", "scaling-history")
+	if err := restored.Load(ctx); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	want := map[string]*History{
+		"Deployment/shop/web": {
+			Recommendations: []Recommendation{{Time: now, Replicas: 4}},
+			Events:          []ScaleEvent{{Time: now, From: 2, To: 4}},
+		},
+		"Deployment/shop/api": {
+			Recommendations: []Recommendation{{Time: now, Replicas: 3}, {Time: now, Replicas: 5}},
+		},
+	}
+	if len(restored.histories) != len(want) {
+		t.Fatalf("restored %d histories, want %d", len(restored.histories), len(want))
+	}
+	for key, h := range want {
+		got := restored.histories[key]
+		if got == nil || !equalHistory(*got, *h) {
+			t.Errorf("restored history of %s = %+v, want %+v", key, got, h)
+		}
+	}
+
+	// Nothing changed since the load, so nothing is written
+	if err := restored.Save(ctx); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if n := writes(clientset); n != 2 {
+		t.Errorf("an unchanged store sent %d writes, want none after the first 2", n-2)
+	}
+}
+
+func TestHistoryStoreLoadErrors(t *testing.T) {
+	clientset := fake.NewSimpleClientset(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "autoscaler", Name: "scaling-history"},
+		Data:       map[string]string{historyKey: "{not json"},
+	})
+	if err := NewHistoryStore(clientset, "autoscaler", "scaling-history").Load(context.Background()); err == nil {
+		t.Error("Load() of a corrupt history succeeded, want an error")
+	}
+}
+
+func TestHistoryStoreSaveRetries(t *testing.T) {
+	ctx := context.Background()
+	clientset := fake.NewSimpleClientset()
+	fail := true
+	clientset.PrependReactor("create", "configmaps", func(k8stesting.Action) (bool, runtime.Object, error) {
+		if fail {
+			return true, nil, errors.New("etcd unavailable")
+		}
+		return false, nil, nil
+	})
+
+	store := NewHistoryStore(clientset, "autoscaler", "scaling-history")
+	store.Update("Deployment/shop/web", time.Hour, func(h *History) { h.Recommend(time.Now(), 4) })
+	if err := store.Save(ctx); err == nil {
+		t.Fatal("Save() with a failing API server succeeded, want an error")
+	}
+	fail = false
+	if err := store.Save(ctx); err != nil {
+		t.Fatalf("Save() after the failure error = %v", err)
+	}
+	if _, err := clientset.CoreV1().ConfigMaps("autoscaler").Get(ctx, "scaling-history", metav1.GetOptions{}); err != nil {
+		t.Errorf("the history was not saved after the failure: %v", err)
+	}
+}
+
+func TestHistoryStorePrunesKeys(t *testing.T) {
+	store := NewHistoryStore(fake.NewSimpleClientset(), "autoscaler", "scaling-history")
+	now := time.Now()
+	store.Update("Deployment/shop/old", time.Hour, func(h *History) { h.Recommend(now.Add(-2*time.Hour), 2) })
+	store.Update("Deployment/shop/web", time.Hour, func(h *History) { h.Recommend(now, 4) })
+	store.Update("Deployment/shop/api", time.Hour, func(h *History) { h.Recommend(now, 3) })
+	store.Update("Deployment/shop/idle", time.Hour, func(h *History) {})
+
+	// Pruning within keep leaves nothing of old
+	store.Update("Deployment/shop/old", time.Hour, func(h *History) {})
+	for _, key := range []string{"Deployment/shop/old", "Deployment/shop/idle"} {
+		if _, ok := store.histories[key]; ok {
+			t.Errorf("the empty history of %s was kept", key)
+		}
+	}
+
+	store.Retain(map[string]struct{}{"Deployment/shop/web": {}, "Deployment/shop/new": {}})
+	if len(store.histories) != 1 || store.histories["Deployment/shop/web"] == nil {
+		t.Errorf("histories after Retain() = %v, want only Deployment/shop/web", store.histories)
+	}
+}
@@ -0,0 +1,61 @@
+package deployment
+
+import (
+	"fmt"
+	"math"
+)
+
+// ScalingMetric selects the network rate replicas are computed from.
+type ScalingMetric string
+
+// Supported scaling metrics.
+const (
+	MetricIngress ScalingMetric = "ingress"
+	MetricEgress  ScalingMetric = "egress"
+	// MetricCombined is the sum of ingress and egress.
+	MetricCombined ScalingMetric = "combined"
+)
+
+// ParseScalingMetric parses the name of a scaling metric.
+func ParseScalingMetric(name string) (ScalingMetric, error) {
+	switch m := ScalingMetric(name); m {
+	case MetricIngress, MetricEgress, MetricCombined:
+		return m, nil
+	}
+	return "", fmt.Errorf("unknown scaling metric %q, expected %s, %s or %s", name, MetricIngress, MetricEgress, MetricCombined)
+}
+
+// Rate returns the rate of the metric from a pod's receive and transmit rates.
+func (m ScalingMetric) Rate(rx, tx float64) float64 {
+	switch m {
+	case MetricEgress:
+		return tx
+	case MetricCombined:
+		return rx + tx
+	}
+	return rx
+}
+
+// ProportionalReplicas computes the replica count that brings the average
+// per-pod rate to targetPerPod, the way the HorizontalPodAutoscaler does:
+// ceil(current * average / target). The current count is kept when the
+// ratio of average to target is within tolerance of 1, when current is zero
+// (scaling up from zero is not driven by traffic) or when the target is not
+// positive.
+func ProportionalReplicas(current int32, averagePerPod, targetPerPod, tolerance float64) int32 {
+	if current <= 0 || targetPerPod <= 0 || averagePerPod < 0 {
+		return current
+	}
+	ratio := averagePerPod / targetPerPod
+	if math.Abs(ratio-1) <= tolerance {
+		return current
+	}
+	desired := math.Ceil(float64(current) * ratio)
+	if desired < 1 {
+		desired = 1
+	}
+	if desired > math.MaxInt32 {
+		desired = math.MaxInt32
+	}
+	return int32(desired)
+}
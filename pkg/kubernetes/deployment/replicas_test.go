@@ -0,0 +1,63 @@
+package deployment
+
+import (
+	"math"
+	"testing"
+)
+
+func TestProportionalReplicas(t *testing.T) {
+	tests := []struct {
+		name      string
+		current   int32
+		average   float64
+		target    float64
+		tolerance float64
+		want      int32
+	}{
+		{name: "at target", current: 4, average: 100, target: 100, tolerance: 0.1, want: 4},
+		{name: "within tolerance above", current: 4, average: 109, target: 100, tolerance: 0.1, want: 4},
+		{name: "within tolerance below", current: 4, average: 91, target: 100, tolerance: 0.1, want: 4},
+		{name: "above tolerance", current: 4, average: 111, target: 100, tolerance: 0.1, want: 5},
+		{name: "below tolerance", current: 10, average: 80, target: 100, tolerance: 0.1, want: 8},
+		{name: "rounds up", current: 4, average: 60, target: 100, tolerance: 0.1, want: 3},
+		{name: "zero tolerance", current: 10, average: 101, target: 100, want: 11},
+		{name: "double the target", current: 3, average: 200, target: 100, tolerance: 0.1, want: 6},
+		{name: "no traffic keeps one replica", current: 5, average: 0, target: 100, tolerance: 0.1, want: 1},
+		{name: "capped at the int32 maximum", current: math.MaxInt32 / 2, average: 1e6, target: 1, tolerance: 0.1, want: math.MaxInt32},
+		{name: "zero current replicas", current: 0, average: 500, target: 100, tolerance: 0.1, want: 0},
+		{name: "negative current replicas", current: -1, average: 500, target: 100, tolerance: 0.1, want: -1},
+		{name: "zero target", current: 4, average: 500, target: 0, tolerance: 0.1, want: 4},
+		{name: "negative average", current: 4, average: -1, target: 100, tolerance: 0.1, want: 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ProportionalReplicas(tt.current, tt.average, tt.target, tt.tolerance); got != tt.want {
+				t.Errorf("ProportionalReplicas(%d, %v, %v, %v) = %d, want %d", tt.current, tt.average, tt.target, tt.tolerance, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScalingMetric(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    float64
+		wantErr bool
+	}{
+		{name: "ingress", want: 100},
+		{name: "egress", want: 30},
+		{name: "combined", want: 130},
+		{name: "", wantErr: true},
+		{name: "Ingress", wantErr: true},
+	}
+	for _, tt := range tests {
+		m, err := ParseScalingMetric(tt.name)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseScalingMetric(%q) error = %v, want error %t", tt.name, err, tt.wantErr)
+			continue
+		}
+		if err == nil && m.Rate(100, 30) != tt.want {
+			t.Errorf("%s rate of rx 100 and tx 30 = %v, want %v", m, m.Rate(100, 30), tt.want)
+		}
+	}
+}
@@ -2,151 +2,134 @@ package deployment
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"k8s-resource-autoscaler/pkg/log"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
-	"time"
+	"k8s.io/client-go/util/retry"
 )
 
-// ScalePod scales the deployment to the desired replica count with retry logic.
-func ScalePod(clientset *kubernetes.Clientset, namespace string, n string, desiredReplicaCount int32) error {
-	// Get all deployments in the namespace
-	deployments, err := clientset.AppsV1().Deployments(namespace).List(context.TODO(), metav1.ListOptions{})
-	if err != nil {
-		log.Fatal("Failed to list deployments: %v", err)
-		return err
-	}
+// ScaleChange describes the replica count ScalePod would set for a deployment.
+type ScaleChange struct {
+	Deployment string
+	Current    int32
+	Desired    int32
+}
 
-	for _, deployment := range deployments.Items {
-		deploymentName := deployment.Name
+// Errors wrapped by ScaleError.
+var (
+	// ErrNotFound is returned when the target deployment does not exist.
+	ErrNotFound = errors.New("deployment not found")
+	// ErrInvalidBounds is returned when the minimum replica count is above the maximum.
+	ErrInvalidBounds = errors.New("minimum replicas above maximum replicas")
+)
 
-		// Check for scaling annotations
-		annotations := deployment.Spec.Template.Annotations
-		scaleUp := annotations["autoscale.k8s.io/scale-up"] == "true"
-		scaleDown := annotations["autoscale.k8s.io/scale-down"] == "true"
+// ScaleError is returned when a deployment cannot be scaled. Err is
+// ErrNotFound, ErrInvalidBounds or the error of the API request.
+type ScaleError struct {
+	Namespace string
+	Name      string
+	Err       error
+}
 
-		// Adjust the desiredReplicaCount based on ingress and egress
-		if scaleUp {
-			log.Info("Scaling up deployment %s based on ingress and egress data", deploymentName)
-			desiredReplicaCount = *deployment.Spec.Replicas + 1
-		} else if scaleDown {
-			log.Info("Scaling down deployment %s based on ingress and egress data", deploymentName)
-			if *deployment.Spec.Replicas > 1 {
-				desiredReplicaCount = *deployment.Spec.Replicas - 1
-			} else {
-				desiredReplicaCount = 1 // Ensure at least one replica
-			}
-		}
+func (e *ScaleError) Error() string {
+	return fmt.Sprintf("error scaling deployment %s in namespace %s: %v", e.Name, e.Namespace, e.Err)
+}
 
-		// Scale the deployment with retry mechanism
-		maxRetries := 3                 // Maximum number of retries
-		waitDuration := 2 * time.Second // Wait duration between retries
-		for i := 0; i < maxRetries; i++ {
-			scaleResponse, err := clientset.AppsV1().Deployments(namespace).GetScale(context.TODO(), deploymentName, metav1.GetOptions{})
-			if err != nil {
-				log.Fatal("Failed to get scale: %v", err)
-				return err
-			}
+func (e *ScaleError) Unwrap() error {
+	return e.Err
+}
 
-			scaleResponse.Spec.Replicas = desiredReplicaCount
-			log.Info("Setting desired replicas for deployment %s to %v", deploymentName, desiredReplicaCount)
+// Bounds limit the replica count of a deployment. Zero means unbounded.
+type Bounds struct {
+	Min int32
+	Max int32
+}
 
-			_, err = clientset.AppsV1().Deployments(namespace).UpdateScale(context.TODO(), deploymentName, scaleResponse, metav1.UpdateOptions{})
-			if err != nil {
-				log.Error("Failed to update scale for deployment %s: %v", deploymentName, err)
-				if i < maxRetries-1 { // Log and wait if not the last attempt
-					log.Info("Retrying to scale deployment %s... (attempt %d)", deploymentName, i+2)
-					time.Sleep(waitDuration)
-				} else {
-					return err // Return the last error after final attempt
-				}
-			} else {
-				log.Info("Deployment %s scaled successfully to %v replicas", deploymentName, desiredReplicaCount)
-				break // Exit loop on success
-			}
-		}
+func (b Bounds) validate() error {
+	if b.Min < 0 || b.Max < 0 || (b.Max > 0 && b.Min > b.Max) {
+		return fmt.Errorf("%w: min %d, max %d", ErrInvalidBounds, b.Min, b.Max)
 	}
-
 	return nil
 }
 
-// WaitForScaling waits for the deployment to reach the desired replica count.
-func WaitForScaling(clientset *kubernetes.Clientset, deploymentName, namespace string, desiredReplicaCount int32) error {
-	timeout := time.After(1 * time.Minute)
-	ticker := time.NewTicker(1 * time.Second)
-	defer ticker.Stop()
-
-	for {
-		select {
-		case <-timeout:
-			return log.Error("Timed out waiting for scaling of deployment %s to %d replicas", deploymentName, desiredReplicaCount)
-		case <-ticker.C:
-			deployment, err := clientset.AppsV1().Deployments(namespace).Get(context.TODO(), deploymentName, metav1.GetOptions{})
-			if err != nil {
-				log.Error("Failed to get deployment status: %v", err)
-				return err
-			}
-			log.Info("Current replicas: %d, Desired replicas: %d", deployment.Status.Replicas, desiredReplicaCount)
-
-			if deployment.Status.ReadyReplicas == desiredReplicaCount {
-				log.Info("Deployment %s scaled successfully to %v replicas", deploymentName, desiredReplicaCount)
-				return nil
-			}
-		}
+func (b Bounds) clamp(replicas int32) int32 {
+	if b.Min > 0 && replicas < b.Min {
+		replicas = b.Min
 	}
-}
-
-// ScaleDownOldPods gradually scales down the old pods in a deployment.
-func ScaleDownOldPods(clientset *kubernetes.Clientset, deploymentName, namespace string) error {
-	// Retrieve the current deployment
-	deployment, err := clientset.AppsV1().Deployments(namespace).Get(context.TODO(), deploymentName, metav1.GetOptions{})
-	if err != nil {
-		if apierrors.IsNotFound(err) {
-			return log.Error("Deployment %s not found in namespace %s", deploymentName, namespace)
-		}
-		return log.Error("Failed to get deployment %s in namespace %s: %v", deploymentName, namespace, err)
+	if b.Max > 0 && replicas > b.Max {
+		replicas = b.Max
 	}
+	return replicas
+}
 
-	// Calculate the new replica count (scaling down by 1)
-	if *deployment.Spec.Replicas > 1 {
-		newReplicaCount := *deployment.Spec.Replicas - 1
-		deployment.Spec.Replicas = &newReplicaCount
+// PlanScale returns the replica count ScalePod would set on the deployment,
+// without changing it.
+func PlanScale(ctx context.Context, clientset kubernetes.Interface, namespace, name string, desiredReplicaCount int32, bounds Bounds) (ScaleChange, error) {
+	change, _, err := scaleChange(ctx, clientset, namespace, name, desiredReplicaCount, bounds)
+	return change, wrapScaleError(namespace, name, err)
+}
 
-		// Update the deployment with the new replica count
-		_, err = clientset.AppsV1().Deployments(namespace).Update(context.TODO(), deployment, metav1.UpdateOptions{})
-		if err != nil {
-			return log.Error("Failed to scale down deployment %s in namespace %s: %v", deploymentName, namespace, err)
+// ScalePod sets the replica count of one deployment through its scale
+// subresource to the desired count clamped to bounds. No other deployment
+// is read or changed. Update conflicts are retried; every other
+// failure is returned as a *ScaleError.
+func ScalePod(ctx context.Context, clientset kubernetes.Interface, namespace, name string, desiredReplicaCount int32, bounds Bounds) (ScaleChange, error) {
+	var change ScaleChange
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		var scale *autoscalingv1.Scale
+		var err error
+		change, scale, err = scaleChange(ctx, clientset, namespace, name, desiredReplicaCount, bounds)
+		if err != nil || change.Current == change.Desired {
+			return err
 		}
-		log.Info("Deployment %s scaled down to %v replicas", deploymentName, newReplicaCount)
+		scale.Spec.Replicas = change.Desired
+		_, err = clientset.AppsV1().Deployments(namespace).UpdateScale(ctx, name, scale, metav1.UpdateOptions{})
+		return err
+	})
+	if err != nil {
+		return change, wrapScaleError(namespace, name, err)
+	}
+	if change.Current == change.Desired {
+		log.Info("Deployment %s in namespace %s already has %d replicas", name, namespace, change.Desired)
 	} else {
-		log.Info("Deployment %s is already at 1 replica, no further scaling down is possible", deploymentName)
+		log.Info("Deployment %s in namespace %s scaled from %d to %d replicas", name, namespace, change.Current, change.Desired)
 	}
-
-	return nil
+	return change, nil
 }
 
-// WaitForPVCReady waits for a Persistent Volume Claim (PVC) to be ready.
-func WaitForPVCReady(clientset *kubernetes.Clientset, pvcName, namespace string) error {
-	timeout := time.After(1 * time.Minute)
-	ticker := time.NewTicker(1 * time.Second)
-	defer ticker.Stop()
+// wrapScaleError returns err as a *ScaleError.
+func wrapScaleError(namespace, name string, err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(*ScaleError); ok {
+		return err
+	}
+	return &ScaleError{Namespace: namespace, Name: name, Err: err}
+}
 
-	for {
-		select {
-		case <-timeout:
-			return log.Error("Timed out waiting for PVC %s in namespace %s to be ready", pvcName, namespace)
-		case <-ticker.C:
-			pvc, err := clientset.CoreV1().PersistentVolumeClaims(namespace).Get(context.TODO(), pvcName, metav1.GetOptions{})
-			if err != nil {
-				log.Error("Failed to get PVC %s in namespace %s: %v", pvcName, namespace, err)
-				return err
-			}
+// scaleChange reads the scale subresource of the deployment and computes
+// the replica count to set.
+func scaleChange(ctx context.Context, clientset kubernetes.Interface, namespace, name string, desiredReplicaCount int32, bounds Bounds) (ScaleChange, *autoscalingv1.Scale, error) {
+	if err := bounds.validate(); err != nil {
+		return ScaleChange{}, nil, &ScaleError{Namespace: namespace, Name: name, Err: err}
+	}
 
-			if pvc.Status.Phase == "Bound" {
-				log.Info("PVC %s in namespace %s is ready", pvcName, namespace)
-				return nil
-			}
-		}
+	scale, err := clientset.AppsV1().Deployments(namespace).GetScale(ctx, name, metav1.GetOptions{})
+	if err == nil {
+		return ScaleChange{
+			Deployment: name,
+			Current:    scale.Spec.Replicas,
+			Desired:    bounds.clamp(desiredReplicaCount),
+		}, scale, nil
+	}
+	if apierrors.IsNotFound(err) {
+		return ScaleChange{}, nil, &ScaleError{Namespace: namespace, Name: name, Err: ErrNotFound}
 	}
+	// Conflicts are returned unwrapped so they are retried
+	return ScaleChange{}, nil, err
 }
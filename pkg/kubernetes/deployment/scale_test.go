@@ -0,0 +1,181 @@
+package deployment
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func newDeployment(namespace, name string, replicas int32, annotations map[string]string) *appsv1.Deployment {
+	d := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+		Spec:       appsv1.DeploymentSpec{Replicas: &replicas},
+	}
+	d.Spec.Template.Annotations = annotations
+	return d
+}
+
+// newScaleClientset returns a fake clientset holding objects whose
+// deployments serve the scale subresource from their replica count, which
+// the fake object tracker does not do by itself.
+func newScaleClientset(objects ...runtime.Object) *fake.Clientset {
+	clientset := fake.NewSimpleClientset(objects...)
+	deploymentsResource := appsv1.SchemeGroupVersion.WithResource("deployments")
+
+	clientset.PrependReactor("get", "deployments", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		get := action.(k8stesting.GetAction)
+		if get.GetSubresource() != "scale" {
+			return false, nil, nil
+		}
+		obj, err := clientset.Tracker().Get(deploymentsResource, get.GetNamespace(), get.GetName())
+		if err != nil {
+			return true, nil, err
+		}
+		d := obj.(*appsv1.Deployment)
+		return true, &autoscalingv1.Scale{
+			ObjectMeta: metav1.ObjectMeta{Namespace: d.Namespace, Name: d.Name, ResourceVersion: d.ResourceVersion},
+			Spec:       autoscalingv1.ScaleSpec{Replicas: *d.Spec.Replicas},
+		}, nil
+	})
+	clientset.PrependReactor("update", "deployments", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		update := action.(k8stesting.UpdateAction)
+		if update.GetSubresource() != "scale" {
+			return false, nil, nil
+		}
+		scale := update.GetObject().(*autoscalingv1.Scale)
+		obj, err := clientset.Tracker().Get(deploymentsResource, update.GetNamespace(), scale.Name)
+		if err != nil {
+			return true, nil, err
+		}
+		d := obj.(*appsv1.Deployment).DeepCopy()
+		d.Spec.Replicas = &scale.Spec.Replicas
+		if err := clientset.Tracker().Update(deploymentsResource, d, update.GetNamespace()); err != nil {
+			return true, nil, err
+		}
+		return true, scale, nil
+	})
+	return clientset
+}
+
+func replicasOf(t *testing.T, clientset *fake.Clientset, namespace, name string) int32 {
+	t.Helper()
+	d, err := clientset.AppsV1().Deployments(namespace).Get(context.Background(), name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("error getting deployment %s/%s: %v", namespace, name, err)
+	}
+	return *d.Spec.Replicas
+}
+
+func TestScalePod(t *testing.T) {
+	legacy := map[string]string{"autoscale.k8s.io/scale-up": "true"}
+
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		current     int32
+		desired     int32
+		bounds      Bounds
+		want        int32
+	}{
+		{name: "scale up", current: 2, desired: 5, want: 5},
+		{name: "scale down", current: 5, desired: 3, want: 3},
+		{name: "unchanged", current: 3, desired: 3, want: 3},
+		{name: "legacy annotations are ignored", annotations: legacy, current: 2, desired: 2, want: 2},
+		{name: "clamped to max", current: 2, desired: 20, bounds: Bounds{Max: 10}, want: 10},
+		{name: "clamped to min", current: 4, desired: 1, bounds: Bounds{Min: 2}, want: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clientset := newScaleClientset(
+				newDeployment("shop", "web", tt.current, tt.annotations),
+				newDeployment("shop", "worker", 7, legacy),
+				newDeployment("other", "web", 4, nil),
+			)
+			clientset.ClearActions()
+
+			change, err := ScalePod(context.Background(), clientset, "shop", "web", tt.desired, tt.bounds)
+			if err != nil {
+				t.Fatalf("ScalePod() error = %v", err)
+			}
+			want := ScaleChange{Deployment: "web", Current: tt.current, Desired: tt.want}
+			if change != want {
+				t.Errorf("ScalePod() = %+v, want %+v", change, want)
+			}
+
+			for _, action := range clientset.Actions() {
+				if action.GetSubresource() != "scale" || action.GetNamespace() != "shop" {
+					t.Errorf("unexpected action %s %s/%s on %s/%s", action.GetVerb(), action.GetResource().Resource, action.GetSubresource(), action.GetNamespace(), nameOf(action))
+				}
+				if name := nameOf(action); name != "web" {
+					t.Errorf("unexpected %s of deployment %s", action.GetVerb(), name)
+				}
+			}
+
+			if got := replicasOf(t, clientset, "shop", "web"); got != tt.want {
+				t.Errorf("shop/web has %d replicas, want %d", got, tt.want)
+			}
+			if got := replicasOf(t, clientset, "shop", "worker"); got != 7 {
+				t.Errorf("shop/worker has %d replicas, want it untouched at 7", got)
+			}
+			if got := replicasOf(t, clientset, "other", "web"); got != 4 {
+				t.Errorf("other/web has %d replicas, want it untouched at 4", got)
+			}
+		})
+	}
+}
+
+func nameOf(action k8stesting.Action) string {
+	switch a := action.(type) {
+	case k8stesting.GetAction:
+		return a.GetName()
+	case k8stesting.UpdateAction:
+		return a.GetObject().(*autoscalingv1.Scale).Name
+	}
+	return ""
+}
+
+func TestScalePodErrors(t *testing.T) {
+	clientset := newScaleClientset(newDeployment("shop", "web", 2, nil))
+
+	_, err := ScalePod(context.Background(), clientset, "shop", "missing", 3, Bounds{})
+	var scaleErr *ScaleError
+	if !errors.As(err, &scaleErr) || !errors.Is(err, ErrNotFound) {
+		t.Errorf("ScalePod() of a missing deployment error = %v, want a *ScaleError wrapping ErrNotFound", err)
+	}
+
+	_, err = ScalePod(context.Background(), clientset, "shop", "web", 3, Bounds{Min: 5, Max: 2})
+	if !errors.Is(err, ErrInvalidBounds) {
+		t.Errorf("ScalePod() with min above max error = %v, want ErrInvalidBounds", err)
+	}
+	if got := replicasOf(t, clientset, "shop", "web"); got != 2 {
+		t.Errorf("shop/web has %d replicas after failed scales, want 2", got)
+	}
+}
+
+func TestPlanScaleDoesNotUpdate(t *testing.T) {
+	clientset := newScaleClientset(newDeployment("shop", "web", 2, nil))
+	clientset.ClearActions()
+
+	change, err := PlanScale(context.Background(), clientset, "shop", "web", 6, Bounds{Max: 4})
+	if err != nil {
+		t.Fatalf("PlanScale() error = %v", err)
+	}
+	if want := (ScaleChange{Deployment: "web", Current: 2, Desired: 4}); change != want {
+		t.Errorf("PlanScale() = %+v, want %+v", change, want)
+	}
+	for _, action := range clientset.Actions() {
+		if action.GetVerb() != "get" {
+			t.Errorf("PlanScale() made a %s request", action.GetVerb())
+		}
+	}
+	if got := replicasOf(t, clientset, "shop", "web"); got != 2 {
+		t.Errorf("shop/web has %d replicas after PlanScale, want 2", got)
+	}
+}
@@ -0,0 +1,41 @@
+package events
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+// Component is the source component set on every emitted Event.
+const Component = "k8s-resource-autoscaler"
+
+// Event reasons emitted by the autoscaler.
+const (
+	ReasonInvalidPolicy = "InvalidPolicy"
+	ReasonPVCMaxSize    = "PVCMaxSizeReached"
+	ReasonRestartNeeded = "PVCRestartRequired"
+	ReasonTemplateDrift = "VolumeClaimTemplateDrift"
+
+	// Reasons of the Events emitted on PVCs for every resize decision.
+	ReasonPVCExpanded         = "PVCExpanded"
+	ReasonPVCExpansionSkipped = "PVCExpansionSkipped"
+	ReasonPVCExpansionFailed  = "PVCExpansionFailed"
+	ReasonInodeUsageHigh      = "InodeUsageHigh"
+
+	// Reasons of the Events emitted on Deployments for every scale decision.
+	ReasonScaledUp    = "ScaledUp"
+	ReasonScaledDown  = "ScaledDown"
+	ReasonScaleFailed = "ScaleFailed"
+)
+
+// NewRecorder returns an EventRecorder that writes Events to the API server,
+// together with a function that stops the underlying broadcaster. A non-empty
+// cluster name is recorded as the source host of the Events.
+func NewRecorder(clientset kubernetes.Interface, cluster string) (record.EventRecorder, func()) {
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: clientset.CoreV1().Events("")})
+	recorder := broadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: Component, Host: cluster})
+	return recorder, broadcaster.Shutdown
+}
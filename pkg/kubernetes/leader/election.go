@@ -0,0 +1,106 @@
+package leader
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"k8s-resource-autoscaler/config"
+	"k8s-resource-autoscaler/pkg/log"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+const (
+	defaultLeaseName     = "k8s-resource-autoscaler"
+	defaultLeaseDuration = 15 * time.Second
+	defaultRenewDeadline = 10 * time.Second
+	defaultRetryPeriod   = 2 * time.Second
+)
+
+// Identity returns a unique identity for this process, based on the hostname.
+func Identity() string {
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "autoscaler"
+	}
+	return hostname + "_" + string(uuid.NewUUID())
+}
+
+// withDefaults fills in any unset leader election settings.
+func withDefaults(cfg config.LeaderElectionConfig) config.LeaderElectionConfig {
+	if cfg.LeaseName == "" {
+		cfg.LeaseName = defaultLeaseName
+	}
+	if cfg.LeaseNamespace == "" {
+		cfg.LeaseNamespace = os.Getenv("POD_NAMESPACE")
+	}
+	if cfg.LeaseNamespace == "" {
+		cfg.LeaseNamespace = metav1.NamespaceDefault
+	}
+	if cfg.LeaseDuration <= 0 {
+		cfg.LeaseDuration = defaultLeaseDuration
+	}
+	if cfg.RenewDeadline <= 0 {
+		cfg.RenewDeadline = defaultRenewDeadline
+	}
+	if cfg.RetryPeriod <= 0 {
+		cfg.RetryPeriod = defaultRetryPeriod
+	}
+	return cfg
+}
+
+// NewElector builds a Lease-based leader elector. run is called with a context
+// that is cancelled as soon as leadership is lost.
+func NewElector(clientset kubernetes.Interface, cfg config.LeaderElectionConfig, identity string, run func(ctx context.Context)) (*leaderelection.LeaderElector, error) {
+	cfg = withDefaults(cfg)
+
+	lock := &resourcelock.LeaseLock{
+		LeaseMeta: metav1.ObjectMeta{
+			Name:      cfg.LeaseName,
+			Namespace: cfg.LeaseNamespace,
+		},
+		Client: clientset.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{
+			Identity: identity,
+		},
+	}
+
+	return leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+		Lock:            lock,
+		LeaseDuration:   cfg.LeaseDuration,
+		RenewDeadline:   cfg.RenewDeadline,
+		RetryPeriod:     cfg.RetryPeriod,
+		ReleaseOnCancel: true,
+		Name:            cfg.LeaseName,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(ctx context.Context) {
+				log.Info("Acquired lease %s/%s as %s", cfg.LeaseNamespace, cfg.LeaseName, identity)
+				run(ctx)
+			},
+			OnStoppedLeading: func() {
+				log.Warning("Lost lease %s/%s as %s", cfg.LeaseNamespace, cfg.LeaseName, identity)
+			},
+			OnNewLeader: func(current string) {
+				if current != identity {
+					log.Info("Current leader is %s, standing by.", current)
+				}
+			},
+		},
+	})
+}
+
+// Run campaigns for leadership and calls run while this process holds the
+// lease. It returns when the context is cancelled or leadership is lost.
+func Run(ctx context.Context, clientset kubernetes.Interface, cfg config.LeaderElectionConfig, identity string, run func(ctx context.Context)) error {
+	elector, err := NewElector(clientset, cfg, identity, run)
+	if err != nil {
+		return fmt.Errorf("error creating leader elector: %v", err)
+	}
+	elector.Run(ctx)
+	return nil
+}
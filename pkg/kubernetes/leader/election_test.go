@@ -0,0 +1,149 @@
+package leader
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"k8s-resource-autoscaler/config"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// testElection is short enough for a follower to notice a released lease
+// within the test timeouts.
+var testElection = config.LeaderElectionConfig{
+	LeaseName:      "autoscaler-test",
+	LeaseNamespace: "kube-system",
+	LeaseDuration:  time.Second,
+	RenewDeadline:  500 * time.Millisecond,
+	RetryPeriod:    100 * time.Millisecond,
+}
+
+// candidate runs an election for identity until its context is cancelled.
+type candidate struct {
+	leading chan struct{}
+	stopped chan struct{}
+	cancel  context.CancelFunc
+	done    chan struct{}
+}
+
+func campaign(t *testing.T, clientset kubernetes.Interface, identity string) *candidate {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &candidate{leading: make(chan struct{}), stopped: make(chan struct{}), cancel: cancel, done: make(chan struct{})}
+	t.Cleanup(func() {
+		c.cancel()
+		<-c.done
+	})
+	go func() {
+		defer close(c.done)
+		err := Run(ctx, clientset, testElection, identity, func(ctx context.Context) {
+			close(c.leading)
+			<-ctx.Done()
+			close(c.stopped)
+		})
+		if err != nil {
+			t.Errorf("Run(%s) error = %v", identity, err)
+		}
+	}()
+	return c
+}
+
+func holder(t *testing.T, clientset kubernetes.Interface) string {
+	t.Helper()
+	lease, err := clientset.CoordinationV1().Leases(testElection.LeaseNamespace).Get(context.Background(), testElection.LeaseName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("error getting lease: %v", err)
+	}
+	if lease.Spec.HolderIdentity == nil {
+		return ""
+	}
+	return *lease.Spec.HolderIdentity
+}
+
+func waitLeading(t *testing.T, c *candidate, identity string) {
+	t.Helper()
+	select {
+	case <-c.leading:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("%s did not acquire the lease", identity)
+	}
+}
+
+func TestElection(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+
+	first := campaign(t, clientset, "first")
+	waitLeading(t, first, "first")
+	if got := holder(t, clientset); got != "first" {
+		t.Fatalf("lease holder = %q, want first", got)
+	}
+
+	// The second candidate stays a follower while the lease is renewed,
+	// well past the lease duration
+	second := campaign(t, clientset, "second")
+	select {
+	case <-second.leading:
+		t.Fatalf("second acquired the lease held by first")
+	case <-time.After(3 * testElection.LeaseDuration):
+	}
+	if got := holder(t, clientset); got != "first" {
+		t.Fatalf("lease holder = %q, want first", got)
+	}
+
+	// Stopping the leader releases the lease to the follower
+	first.cancel()
+	<-first.done
+	waitLeading(t, second, "second")
+	if got := holder(t, clientset); got != "second" {
+		t.Errorf("lease holder = %q, want second", got)
+	}
+}
+
+// TestElectionLeaseExpiry stops the leader from renewing without releasing
+// the lease, as a partitioned or hung leader would. The follower must take
+// over once the lease expires.
+func TestElectionLeaseExpiry(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	var partitioned atomic.Bool
+	clientset.PrependReactor("update", "leases", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		lease := action.(k8stesting.UpdateAction).GetObject().(*coordinationv1.Lease)
+		holder := ""
+		if lease.Spec.HolderIdentity != nil {
+			holder = *lease.Spec.HolderIdentity
+		}
+		// Renewals and the release of first both fail
+		if partitioned.Load() && holder != "second" {
+			return true, nil, errors.New("connection refused")
+		}
+		return false, nil, nil
+	})
+
+	first := campaign(t, clientset, "first")
+	waitLeading(t, first, "first")
+	second := campaign(t, clientset, "second")
+
+	partitioned.Store(true)
+	start := time.Now()
+	waitLeading(t, second, "second")
+
+	// The last renewal happened at most a retry period before the partition
+	if elapsed, min := time.Since(start), testElection.LeaseDuration-testElection.RetryPeriod; elapsed < min {
+		t.Errorf("second acquired the lease %s after first stopped renewing, want at least %s", elapsed, min)
+	}
+	select {
+	case <-first.stopped:
+	default:
+		t.Errorf("first still leads after second acquired the lease")
+	}
+	if got := holder(t, clientset); got != "second" {
+		t.Errorf("lease holder = %q, want second", got)
+	}
+}
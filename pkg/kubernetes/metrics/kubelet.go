@@ -0,0 +1,280 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"k8s-resource-autoscaler/pkg/log"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// summary is the subset of the kubelet /stats/summary response used here.
+type summary struct {
+	Pods []podStats `json:"pods"`
+}
+
+type podStats struct {
+	PodRef struct {
+		Name      string `json:"name"`
+		Namespace string `json:"namespace"`
+	} `json:"podRef"`
+	Network *struct {
+		Time    metav1.Time `json:"time"`
+		RxBytes *uint64     `json:"rxBytes"`
+		TxBytes *uint64     `json:"txBytes"`
+	} `json:"network"`
+	Volumes []volumeStats `json:"volume"`
+}
+
+type volumeStats struct {
+	Name          string  `json:"name"`
+	UsedBytes     *uint64 `json:"usedBytes"`
+	CapacityBytes *uint64 `json:"capacityBytes"`
+	Inodes        *uint64 `json:"inodes"`
+	InodesUsed    *uint64 `json:"inodesUsed"`
+	PVCRef        *struct {
+		Name      string `json:"name"`
+		Namespace string `json:"namespace"`
+	} `json:"pvcRef"`
+}
+
+// diskUsage returns the used byte percentage of the volume.
+func (v volumeStats) diskUsage() (float64, bool) {
+	if v.UsedBytes == nil || v.CapacityBytes == nil || *v.CapacityBytes == 0 {
+		return 0, false
+	}
+	return float64(*v.UsedBytes) / float64(*v.CapacityBytes) * 100, true
+}
+
+// inodeUsage returns the used inode percentage of the volume.
+func (v volumeStats) inodeUsage() (float64, bool) {
+	if v.InodesUsed == nil || v.Inodes == nil || *v.Inodes == 0 {
+		return 0, false
+	}
+	return float64(*v.InodesUsed) / float64(*v.Inodes) * 100, true
+}
+
+// networkSample is a cumulative byte counter reading of a pod, with the
+// rates computed against the reading before it.
+type networkSample struct {
+	time    time.Time
+	rxBytes uint64
+	txBytes uint64
+
+	hasRate bool
+	rxRate  float64
+	txRate  float64
+}
+
+// Kubelet is a MetricsSource that reads the kubelet /stats/summary endpoint
+// through the API server node proxy, for clusters without Prometheus.
+//
+// The kubelet only reports cumulative network counters, so the first
+// NetworkUsage call for a pod stores a sample and returns an error; rates
+// are available from the second call on.
+type Kubelet struct {
+	clientset kubernetes.Interface
+
+	mu      sync.Mutex
+	samples map[string]networkSample
+}
+
+// NewKubelet returns a Kubelet source that talks to the nodes through clientset.
+func NewKubelet(clientset kubernetes.Interface) *Kubelet {
+	return &Kubelet{clientset: clientset, samples: map[string]networkSample{}}
+}
+
+// summary fetches the stats summary of a node.
+func (k *Kubelet) summary(ctx context.Context, node string) (*summary, error) {
+	body, err := k.clientset.CoreV1().RESTClient().Get().
+		AbsPath("/api/v1/nodes", node, "proxy", "stats", "summary").
+		DoRaw(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching stats summary of node %s: %v", node, err)
+	}
+	var s summary
+	if err := json.Unmarshal(body, &s); err != nil {
+		return nil, fmt.Errorf("error unmarshalling stats summary of node %s: %v", node, err)
+	}
+	return &s, nil
+}
+
+// podFor returns the stats of a pod from the summary of the node it runs on.
+func (k *Kubelet) podFor(ctx context.Context, pod *v1.Pod) (*podStats, error) {
+	if pod.Spec.NodeName == "" {
+		return nil, fmt.Errorf("pod %s is not scheduled", pod.Name)
+	}
+	s, err := k.summary(ctx, pod.Spec.NodeName)
+	if err != nil {
+		return nil, err
+	}
+	for i := range s.Pods {
+		if s.Pods[i].PodRef.Namespace == pod.Namespace && s.Pods[i].PodRef.Name == pod.Name {
+			return &s.Pods[i], nil
+		}
+	}
+	return nil, fmt.Errorf("node %s reports no stats for pod %s", pod.Spec.NodeName, pod.Name)
+}
+
+// DiskUsage returns the used percentage of a PVC as reported by the kubelet
+// of a running pod that mounts it.
+func (k *Kubelet) DiskUsage(ctx context.Context, namespace, pvcName string) (float64, error) {
+	return k.volumeUsage(ctx, namespace, pvcName, volumeStats.diskUsage)
+}
+
+// InodeUsage returns the used inode percentage of a PVC as reported by the
+// kubelet of a running pod that mounts it.
+func (k *Kubelet) InodeUsage(ctx context.Context, namespace, pvcName string) (float64, error) {
+	return k.volumeUsage(ctx, namespace, pvcName, volumeStats.inodeUsage)
+}
+
+// volumeUsage returns the usage of a PVC computed by usage from the stats
+// of a running pod that mounts it.
+func (k *Kubelet) volumeUsage(ctx context.Context, namespace, pvcName string, usage func(volumeStats) (float64, bool)) (float64, error) {
+	pods, err := k.clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return 0, fmt.Errorf("error listing pods in namespace %s: %v", namespace, err)
+	}
+
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if pod.Status.Phase != v1.PodRunning || !mountsPVC(pod, pvcName) {
+			continue
+		}
+		stats, err := k.podFor(ctx, pod)
+		if err != nil {
+			return 0, err
+		}
+		for _, volume := range stats.Volumes {
+			if volume.PVCRef == nil || volume.PVCRef.Name != pvcName {
+				continue
+			}
+			percent, ok := usage(volume)
+			if !ok {
+				return 0, fmt.Errorf("kubelet reports no usage for PVC %s", pvcName)
+			}
+			return percent, nil
+		}
+		return 0, fmt.Errorf("kubelet reports no volume stats for PVC %s on pod %s", pvcName, pod.Name)
+	}
+	return 0, fmt.Errorf("no running pod mounts PVC %s in namespace %s", pvcName, namespace)
+}
+
+// mountsPVC reports whether the pod mounts the PVC.
+func mountsPVC(pod *v1.Pod, pvcName string) bool {
+	for _, volume := range pod.Spec.Volumes {
+		if volume.PersistentVolumeClaim != nil && volume.PersistentVolumeClaim.ClaimName == pvcName {
+			return true
+		}
+	}
+	return false
+}
+
+// NetworkUsage returns the receive and transmit rates of a pod, computed
+// from the counters of this and the previous call.
+func (k *Kubelet) NetworkUsage(ctx context.Context, namespace, podName string) (float64, float64, error) {
+	pod, err := k.clientset.CoreV1().Pods(namespace).Get(ctx, podName, metav1.GetOptions{})
+	if err != nil {
+		return 0, 0, fmt.Errorf("error getting pod %s: %v", podName, err)
+	}
+	stats, err := k.podFor(ctx, pod)
+	if err != nil {
+		return 0, 0, err
+	}
+	if stats.Network == nil || stats.Network.RxBytes == nil || stats.Network.TxBytes == nil {
+		return 0, 0, fmt.Errorf("kubelet reports no network stats for pod %s", podName)
+	}
+	rx, tx, ok := k.rate(namespace+"/"+podName, stats)
+	if !ok {
+		return 0, 0, fmt.Errorf("no previous network sample for pod %s yet", podName)
+	}
+	return rx, tx, nil
+}
+
+// rate stores the network counters of a pod and returns the rates since the
+// previous reading. The returned bool is false when there is no usable
+// previous reading.
+func (k *Kubelet) rate(key string, stats *podStats) (float64, float64, bool) {
+	if stats.Network == nil || stats.Network.RxBytes == nil || stats.Network.TxBytes == nil {
+		return 0, 0, false
+	}
+	current := networkSample{
+		time:    stats.Network.Time.Time,
+		rxBytes: *stats.Network.RxBytes,
+		txBytes: *stats.Network.TxBytes,
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	previous, ok := k.samples[key]
+	if ok && !current.time.After(previous.time) {
+		// The kubelet has not refreshed its stats since the last call
+		current = previous
+	} else if ok && current.rxBytes >= previous.rxBytes && current.txBytes >= previous.txBytes {
+		elapsed := current.time.Sub(previous.time).Seconds()
+		current.hasRate = true
+		current.rxRate = float64(current.rxBytes-previous.rxBytes) / elapsed
+		current.txRate = float64(current.txBytes-previous.txBytes) / elapsed
+	}
+	k.samples[key] = current
+	return current.rxRate, current.txRate, current.hasRate
+}
+
+// Snapshot fetches the stats summary of every node once and records the
+// usage of all PVCs and pods they report.
+func (k *Kubelet) Snapshot(ctx context.Context) (*Snapshot, error) {
+	nodes, err := k.clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("error listing nodes: %v", err)
+	}
+
+	snapshot := NewSnapshot(k)
+	for _, node := range nodes.Items {
+		s, err := k.summary(ctx, node.Name)
+		if err != nil {
+			log.Warning("Skipping node %s in metrics snapshot: %v", node.Name, err)
+			continue
+		}
+		for i := range s.Pods {
+			stats := &s.Pods[i]
+			for _, volume := range stats.Volumes {
+				if volume.PVCRef == nil {
+					continue
+				}
+				if percent, ok := volume.diskUsage(); ok {
+					snapshot.SetDiskUsage(volume.PVCRef.Namespace, volume.PVCRef.Name, percent)
+				}
+				if percent, ok := volume.inodeUsage(); ok {
+					snapshot.SetInodeUsage(volume.PVCRef.Namespace, volume.PVCRef.Name, percent)
+				}
+			}
+			if rx, tx, ok := k.rate(stats.PodRef.Namespace+"/"+stats.PodRef.Name, stats); ok {
+				snapshot.SetNetworkUsage(stats.PodRef.Namespace, stats.PodRef.Name, rx, tx)
+			}
+		}
+	}
+	return snapshot, nil
+}
+
+// Query answers the built-in queries. The kubelet cannot evaluate
+// user-defined queries.
+func (k *Kubelet) Query(ctx context.Context, name string, vars Vars) (float64, error) {
+	switch name {
+	case QueryDiskUsage:
+		return k.DiskUsage(ctx, vars.Namespace, vars.PVC)
+	case QueryInodeUsage:
+		return k.InodeUsage(ctx, vars.Namespace, vars.PVC)
+	case QueryIngress:
+		rx, _, err := k.NetworkUsage(ctx, vars.Namespace, vars.Pod)
+		return rx, err
+	case QueryEgress:
+		_, tx, err := k.NetworkUsage(ctx, vars.Namespace, vars.Pod)
+		return tx, err
+	}
+	return 0, fmt.Errorf("query %s is not supported by the kubelet metrics source", name)
+}
@@ -0,0 +1,357 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// fakeAPIServer serves the pods and nodes the kubelet source lists, and the
+// stats summaries of the nodes through the node proxy path.
+type fakeAPIServer struct {
+	mu        sync.Mutex
+	pods      []corev1.Pod
+	summaries map[string]string
+	summaryOf map[string]int
+}
+
+// newTestKubelet returns a Kubelet source whose clientset talks to a fake
+// API server holding pods, and serving summaries keyed by node name. A node
+// with an empty summary fails its stats requests.
+func newTestKubelet(t *testing.T, summaries map[string]string, pods ...corev1.Pod) (*Kubelet, *fakeAPIServer) {
+	t.Helper()
+	f := &fakeAPIServer{pods: pods, summaries: summaries, summaryOf: map[string]int{}}
+	server := httptest.NewServer(f)
+	t.Cleanup(server.Close)
+
+	clientset, err := kubernetes.NewForConfig(&rest.Config{Host: server.URL})
+	if err != nil {
+		t.Fatalf("error creating clientset: %v", err)
+	}
+	return NewKubelet(clientset), f
+}
+
+func (f *fakeAPIServer) setSummary(node, summary string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.summaries[node] = summary
+}
+
+// summaryRequests returns the number of stats requests made for node.
+func (f *fakeAPIServer) summaryRequests(node string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.summaryOf[node]
+}
+
+func (f *fakeAPIServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case r.URL.Path == "/api/v1/nodes":
+		list := &corev1.NodeList{TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "NodeList"}}
+		for name := range f.summaries {
+			list.Items = append(list.Items, corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: name}})
+		}
+		writeJSON(w, list)
+	case len(parts) == 7 && parts[2] == "nodes" && strings.Join(parts[4:], "/") == "proxy/stats/summary":
+		node := parts[3]
+		f.summaryOf[node]++
+		summary, ok := f.summaries[node]
+		if !ok || summary == "" {
+			http.Error(w, "node unreachable", http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, summary)
+	case len(parts) == 5 && parts[2] == "namespaces" && parts[4] == "pods":
+		list := &corev1.PodList{TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "PodList"}}
+		for _, pod := range f.pods {
+			if pod.Namespace == parts[3] {
+				list.Items = append(list.Items, pod)
+			}
+		}
+		writeJSON(w, list)
+	case len(parts) == 6 && parts[2] == "namespaces" && parts[4] == "pods":
+		for i := range f.pods {
+			if pod := f.pods[i]; pod.Namespace == parts[3] && pod.Name == parts[5] {
+				pod.TypeMeta = metav1.TypeMeta{APIVersion: "v1", Kind: "Pod"}
+				writeJSON(w, &pod)
+				return
+			}
+		}
+		w.WriteHeader(http.StatusNotFound)
+		writeJSON(w, &metav1.Status{
+			TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "Status"},
+			Status:   metav1.StatusFailure,
+			Reason:   metav1.StatusReasonNotFound,
+			Code:     http.StatusNotFound,
+		})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, obj interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(obj)
+}
+
+// kubeletPod returns a pod running on node that mounts claims.
+func kubeletPod(namespace, name, node string, claims ...string) corev1.Pod {
+	pod := corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+		Spec:       corev1.PodSpec{NodeName: node},
+		Status:     corev1.PodStatus{Phase: corev1.PodRunning},
+	}
+	for _, claim := range claims {
+		pod.Spec.Volumes = append(pod.Spec.Volumes, corev1.Volume{
+			Name: claim,
+			VolumeSource: corev1.VolumeSource{
+				PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: claim},
+			},
+		})
+	}
+	return pod
+}
+
+// statsSummary returns a summary reporting pods, as returned by podSummary.
+func statsSummary(pods ...string) string {
+	return fmt.Sprintf(`{"node":{"nodeName":"node-1"},"pods":[%s]}`, strings.Join(pods, ","))
+}
+
+// podSummary returns the stats of a pod holding volumes, with network
+// counters if network is set.
+func podSummary(namespace, name, network string, volumes ...string) string {
+	stats := fmt.Sprintf(`{"podRef":{"namespace":%q,"name":%q},"volume":[%s]`, namespace, name, strings.Join(volumes, ","))
+	if network != "" {
+		stats += `,"network":` + network
+	}
+	return stats + "}"
+}
+
+// volumeSummary returns the stats of a volume of PVC claim.
+func volumeSummary(namespace, claim string, used, capacity, inodesUsed, inodes int) string {
+	return fmt.Sprintf(`{"name":%q,"usedBytes":%d,"capacityBytes":%d,"inodesUsed":%d,"inodes":%d,"pvcRef":{"namespace":%q,"name":%q}}`,
+		claim, used, capacity, inodesUsed, inodes, namespace, claim)
+}
+
+// networkSummary returns network counters read seconds after a fixed time.
+func networkSummary(seconds, rx, tx int) string {
+	return fmt.Sprintf(`{"time":"2024-01-01T00:00:%02dZ","rxBytes":%d,"txBytes":%d}`, seconds, rx, tx)
+}
+
+func TestKubeletVolumeUsage(t *testing.T) {
+	data := volumeSummary("shop", "data", 30, 100, 5, 10)
+	tests := []struct {
+		name      string
+		pods      []corev1.Pod
+		summary   string
+		wantDisk  float64
+		wantInode float64
+		wantErr   string
+	}{
+		{
+			name:      "mounted by a running pod",
+			pods:      []corev1.Pod{kubeletPod("shop", "db-0", "node-1", "data")},
+			summary:   statsSummary(podSummary("shop", "db-0", "", data)),
+			wantDisk:  30,
+			wantInode: 50,
+		},
+		{
+			name:    "no pod mounts the PVC",
+			pods:    []corev1.Pod{kubeletPod("shop", "web-1", "node-1")},
+			summary: statsSummary(podSummary("shop", "web-1", "")),
+			wantErr: "no running pod mounts PVC data",
+		},
+		{
+			name:    "empty summary",
+			pods:    []corev1.Pod{kubeletPod("shop", "db-0", "node-1", "data")},
+			summary: statsSummary(),
+			wantErr: "reports no stats for pod db-0",
+		},
+		{
+			name:    "volume missing from the summary",
+			pods:    []corev1.Pod{kubeletPod("shop", "db-0", "node-1", "data")},
+			summary: statsSummary(podSummary("shop", "db-0", "")),
+			wantErr: "no volume stats for PVC data",
+		},
+		{
+			name:    "zero capacity",
+			pods:    []corev1.Pod{kubeletPod("shop", "db-0", "node-1", "data")},
+			summary: statsSummary(podSummary("shop", "db-0", "", volumeSummary("shop", "data", 0, 0, 0, 0))),
+			wantErr: "no usage for PVC data",
+		},
+		{
+			name:    "node unreachable",
+			pods:    []corev1.Pod{kubeletPod("shop", "db-0", "node-1", "data")},
+			wantErr: "error fetching stats summary of node node-1",
+		},
+		{
+			name:    "malformed summary",
+			pods:    []corev1.Pod{kubeletPod("shop", "db-0", "node-1", "data")},
+			summary: "not json",
+			wantErr: "error unmarshalling stats summary",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k, _ := newTestKubelet(t, map[string]string{"node-1": tt.summary}, tt.pods...)
+			ctx := context.Background()
+
+			disk, err := k.DiskUsage(ctx, "shop", "data")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("DiskUsage() = %v, %v, want an error containing %q", disk, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || disk != tt.wantDisk {
+				t.Errorf("DiskUsage() = %v, %v, want %v", disk, err, tt.wantDisk)
+			}
+			if inode, err := k.InodeUsage(ctx, "shop", "data"); err != nil || inode != tt.wantInode {
+				t.Errorf("InodeUsage() = %v, %v, want %v", inode, err, tt.wantInode)
+			}
+		})
+	}
+}
+
+func TestKubeletNetworkUsage(t *testing.T) {
+	pod := kubeletPod("shop", "web-1", "node-1")
+	k, f := newTestKubelet(t, map[string]string{
+		"node-1": statsSummary(podSummary("shop", "web-1", networkSummary(0, 1000, 500))),
+	}, pod)
+	ctx := context.Background()
+
+	// The first reading has nothing to compute a rate against
+	if _, _, err := k.NetworkUsage(ctx, "shop", "web-1"); err == nil || !strings.Contains(err.Error(), "no previous network sample") {
+		t.Errorf("first NetworkUsage() error = %v, want no previous sample", err)
+	}
+
+	// The kubelet has not refreshed its counters yet
+	if _, _, err := k.NetworkUsage(ctx, "shop", "web-1"); err == nil {
+		t.Errorf("NetworkUsage() before the counters change succeeded")
+	}
+
+	f.setSummary("node-1", statsSummary(podSummary("shop", "web-1", networkSummary(10, 3000, 1500))))
+	rx, tx, err := k.NetworkUsage(ctx, "shop", "web-1")
+	if err != nil || rx != 200 || tx != 100 {
+		t.Errorf("NetworkUsage() = %v, %v, %v, want 200, 100", rx, tx, err)
+	}
+
+	// Counters going backwards, e.g. after a restart, reset the sample
+	f.setSummary("node-1", statsSummary(podSummary("shop", "web-1", networkSummary(20, 100, 50))))
+	if _, _, err := k.NetworkUsage(ctx, "shop", "web-1"); err == nil {
+		t.Errorf("NetworkUsage() after a counter reset succeeded")
+	}
+	f.setSummary("node-1", statsSummary(podSummary("shop", "web-1", networkSummary(30, 1100, 550))))
+	if rx, tx, err := k.NetworkUsage(ctx, "shop", "web-1"); err != nil || rx != 100 || tx != 50 {
+		t.Errorf("NetworkUsage() after a counter reset = %v, %v, %v, want 100, 50", rx, tx, err)
+	}
+}
+
+func TestKubeletNetworkUsageErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		podName string
+		summary string
+		wantErr string
+	}{
+		{name: "pod not found", podName: "missing", summary: statsSummary(), wantErr: "error getting pod missing"},
+		{name: "no network stats", podName: "web-1", summary: statsSummary(podSummary("shop", "web-1", "")), wantErr: "no network stats"},
+		{name: "pod not in summary", podName: "web-1", summary: statsSummary(), wantErr: "reports no stats for pod web-1"},
+		{name: "node unreachable", podName: "web-1", wantErr: "error fetching stats summary"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k, _ := newTestKubelet(t, map[string]string{"node-1": tt.summary}, kubeletPod("shop", "web-1", "node-1"))
+			if _, _, err := k.NetworkUsage(context.Background(), "shop", tt.podName); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("NetworkUsage() error = %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestKubeletSnapshot(t *testing.T) {
+	k, f := newTestKubelet(t, map[string]string{
+		"node-1": statsSummary(
+			podSummary("shop", "db-0", networkSummary(0, 1000, 500), volumeSummary("shop", "data", 80, 100, 1, 10)),
+			podSummary("shop", "web-1", networkSummary(0, 1000, 500)),
+		),
+		"node-2": statsSummary(podSummary("shop", "cache-0", "", volumeSummary("shop", "cache", 0, 0, 0, 0))),
+		// An unreachable node is skipped
+		"node-3": "",
+	})
+	ctx := context.Background()
+
+	snapshot, err := k.Snapshot(ctx)
+	if err != nil {
+		t.Fatalf("Snapshot() error = %v", err)
+	}
+	// The first snapshot has no network rates yet
+	if pvcs, pods := snapshot.Len(); pvcs != 1 || pods != 0 {
+		t.Errorf("first snapshot holds %d PVCs and %d pods, want 1 and 0", pvcs, pods)
+	}
+	if got, err := snapshot.DiskUsage(ctx, "shop", "data"); err != nil || got != 80 {
+		t.Errorf("snapshot DiskUsage(data) = %v, %v, want 80", got, err)
+	}
+	if got, err := snapshot.Query(ctx, QueryInodeUsage, Vars{Namespace: "shop", PVC: "data"}); err != nil || got != 10 {
+		t.Errorf("snapshot inode usage of data = %v, %v, want 10", got, err)
+	}
+	for _, node := range []string{"node-1", "node-2", "node-3"} {
+		if n := f.summaryRequests(node); n != 1 {
+			t.Errorf("Snapshot() fetched the summary of %s %d times, want once", node, n)
+		}
+	}
+
+	f.setSummary("node-1", statsSummary(
+		podSummary("shop", "db-0", networkSummary(10, 1000, 500), volumeSummary("shop", "data", 90, 100, 1, 10)),
+		podSummary("shop", "web-1", networkSummary(10, 5000, 2500)),
+	))
+	snapshot, err = k.Snapshot(ctx)
+	if err != nil {
+		t.Fatalf("Snapshot() error = %v", err)
+	}
+	if pvcs, pods := snapshot.Len(); pvcs != 1 || pods != 2 {
+		t.Errorf("second snapshot holds %d PVCs and %d pods, want 1 and 2", pvcs, pods)
+	}
+	if rx, tx, err := snapshot.NetworkUsage(ctx, "shop", "web-1"); err != nil || rx != 400 || tx != 200 {
+		t.Errorf("snapshot NetworkUsage(web-1) = %v, %v, %v, want 400, 200", rx, tx, err)
+	}
+	if rx, tx, err := snapshot.NetworkUsage(ctx, "shop", "db-0"); err != nil || rx != 0 || tx != 0 {
+		t.Errorf("snapshot NetworkUsage(db-0) = %v, %v, %v, want 0, 0", rx, tx, err)
+	}
+}
+
+func TestKubeletSnapshotEmpty(t *testing.T) {
+	k, _ := newTestKubelet(t, map[string]string{"node-1": statsSummary(), "node-2": ""})
+
+	snapshot, err := k.Snapshot(context.Background())
+	if err != nil {
+		t.Fatalf("Snapshot() error = %v", err)
+	}
+	if pvcs, pods := snapshot.Len(); pvcs != 0 || pods != 0 {
+		t.Errorf("snapshot holds %d PVCs and %d pods, want none", pvcs, pods)
+	}
+}
+
+func TestKubeletQueryUnsupported(t *testing.T) {
+	k, f := newTestKubelet(t, map[string]string{"node-1": statsSummary()})
+	if _, err := k.Query(context.Background(), QueryDiskUsedBytes, Vars{Namespace: "shop", PVC: "data"}); err == nil {
+		t.Errorf("Query(%s) succeeded, want an error", QueryDiskUsedBytes)
+	}
+	if n := f.summaryRequests("node-1"); n != 0 {
+		t.Errorf("Query() of an unsupported query made %d requests, want none", n)
+	}
+}
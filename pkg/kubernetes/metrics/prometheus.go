@@ -0,0 +1,282 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"k8s-resource-autoscaler/config"
+	"k8s-resource-autoscaler/pkg/log"
+	"k8s-resource-autoscaler/pkg/prometheus"
+	"k8s-resource-autoscaler/pkg/telemetry"
+)
+
+// Prometheus is a MetricsSource that evaluates PromQL queries against the
+// Prometheus HTTP API.
+type Prometheus struct {
+	// URL is the base URL of the Prometheus server.
+	URL string
+	// Queries maps query names to PromQL. It holds the built-in disk_usage,
+	// ingress and egress queries as well as any user-defined ones.
+	Queries map[string]string
+	// BatchQueries are the queries Snapshot uses to fetch the disk_usage,
+	// inode_usage, disk_used_bytes, disk_capacity_bytes, ingress and egress
+	// of all objects at once.
+	BatchQueries map[string]string
+	// Client performs the requests.
+	Client *prometheus.Client
+}
+
+// Default batch queries, used when none are configured.
+const (
+	defaultBatchDiskUsageQuery         = `sum by (namespace, persistentvolumeclaim) (kubelet_volume_stats_used_bytes) / sum by (namespace, persistentvolumeclaim) (kubelet_volume_stats_capacity_bytes) * 100`
+	defaultBatchInodeUsageQuery        = `sum by (namespace, persistentvolumeclaim) (kubelet_volume_stats_inodes_used) / sum by (namespace, persistentvolumeclaim) (kubelet_volume_stats_inodes) * 100`
+	defaultBatchDiskUsedBytesQuery     = `sum by (namespace, persistentvolumeclaim) (kubelet_volume_stats_used_bytes)`
+	defaultBatchDiskCapacityBytesQuery = `sum by (namespace, persistentvolumeclaim) (kubelet_volume_stats_capacity_bytes)`
+	defaultBatchIngressQuery           = `sum by (namespace, pod) (rate(container_network_receive_bytes_total[30m]))`
+	defaultBatchEgressQuery            = `sum by (namespace, pod) (rate(container_network_transmit_bytes_total[30m]))`
+)
+
+// Default forecast queries, used when prometheus.queries does not set them.
+const (
+	defaultDiskUsedBytesQuery     = `sum(kubelet_volume_stats_used_bytes{persistentvolumeclaim="{{pvc_name}}", namespace="{{namespace}}"})`
+	defaultDiskCapacityBytesQuery = `sum(kubelet_volume_stats_capacity_bytes{persistentvolumeclaim="{{pvc_name}}", namespace="{{namespace}}"})`
+)
+
+// defaultInodeUsageQuery is used when prometheus.inode_usage_query is not set.
+const defaultInodeUsageQuery = `sum(kubelet_volume_stats_inodes_used{persistentvolumeclaim="{{pvc_name}}", namespace="{{namespace}}"}) / sum(kubelet_volume_stats_inodes{persistentvolumeclaim="{{pvc_name}}", namespace="{{namespace}}"}) * 100`
+
+// NewPrometheus returns a Prometheus source using the configured URL,
+// credentials and queries. The latency and errors of its queries are
+// exported with the cluster label.
+func NewPrometheus(cfg config.PrometheusConfig, cluster string) (*Prometheus, error) {
+	clientConfig := prometheus.Config{
+		URL:             cfg.URL,
+		BearerToken:     cfg.BearerToken,
+		BearerTokenFile: cfg.BearerTokenFile,
+		Headers:         cfg.Headers,
+		TLS: prometheus.TLSConfig{
+			CAFile:             cfg.TLS.CAFile,
+			CertFile:           cfg.TLS.CertFile,
+			KeyFile:            cfg.TLS.KeyFile,
+			ServerName:         cfg.TLS.ServerName,
+			InsecureSkipVerify: cfg.TLS.InsecureSkipVerify,
+		},
+		Timeout:      cfg.Timeout,
+		Retries:      cfg.Retries,
+		RetryBackoff: cfg.RetryBackoff,
+		Observe: func(duration time.Duration, err error) {
+			telemetry.PrometheusQueryDuration.WithLabelValues(cluster).Observe(duration.Seconds())
+			if err != nil {
+				telemetry.PrometheusQueryErrors.WithLabelValues(cluster).Inc()
+			}
+		},
+	}
+	if cfg.BasicAuth != nil {
+		clientConfig.BasicAuth = &prometheus.BasicAuth{
+			Username:     cfg.BasicAuth.Username,
+			Password:     cfg.BasicAuth.Password,
+			PasswordFile: cfg.BasicAuth.PasswordFile,
+		}
+	}
+	client, err := prometheus.New(clientConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	queries := map[string]string{
+		QueryDiskUsedBytes:     defaultDiskUsedBytesQuery,
+		QueryDiskCapacityBytes: defaultDiskCapacityBytesQuery,
+	}
+	for name, query := range cfg.Queries {
+		queries[name] = query
+	}
+	queries[QueryDiskUsage] = cfg.DiskUsageQuery
+	queries[QueryInodeUsage] = defaultInodeUsageQuery
+	if cfg.InodeUsageQuery != "" {
+		queries[QueryInodeUsage] = cfg.InodeUsageQuery
+	}
+	queries[QueryIngress] = cfg.NetworkUsageQueries.Ingress
+	queries[QueryEgress] = cfg.NetworkUsageQueries.Egress
+	batch := map[string]string{
+		QueryDiskUsage:         defaultBatchDiskUsageQuery,
+		QueryInodeUsage:        defaultBatchInodeUsageQuery,
+		QueryDiskUsedBytes:     defaultBatchDiskUsedBytesQuery,
+		QueryDiskCapacityBytes: defaultBatchDiskCapacityBytesQuery,
+		QueryIngress:           defaultBatchIngressQuery,
+		QueryEgress:            defaultBatchEgressQuery,
+	}
+	if cfg.BatchQueries.DiskUsage != "" {
+		batch[QueryDiskUsage] = cfg.BatchQueries.DiskUsage
+	}
+	if cfg.BatchQueries.InodeUsage != "" {
+		batch[QueryInodeUsage] = cfg.BatchQueries.InodeUsage
+	}
+	if cfg.BatchQueries.DiskUsedBytes != "" {
+		batch[QueryDiskUsedBytes] = cfg.BatchQueries.DiskUsedBytes
+	}
+	if cfg.BatchQueries.DiskCapacityBytes != "" {
+		batch[QueryDiskCapacityBytes] = cfg.BatchQueries.DiskCapacityBytes
+	}
+	if cfg.BatchQueries.Ingress != "" {
+		batch[QueryIngress] = cfg.BatchQueries.Ingress
+	}
+	if cfg.BatchQueries.Egress != "" {
+		batch[QueryEgress] = cfg.BatchQueries.Egress
+	}
+	return &Prometheus{URL: cfg.URL, Queries: queries, BatchQueries: batch, Client: client}, nil
+}
+
+// DiskUsage queries Prometheus for disk usage percentage
+func (p *Prometheus) DiskUsage(ctx context.Context, namespace, pvcName string) (float64, error) {
+	return p.Query(ctx, QueryDiskUsage, Vars{Namespace: namespace, PVC: pvcName})
+}
+
+// NetworkUsage queries Prometheus for ingress and egress network usage
+func (p *Prometheus) NetworkUsage(ctx context.Context, namespace, podName string) (float64, float64, error) {
+	vars := Vars{Namespace: namespace, Pod: podName}
+	ingress, err := p.Query(ctx, QueryIngress, vars)
+	if err != nil {
+		return 0, 0, fmt.Errorf("error fetching ingress: %v", err)
+	}
+	egress, err := p.Query(ctx, QueryEgress, vars)
+	if err != nil {
+		return ingress, 0, fmt.Errorf("error fetching egress: %v", err)
+	}
+	return ingress, egress, nil
+}
+
+// Query evaluates the named query with its placeholders replaced by vars.
+func (p *Prometheus) Query(ctx context.Context, name string, vars Vars) (float64, error) {
+	query, ok := p.Queries[name]
+	if !ok || query == "" {
+		return 0, fmt.Errorf("no Prometheus query named %s is configured", name)
+	}
+	return p.query(ctx, ReplacePlaceholders(query, vars.PVC, vars.Namespace, vars.Pod))
+}
+
+// QueryRange evaluates the named query between start and end with its
+// placeholders replaced by vars. The query must return a single series.
+func (p *Prometheus) QueryRange(ctx context.Context, name string, vars Vars, start, end time.Time, step time.Duration) ([]prometheus.Point, error) {
+	query, ok := p.Queries[name]
+	if !ok || query == "" {
+		return nil, fmt.Errorf("no Prometheus query named %s is configured", name)
+	}
+	query = ReplacePlaceholders(query, vars.PVC, vars.Namespace, vars.Pod)
+	log.Debug("Querying Prometheus at %s over %s: %s", p.URL, end.Sub(start), query)
+
+	result, err := p.Client.QueryRange(ctx, query, start, end, step)
+	if err != nil {
+		return nil, err
+	}
+	if result.Type != prometheus.ValueMatrix {
+		return nil, fmt.Errorf("range query %q returned a %s, expected a matrix", query, result.Type)
+	}
+	switch len(result.Matrix) {
+	case 0:
+		return nil, fmt.Errorf("range query %q: %v", query, prometheus.ErrNoData)
+	case 1:
+		return result.Matrix[0].Points, nil
+	}
+	return nil, fmt.Errorf("range query %q: %v", query, &prometheus.MultipleSeriesError{Count: len(result.Matrix)})
+}
+
+// query runs an instant query that must return a single series.
+func (p *Prometheus) query(ctx context.Context, query string) (float64, error) {
+	log.Debug("Querying Prometheus at %s: %s", p.URL, query)
+
+	result, err := p.Client.Query(ctx, query, time.Time{})
+	if err != nil {
+		return 0, err
+	}
+	value, err := result.Single()
+	if err != nil {
+		return 0, fmt.Errorf("query %q: %v", query, err)
+	}
+	return value, nil
+}
+
+// Snapshot fetches the disk usage and byte counts of every PVC and the
+// network usage of every pod with one query per metric. A failed query is logged and its
+// lookups fall back to per-object queries.
+func (p *Prometheus) Snapshot(ctx context.Context) (*Snapshot, error) {
+	snapshot := NewSnapshot(p)
+
+	disk, diskErr := p.batch(ctx, QueryDiskUsage, "persistentvolumeclaim")
+	if diskErr != nil {
+		log.Warning("Error fetching disk usage snapshot: %v", diskErr)
+	}
+	for key, value := range disk {
+		snapshot.SetDiskUsage(key[0], key[1], value)
+	}
+
+	// Inode usage is optional, lookups fall back to per-object queries
+	inodes, err := p.batch(ctx, QueryInodeUsage, "persistentvolumeclaim")
+	if err != nil {
+		log.Debug("Error fetching inode usage snapshot: %v", err)
+	}
+	for key, value := range inodes {
+		snapshot.SetInodeUsage(key[0], key[1], value)
+	}
+
+	// The byte counts are only needed to forecast, which falls back to
+	// per-object queries too
+	used, err := p.batch(ctx, QueryDiskUsedBytes, "persistentvolumeclaim")
+	if err != nil {
+		log.Debug("Error fetching used bytes snapshot: %v", err)
+	}
+	capacity, err := p.batch(ctx, QueryDiskCapacityBytes, "persistentvolumeclaim")
+	if err != nil {
+		log.Debug("Error fetching capacity snapshot: %v", err)
+	}
+	for key, value := range used {
+		if total, ok := capacity[key]; ok {
+			snapshot.SetDiskBytes(key[0], key[1], value, total)
+		}
+	}
+
+	rx, rxErr := p.batch(ctx, QueryIngress, "pod")
+	if rxErr != nil {
+		log.Warning("Error fetching ingress snapshot: %v", rxErr)
+	}
+	tx, txErr := p.batch(ctx, QueryEgress, "pod")
+	if txErr != nil {
+		log.Warning("Error fetching egress snapshot: %v", txErr)
+	}
+	if rxErr == nil && txErr == nil {
+		for key, value := range rx {
+			snapshot.SetNetworkUsage(key[0], key[1], value, tx[key])
+		}
+	}
+
+	if diskErr != nil && rxErr != nil && txErr != nil {
+		return nil, fmt.Errorf("all snapshot queries failed")
+	}
+	return snapshot, nil
+}
+
+// batch runs a batch query and returns its samples keyed by their
+// namespace and the given object label.
+func (p *Prometheus) batch(ctx context.Context, name, label string) (map[[2]string]float64, error) {
+	query := p.BatchQueries[name]
+	if query == "" {
+		return nil, fmt.Errorf("no batch query named %s is configured", name)
+	}
+	result, err := p.Client.Query(ctx, query, time.Time{})
+	if err != nil {
+		return nil, err
+	}
+	if result.Type != prometheus.ValueVector {
+		return nil, fmt.Errorf("batch query %s returned a %s, expected a vector", name, result.Type)
+	}
+
+	values := make(map[[2]string]float64, len(result.Vector))
+	for _, sample := range result.Vector {
+		namespace, object := sample.Metric["namespace"], sample.Metric[label]
+		if namespace == "" || object == "" {
+			return nil, fmt.Errorf("batch query %s must group by namespace and %s", name, label)
+		}
+		values[[2]string{namespace, object}] = sample.Value
+	}
+	return values, nil
+}
@@ -0,0 +1,406 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"k8s-resource-autoscaler/config"
+	"k8s-resource-autoscaler/pkg/prometheus"
+)
+
+// Test queries, with the placeholders the built-in queries use.
+const (
+	testDiskQuery    = `disk{namespace="{{namespace}}", pvc="{{pvc_name}}"}`
+	testIngressQuery = `rx{namespace="{{namespace}}", pod="{{pod_name}}"}`
+	testEgressQuery  = `tx{namespace="{{namespace}}", pod="{{pod_name}}"}`
+)
+
+// response is a canned Prometheus API response.
+type response struct {
+	status int
+	body   string
+}
+
+func success(resultType, result string) response {
+	return response{http.StatusOK, fmt.Sprintf(`{"status":"success","data":{"resultType":%q,"result":[%s]}}`, resultType, result)}
+}
+
+func vector(samples ...string) response {
+	return success("vector", strings.Join(samples, ","))
+}
+
+func matrix(series ...string) response {
+	return success("matrix", strings.Join(series, ","))
+}
+
+// sample returns a vector element with the given labels, as name=value pairs.
+func sample(value string, labels ...string) string {
+	return fmt.Sprintf(`{"metric":{%s},"value":[1700000000,%q]}`, metric(labels), value)
+}
+
+// series returns a matrix element with a point a minute for each value.
+func series(values ...string) string {
+	points := make([]string, 0, len(values))
+	for i, value := range values {
+		points = append(points, fmt.Sprintf(`[%d,%q]`, 1700000000+60*i, value))
+	}
+	return fmt.Sprintf(`{"metric":{},"values":[%s]}`, strings.Join(points, ","))
+}
+
+func metric(labels []string) string {
+	pairs := make([]string, 0, len(labels))
+	for _, label := range labels {
+		parts := strings.SplitN(label, "=", 2)
+		pairs = append(pairs, fmt.Sprintf(`%q:%q`, parts[0], parts[1]))
+	}
+	return strings.Join(pairs, ",")
+}
+
+func apiError(status int, errorType, message string) response {
+	return response{status, fmt.Sprintf(`{"status":"error","errorType":%q,"error":%q}`, errorType, message)}
+}
+
+// fakePrometheus answers queries from canned responses keyed by the query
+// text, and counts the requests it serves.
+type fakePrometheus struct {
+	mu        sync.Mutex
+	responses map[string]response
+	requests  map[string]int
+}
+
+func newFakePrometheus(t *testing.T, responses map[string]response) (*fakePrometheus, *httptest.Server) {
+	t.Helper()
+	f := &fakePrometheus{responses: responses, requests: map[string]int{}}
+	server := httptest.NewServer(f)
+	t.Cleanup(server.Close)
+	return f, server
+}
+
+func (f *fakePrometheus) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || (r.URL.Path != "/api/v1/query" && r.URL.Path != "/api/v1/query_range") {
+		http.NotFound(w, r)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	query := r.PostForm.Get("query")
+
+	f.mu.Lock()
+	f.requests[query]++
+	resp, ok := f.responses[query]
+	f.mu.Unlock()
+	if !ok {
+		resp = apiError(http.StatusBadRequest, "bad_data", "unexpected query "+query)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(resp.status)
+	fmt.Fprint(w, resp.body)
+}
+
+// count returns the number of requests made for query.
+func (f *fakePrometheus) count(query string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.requests[query]
+}
+
+// total returns the number of requests made for all queries.
+func (f *fakePrometheus) total() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n := 0
+	for _, count := range f.requests {
+		n += count
+	}
+	return n
+}
+
+func newTestPrometheus(t *testing.T, url string) *Prometheus {
+	t.Helper()
+	cfg := config.PrometheusConfig{
+		URL:            url,
+		DiskUsageQuery: testDiskQuery,
+		Retries:        1,
+		RetryBackoff:   time.Millisecond,
+	}
+	cfg.NetworkUsageQueries.Ingress = testIngressQuery
+	cfg.NetworkUsageQueries.Egress = testEgressQuery
+	p, err := NewPrometheus(cfg, "test")
+	if err != nil {
+		t.Fatalf("NewPrometheus() error = %v", err)
+	}
+	return p
+}
+
+func TestPrometheusDiskUsage(t *testing.T) {
+	query := `disk{namespace="shop", pvc="data"}`
+	tests := []struct {
+		name         string
+		response     response
+		want         float64
+		wantErr      string
+		wantRequests int
+	}{
+		{name: "single series", response: vector(sample("42.5")), want: 42.5, wantRequests: 1},
+		{name: "scalar", response: success("scalar", `1700000000,"17"`), want: 17, wantRequests: 1},
+		{name: "empty result", response: vector(), wantErr: prometheus.ErrNoData.Error(), wantRequests: 1},
+		{name: "several series", response: vector(sample("1", "pod=a"), sample("2", "pod=b")), wantErr: "2 series", wantRequests: 1},
+		{name: "bad query", response: apiError(http.StatusBadRequest, "bad_data", "parse error"), wantErr: "bad_data: parse error", wantRequests: 1},
+		{name: "server error is retried", response: response{http.StatusInternalServerError, "oops"}, wantErr: "500", wantRequests: 2},
+		{name: "rate limited is retried", response: response{http.StatusTooManyRequests, ""}, wantErr: "429", wantRequests: 2},
+		{name: "malformed response", response: response{http.StatusOK, "not json"}, wantErr: "unmarshalling", wantRequests: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, server := newFakePrometheus(t, map[string]response{query: tt.response})
+			p := newTestPrometheus(t, server.URL)
+
+			got, err := p.DiskUsage(context.Background(), "shop", "data")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("DiskUsage() = %v, %v, want an error containing %q", got, err, tt.wantErr)
+				}
+			} else if err != nil || got != tt.want {
+				t.Errorf("DiskUsage() = %v, %v, want %v", got, err, tt.want)
+			}
+			if n := f.count(query); n != tt.wantRequests {
+				t.Errorf("server got %d requests for %s, want %d", n, query, tt.wantRequests)
+			}
+		})
+	}
+}
+
+func TestPrometheusNetworkUsage(t *testing.T) {
+	ingress := `rx{namespace="shop", pod="web-1"}`
+	egress := `tx{namespace="shop", pod="web-1"}`
+	tests := []struct {
+		name      string
+		responses map[string]response
+		wantRx    float64
+		wantTx    float64
+		wantErr   string
+	}{
+		{
+			name:      "both rates",
+			responses: map[string]response{ingress: vector(sample("100")), egress: vector(sample("50"))},
+			wantRx:    100,
+			wantTx:    50,
+		},
+		{
+			name:      "no ingress data",
+			responses: map[string]response{ingress: vector(), egress: vector(sample("50"))},
+			wantErr:   "error fetching ingress",
+		},
+		{
+			name:      "egress fails",
+			responses: map[string]response{ingress: vector(sample("100")), egress: response{http.StatusServiceUnavailable, ""}},
+			wantRx:    100,
+			wantErr:   "error fetching egress",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, server := newFakePrometheus(t, tt.responses)
+			p := newTestPrometheus(t, server.URL)
+
+			rx, tx, err := p.NetworkUsage(context.Background(), "shop", "web-1")
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("NetworkUsage() error = %v, want an error containing %q", err, tt.wantErr)
+			}
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("NetworkUsage() error = %v", err)
+			}
+			if rx != tt.wantRx || tx != tt.wantTx {
+				t.Errorf("NetworkUsage() = %v, %v, want %v, %v", rx, tx, tt.wantRx, tt.wantTx)
+			}
+		})
+	}
+}
+
+func TestPrometheusQueryNotConfigured(t *testing.T) {
+	f, server := newFakePrometheus(t, nil)
+	p := newTestPrometheus(t, server.URL)
+	p.Queries[QueryEgress] = ""
+
+	if _, err := p.Query(context.Background(), "missing", Vars{}); err == nil {
+		t.Errorf("Query() of an unknown query succeeded")
+	}
+	if _, _, err := p.NetworkUsage(context.Background(), "shop", "web-1"); err == nil {
+		t.Errorf("NetworkUsage() without an egress query succeeded")
+	}
+	if n := f.count(`tx{namespace="shop", pod="web-1"}`); n != 0 {
+		t.Errorf("server got %d requests for the unconfigured egress query, want none", n)
+	}
+}
+
+func TestPrometheusQueryRange(t *testing.T) {
+	query := `disk_used_bytes{pvc="data"}`
+	start := time.Unix(1700000000, 0)
+	tests := []struct {
+		name     string
+		response response
+		want     []float64
+		wantErr  string
+	}{
+		{name: "single series", response: matrix(series("1", "2", "3")), want: []float64{1, 2, 3}},
+		{name: "empty result", response: matrix(), wantErr: prometheus.ErrNoData.Error()},
+		{name: "several series", response: matrix(series("1"), series("2")), wantErr: "2 series"},
+		{name: "not a matrix", response: vector(sample("1")), wantErr: "expected a matrix"},
+		{name: "server error", response: response{http.StatusBadGateway, ""}, wantErr: "502"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, server := newFakePrometheus(t, map[string]response{query: tt.response})
+			p := newTestPrometheus(t, server.URL)
+			p.Queries[QueryDiskUsedBytes] = `disk_used_bytes{pvc="{{pvc_name}}"}`
+
+			points, err := p.QueryRange(context.Background(), QueryDiskUsedBytes, Vars{PVC: "data"}, start, start.Add(2*time.Minute), time.Minute)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("QueryRange() error = %v, want an error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("QueryRange() error = %v", err)
+			}
+			if len(points) != len(tt.want) {
+				t.Fatalf("QueryRange() returned %d points, want %d", len(points), len(tt.want))
+			}
+			for i, point := range points {
+				if want := start.Add(time.Duration(i) * time.Minute); point.Value != tt.want[i] || !point.Time.Equal(want) {
+					t.Errorf("point %d = %v at %s, want %v at %s", i, point.Value, point.Time, tt.want[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestPrometheusSnapshot(t *testing.T) {
+	f, server := newFakePrometheus(t, map[string]response{
+		defaultBatchDiskUsageQuery: vector(
+			sample("80", "namespace=shop", "persistentvolumeclaim=data"),
+			sample("20", "namespace=shop", "persistentvolumeclaim=logs"),
+		),
+		defaultBatchInodeUsageQuery:           vector(),
+		defaultBatchDiskUsedBytesQuery:        vector(sample("8589934592", "namespace=shop", "persistentvolumeclaim=data")),
+		defaultBatchDiskCapacityBytesQuery:    vector(sample("10737418240", "namespace=shop", "persistentvolumeclaim=data")),
+		defaultBatchIngressQuery:              vector(sample("100", "namespace=shop", "pod=web-1")),
+		defaultBatchEgressQuery:               vector(sample("50", "namespace=shop", "pod=web-1")),
+		`disk{namespace="shop", pvc="cache"}`: vector(sample("5")),
+	})
+	p := newTestPrometheus(t, server.URL)
+	ctx := context.Background()
+
+	snapshot, err := p.Snapshot(ctx)
+	if err != nil {
+		t.Fatalf("Snapshot() error = %v", err)
+	}
+	if pvcs, pods := snapshot.Len(); pvcs != 2 || pods != 1 {
+		t.Errorf("snapshot holds %d PVCs and %d pods, want 2 and 1", pvcs, pods)
+	}
+	if n := f.total(); n != 6 {
+		t.Errorf("Snapshot() made %d requests, want one per batch query", n)
+	}
+
+	if got, err := snapshot.DiskUsage(ctx, "shop", "data"); err != nil || got != 80 {
+		t.Errorf("snapshot DiskUsage(data) = %v, %v, want 80", got, err)
+	}
+	if rx, tx, err := snapshot.NetworkUsage(ctx, "shop", "web-1"); err != nil || rx != 100 || tx != 50 {
+		t.Errorf("snapshot NetworkUsage(web-1) = %v, %v, %v, want 100, 50", rx, tx, err)
+	}
+	vars := Vars{Namespace: "shop", PVC: "data"}
+	if got, err := snapshot.Query(ctx, QueryDiskUsedBytes, vars); err != nil || got != 8<<30 {
+		t.Errorf("snapshot Query(%s) = %v, %v, want %v", QueryDiskUsedBytes, got, err, 8<<30)
+	}
+	if got, err := snapshot.Query(ctx, QueryDiskCapacityBytes, vars); err != nil || got != 10<<30 {
+		t.Errorf("snapshot Query(%s) = %v, %v, want %v", QueryDiskCapacityBytes, got, err, 10<<30)
+	}
+	if n := f.total(); n != 6 {
+		t.Errorf("snapshot lookups made %d requests, want none", n-6)
+	}
+
+	// Objects missing from the snapshot are queried one by one
+	if got, err := snapshot.DiskUsage(ctx, "shop", "cache"); err != nil || got != 5 {
+		t.Errorf("snapshot DiskUsage(cache) = %v, %v, want 5 from a live query", got, err)
+	}
+	if n := f.count(`disk{namespace="shop", pvc="cache"}`); n != 1 {
+		t.Errorf("server got %d live queries for cache, want 1", n)
+	}
+}
+
+func TestPrometheusSnapshotErrors(t *testing.T) {
+	unavailable := response{http.StatusServiceUnavailable, ""}
+	tests := []struct {
+		name      string
+		responses map[string]response
+		wantPVCs  int
+		wantPods  int
+		wantErr   bool
+	}{
+		{
+			name: "empty results",
+			responses: map[string]response{
+				defaultBatchDiskUsageQuery:  vector(),
+				defaultBatchInodeUsageQuery: vector(),
+				defaultBatchIngressQuery:    vector(),
+				defaultBatchEgressQuery:     vector(),
+			},
+		},
+		{
+			name: "egress fails",
+			responses: map[string]response{
+				defaultBatchDiskUsageQuery: vector(sample("80", "namespace=shop", "persistentvolumeclaim=data")),
+				defaultBatchIngressQuery:   vector(sample("100", "namespace=shop", "pod=web-1")),
+				defaultBatchEgressQuery:    unavailable,
+			},
+			wantPVCs: 1,
+		},
+		{
+			name: "disk usage not grouped",
+			responses: map[string]response{
+				defaultBatchDiskUsageQuery: vector(sample("80")),
+				defaultBatchIngressQuery:   vector(sample("100", "namespace=shop", "pod=web-1")),
+				defaultBatchEgressQuery:    vector(sample("50", "namespace=shop", "pod=web-1")),
+			},
+			wantPods: 1,
+		},
+		{
+			name: "all fail",
+			responses: map[string]response{
+				defaultBatchDiskUsageQuery: unavailable,
+				defaultBatchIngressQuery:   unavailable,
+				defaultBatchEgressQuery:    unavailable,
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, server := newFakePrometheus(t, tt.responses)
+			p := newTestPrometheus(t, server.URL)
+
+			snapshot, err := p.Snapshot(context.Background())
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Snapshot() succeeded, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Snapshot() error = %v", err)
+			}
+			if pvcs, pods := snapshot.Len(); pvcs != tt.wantPVCs || pods != tt.wantPods {
+				t.Errorf("snapshot holds %d PVCs and %d pods, want %d and %d", pvcs, pods, tt.wantPVCs, tt.wantPods)
+			}
+		})
+	}
+}
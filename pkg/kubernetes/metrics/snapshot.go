@@ -0,0 +1,179 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"k8s-resource-autoscaler/pkg/prometheus"
+)
+
+// Snapshotter is implemented by sources that can fetch the metrics of every
+// PVC and pod at once, with a fixed number of requests per cycle.
+type Snapshotter interface {
+	Snapshot(ctx context.Context) (*Snapshot, error)
+}
+
+// Snapshot is a MetricsSource serving lookups from metrics fetched in bulk.
+// Objects missing from the snapshot, e.g. PVCs created after it was taken or
+// forgotten since, and named queries are answered by the fallback source.
+type Snapshot struct {
+	// Time is when the snapshot was taken.
+	Time time.Time
+
+	mu       sync.RWMutex
+	disk     map[string]float64
+	inodes   map[string]float64
+	used     map[string]float64
+	capacity map[string]float64
+	rx       map[string]float64
+	tx       map[string]float64
+	fallback MetricsSource
+}
+
+// NewSnapshot returns an empty snapshot that defers to fallback.
+func NewSnapshot(fallback MetricsSource) *Snapshot {
+	return &Snapshot{
+		Time:     time.Now(),
+		disk:     map[string]float64{},
+		inodes:   map[string]float64{},
+		used:     map[string]float64{},
+		capacity: map[string]float64{},
+		rx:       map[string]float64{},
+		tx:       map[string]float64{},
+		fallback: fallback,
+	}
+}
+
+func objectKey(namespace, name string) string {
+	return namespace + "/" + name
+}
+
+// SetDiskUsage records the used percentage of a PVC.
+func (s *Snapshot) SetDiskUsage(namespace, pvcName string, percent float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.disk[objectKey(namespace, pvcName)] = percent
+}
+
+// SetInodeUsage records the used inode percentage of a PVC.
+func (s *Snapshot) SetInodeUsage(namespace, pvcName string, percent float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.inodes[objectKey(namespace, pvcName)] = percent
+}
+
+// SetDiskBytes records the used and total bytes of the filesystem of a PVC.
+func (s *Snapshot) SetDiskBytes(namespace, pvcName string, used, capacity float64) {
+	key := objectKey(namespace, pvcName)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.used[key] = used
+	s.capacity[key] = capacity
+}
+
+// SetNetworkUsage records the receive and transmit rates of a pod.
+func (s *Snapshot) SetNetworkUsage(namespace, podName string, rx, tx float64) {
+	key := objectKey(namespace, podName)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rx[key] = rx
+	s.tx[key] = tx
+}
+
+// ForgetPVC drops the usage of a PVC, so later lookups query the fallback
+// source. It is called once the PVC has been resized and the snapshot no
+// longer describes it.
+func (s *Snapshot) ForgetPVC(namespace, pvcName string) {
+	key := objectKey(namespace, pvcName)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.disk, key)
+	delete(s.inodes, key)
+	delete(s.used, key)
+	delete(s.capacity, key)
+}
+
+// Len returns the number of PVCs and pods in the snapshot.
+func (s *Snapshot) Len() (pvcs, pods int) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.disk), len(s.rx)
+}
+
+// DiskUsage returns the used percentage of a PVC.
+func (s *Snapshot) DiskUsage(ctx context.Context, namespace, pvcName string) (float64, error) {
+	s.mu.RLock()
+	percent, ok := s.disk[objectKey(namespace, pvcName)]
+	s.mu.RUnlock()
+	if ok {
+		return percent, nil
+	}
+	if s.fallback == nil {
+		return 0, fmt.Errorf("no disk usage for PVC %s in namespace %s", pvcName, namespace)
+	}
+	return s.fallback.DiskUsage(ctx, namespace, pvcName)
+}
+
+// NetworkUsage returns the receive and transmit rates of a pod.
+func (s *Snapshot) NetworkUsage(ctx context.Context, namespace, podName string) (float64, float64, error) {
+	key := objectKey(namespace, podName)
+	s.mu.RLock()
+	rx, ok := s.rx[key]
+	tx := s.tx[key]
+	s.mu.RUnlock()
+	if ok {
+		return rx, tx, nil
+	}
+	if s.fallback == nil {
+		return 0, 0, fmt.Errorf("no network usage for pod %s in namespace %s", podName, namespace)
+	}
+	return s.fallback.NetworkUsage(ctx, namespace, podName)
+}
+
+// Query answers the built-in queries and the byte counts of PVCs from the
+// snapshot and passes others to the fallback source.
+func (s *Snapshot) Query(ctx context.Context, name string, vars Vars) (float64, error) {
+	switch name {
+	case QueryDiskUsage:
+		return s.DiskUsage(ctx, vars.Namespace, vars.PVC)
+	case QueryInodeUsage:
+		s.mu.RLock()
+		percent, ok := s.inodes[objectKey(vars.Namespace, vars.PVC)]
+		s.mu.RUnlock()
+		if ok {
+			return percent, nil
+		}
+	case QueryDiskUsedBytes, QueryDiskCapacityBytes:
+		values := s.used
+		if name == QueryDiskCapacityBytes {
+			values = s.capacity
+		}
+		s.mu.RLock()
+		bytes, ok := values[objectKey(vars.Namespace, vars.PVC)]
+		s.mu.RUnlock()
+		if ok {
+			return bytes, nil
+		}
+	case QueryIngress:
+		rx, _, err := s.NetworkUsage(ctx, vars.Namespace, vars.Pod)
+		return rx, err
+	case QueryEgress:
+		_, tx, err := s.NetworkUsage(ctx, vars.Namespace, vars.Pod)
+		return tx, err
+	}
+	if s.fallback == nil {
+		return 0, fmt.Errorf("query %s is not in the snapshot", name)
+	}
+	return s.fallback.Query(ctx, name, vars)
+}
+
+// QueryRange passes range queries to the fallback source.
+func (s *Snapshot) QueryRange(ctx context.Context, name string, vars Vars, start, end time.Time, step time.Duration) ([]prometheus.Point, error) {
+	querier, ok := s.fallback.(RangeQuerier)
+	if !ok {
+		return nil, fmt.Errorf("the metrics source does not support range queries")
+	}
+	return querier.QueryRange(ctx, name, vars, start, end, step)
+}
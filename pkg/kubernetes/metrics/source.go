@@ -0,0 +1,78 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"k8s-resource-autoscaler/config"
+	"k8s-resource-autoscaler/pkg/prometheus"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Names of the metrics sources selectable in the configuration.
+const (
+	SourcePrometheus = "prometheus"
+	SourceKubelet    = "kubelet"
+)
+
+// Names of the built-in queries every MetricsSource answers.
+const (
+	QueryDiskUsage  = "disk_usage"
+	QueryInodeUsage = "inode_usage"
+	QueryIngress    = "ingress"
+	QueryEgress     = "egress"
+)
+
+// Names of the queries used to forecast disk usage. Only Prometheus answers
+// them.
+const (
+	QueryDiskUsedBytes     = "disk_used_bytes"
+	QueryDiskCapacityBytes = "disk_capacity_bytes"
+)
+
+// Vars are the values substituted into the placeholders of a query.
+type Vars struct {
+	Namespace string
+	PVC       string
+	Pod       string
+}
+
+// MetricsSource provides the usage metrics the autoscaler acts on.
+type MetricsSource interface {
+	// DiskUsage returns the used percentage of a PVC.
+	DiskUsage(ctx context.Context, namespace, pvcName string) (float64, error)
+	// NetworkUsage returns the receive and transmit rates of a pod in bytes/sec.
+	NetworkUsage(ctx context.Context, namespace, podName string) (rx, tx float64, err error)
+	// Query evaluates a named query for the object described by vars.
+	Query(ctx context.Context, name string, vars Vars) (float64, error)
+}
+
+// RangeQuerier is implemented by sources that can evaluate a named query
+// over a time range.
+type RangeQuerier interface {
+	// QueryRange returns the points of the single series the query returns
+	// between start and end.
+	QueryRange(ctx context.Context, name string, vars Vars, start, end time.Time, step time.Duration) ([]prometheus.Point, error)
+}
+
+// NewSource returns the MetricsSource selected in the configuration for the
+// named cluster.
+func NewSource(clientset kubernetes.Interface, cfg *config.AutoscalerConfig, cluster string) (MetricsSource, error) {
+	switch cfg.Metrics.Source {
+	case "", SourcePrometheus:
+		return NewPrometheus(cfg.Prometheus, cluster)
+	case SourceKubelet:
+		return NewKubelet(clientset), nil
+	}
+	return nil, fmt.Errorf("unknown metrics source %q, expected %s or %s", cfg.Metrics.Source, SourcePrometheus, SourceKubelet)
+}
+
+// ReplacePlaceholders replaces placeholders in the query with actual values
+func ReplacePlaceholders(query string, pvcName, namespace, podName string) string {
+	query = strings.ReplaceAll(query, "{{pvc_name}}", pvcName)
+	query = strings.ReplaceAll(query, "{{namespace}}", namespace)
+	query = strings.ReplaceAll(query, "{{pod_name}}", podName)
+	return query
+}
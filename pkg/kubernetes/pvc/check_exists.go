@@ -9,7 +9,7 @@ import (
 )
 
 // CheckPVCExists checks if a PVC exists in a specific namespace
-func CheckPVCExists(clientset *kubernetes.Clientset, pvcName, namespace string) (bool, error) {
+func CheckPVCExists(clientset kubernetes.Interface, pvcName, namespace string) (bool, error) {
 	log.Info("Checking if PVC %s exists in namespace %s", pvcName, namespace)
 
 	_, err := clientset.CoreV1().PersistentVolumeClaims(namespace).Get(context.TODO(), pvcName, metav1.GetOptions{})
@@ -0,0 +1,113 @@
+package pvc
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// Sample is a value of a series at a point in time.
+type Sample struct {
+	Time  time.Time
+	Value float64
+}
+
+// minForecastSamples is the fewest samples a trend is fitted to.
+const minForecastSamples = 3
+
+// Trend is a straight line fitted to a series, like PromQL's predict_linear.
+type Trend struct {
+	// Origin is the time Intercept is the value at.
+	Origin    time.Time
+	Intercept float64
+	// Slope is the growth per second.
+	Slope float64
+}
+
+// At returns the value of the trend at t.
+func (t Trend) At(at time.Time) float64 {
+	return t.Intercept + t.Slope*at.Sub(t.Origin).Seconds()
+}
+
+// FitLinear fits a trend to the samples by least squares.
+func FitLinear(samples []Sample) (Trend, error) {
+	if len(samples) < minForecastSamples {
+		return Trend{}, fmt.Errorf("%d samples are not enough to fit a trend, need %d", len(samples), minForecastSamples)
+	}
+	origin := samples[0].Time
+	var sumX, sumY, sumXY, sumXX float64
+	for _, s := range samples {
+		x := s.Time.Sub(origin).Seconds()
+		sumX += x
+		sumY += s.Value
+		sumXY += x * s.Value
+		sumXX += x * x
+	}
+	n := float64(len(samples))
+	denominator := n*sumXX - sumX*sumX
+	if denominator == 0 {
+		return Trend{}, fmt.Errorf("samples span no time")
+	}
+	slope := (n*sumXY - sumX*sumY) / denominator
+	return Trend{Origin: origin, Intercept: (sumY - slope*sumX) / n, Slope: slope}, nil
+}
+
+// Forecast projects the used bytes of a volume from their recent trend.
+type Forecast struct {
+	Trend Trend
+	// Capacity is the size of the volume's filesystem in bytes.
+	Capacity float64
+	Now      time.Time
+}
+
+// NewForecast fits a forecast to the used bytes of a volume whose
+// filesystem holds capacity bytes.
+func NewForecast(used []Sample, capacity float64, now time.Time) (Forecast, error) {
+	if capacity <= 0 {
+		return Forecast{}, fmt.Errorf("capacity %.0f must be positive", capacity)
+	}
+	trend, err := FitLinear(used)
+	if err != nil {
+		return Forecast{}, err
+	}
+	return Forecast{Trend: trend, Capacity: capacity, Now: now}, nil
+}
+
+// TimeToFull returns how long until the volume is projected to be full. It
+// returns false when usage is not growing.
+func (f Forecast) TimeToFull() (time.Duration, bool) {
+	if f.Trend.Slope <= 0 {
+		return 0, false
+	}
+	remaining := (f.Capacity - f.Trend.At(f.Now)) / f.Trend.Slope
+	if remaining <= 0 {
+		return 0, true
+	}
+	if remaining > math.MaxInt64/float64(time.Second) {
+		return 0, false
+	}
+	return time.Duration(remaining * float64(time.Second)), true
+}
+
+// SizeFor returns the request that keeps the projected usage at or below
+// utilizationPercent until period from now, scaling the current request by
+// the projected used fraction of the filesystem. It returns current when
+// no growth is needed.
+func (f Forecast) SizeFor(current resource.Quantity, period time.Duration, utilizationPercent int) resource.Quantity {
+	if utilizationPercent <= 0 || utilizationPercent > 100 {
+		utilizationPercent = 100
+	}
+	projected := f.Trend.At(f.Now.Add(period)) / f.Capacity
+	size := math.Ceil(float64(current.Value()) * projected * 100 / float64(utilizationPercent))
+	if size <= float64(current.Value()) || size > math.MaxInt64 {
+		return current
+	}
+	return *resource.NewQuantity(int64(size), resource.BinarySI)
+}
+
+// GrowthPerHour returns the trend's growth in bytes per hour.
+func (f Forecast) GrowthPerHour() float64 {
+	return f.Trend.Slope * time.Hour.Seconds()
+}
@@ -0,0 +1,153 @@
+package pvc
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+var forecastOrigin = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// hourly returns samples an hour apart starting at forecastOrigin.
+func hourly(values ...float64) []Sample {
+	samples := make([]Sample, 0, len(values))
+	for i, v := range values {
+		samples = append(samples, Sample{Time: forecastOrigin.Add(time.Duration(i) * time.Hour), Value: v})
+	}
+	return samples
+}
+
+// Series used by the tests, in bytes. growing adds a byte per second.
+var (
+	growing   = hourly(0, 3600, 7200)
+	flat      = hourly(7200, 7200, 7200)
+	shrinking = hourly(7200, 3600, 0)
+)
+
+func TestFitLinear(t *testing.T) {
+	tests := []struct {
+		name          string
+		samples       []Sample
+		wantSlope     float64
+		wantIntercept float64
+		wantErr       bool
+	}{
+		{name: "linear growth", samples: growing, wantSlope: 1, wantIntercept: 0},
+		{name: "flat", samples: flat, wantSlope: 0, wantIntercept: 7200},
+		{name: "shrinking", samples: shrinking, wantSlope: -1, wantIntercept: 7200},
+		{name: "noisy growth", samples: hourly(0, 7200, 3600, 10800), wantSlope: 0.8, wantIntercept: 1080},
+		{name: "too few samples", samples: hourly(0, 3600), wantErr: true},
+		{name: "no samples", samples: nil, wantErr: true},
+		{name: "no time span", samples: []Sample{{forecastOrigin, 1}, {forecastOrigin, 2}, {forecastOrigin, 3}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trend, err := FitLinear(tt.samples)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("FitLinear() = %+v, want an error", trend)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("FitLinear() error = %v", err)
+			}
+			if math.Abs(trend.Slope-tt.wantSlope) > 1e-9 || math.Abs(trend.Intercept-tt.wantIntercept) > 1e-6 {
+				t.Errorf("FitLinear() slope %v, intercept %v, want %v, %v", trend.Slope, trend.Intercept, tt.wantSlope, tt.wantIntercept)
+			}
+			if !trend.Origin.Equal(forecastOrigin) {
+				t.Errorf("FitLinear() origin %s, want %s", trend.Origin, forecastOrigin)
+			}
+		})
+	}
+}
+
+func TestNewForecast(t *testing.T) {
+	now := forecastOrigin.Add(2 * time.Hour)
+	tests := []struct {
+		name     string
+		samples  []Sample
+		capacity float64
+		wantErr  bool
+	}{
+		{name: "linear growth", samples: growing, capacity: 14400},
+		{name: "flat", samples: flat, capacity: 14400},
+		{name: "too few samples", samples: hourly(0), capacity: 14400, wantErr: true},
+		{name: "zero capacity", samples: growing, capacity: 0, wantErr: true},
+		{name: "negative capacity", samples: growing, capacity: -1, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := NewForecast(tt.samples, tt.capacity, now)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewForecast() error = %v, want error: %v", err, tt.wantErr)
+			}
+			if err == nil && (f.Capacity != tt.capacity || !f.Now.Equal(now)) {
+				t.Errorf("NewForecast() = %+v, want capacity %v at %s", f, tt.capacity, now)
+			}
+		})
+	}
+}
+
+func TestTimeToFull(t *testing.T) {
+	now := forecastOrigin.Add(2 * time.Hour)
+	tests := []struct {
+		name        string
+		samples     []Sample
+		capacity    float64
+		want        time.Duration
+		wantGrowing bool
+	}{
+		{name: "linear growth", samples: growing, capacity: 14400, want: 2 * time.Hour, wantGrowing: true},
+		{name: "already full", samples: growing, capacity: 5000, want: 0, wantGrowing: true},
+		{name: "flat", samples: flat, capacity: 14400, want: 0, wantGrowing: false},
+		{name: "shrinking", samples: shrinking, capacity: 14400, want: 0, wantGrowing: false},
+		{name: "too far to represent", samples: hourly(0, 1e-6, 2e-6), capacity: 1e300, want: 0, wantGrowing: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := NewForecast(tt.samples, tt.capacity, now)
+			if err != nil {
+				t.Fatalf("NewForecast() error = %v", err)
+			}
+			got, growing := f.TimeToFull()
+			if got != tt.want || growing != tt.wantGrowing {
+				t.Errorf("TimeToFull() = %s, %v, want %s, %v", got, growing, tt.want, tt.wantGrowing)
+			}
+		})
+	}
+}
+
+func TestSizeFor(t *testing.T) {
+	now := forecastOrigin.Add(2 * time.Hour)
+	current := resource.MustParse("10Gi")
+	tests := []struct {
+		name        string
+		samples     []Sample
+		period      time.Duration
+		utilization int
+		want        string
+	}{
+		// Half full now and growing by the capacity every 4h
+		{name: "full at the end of the period", samples: growing, period: 2 * time.Hour, utilization: 80, want: "12800Mi"},
+		{name: "twice the capacity at the end of the period", samples: growing, period: 6 * time.Hour, utilization: 100, want: "20Gi"},
+		{name: "utilization out of range means 100", samples: growing, period: 6 * time.Hour, utilization: 0, want: "20Gi"},
+		{name: "no growth needed", samples: growing, period: 0, utilization: 50, want: "10Gi"},
+		{name: "flat", samples: flat, period: 24 * time.Hour, utilization: 80, want: "10Gi"},
+		{name: "shrinking", samples: shrinking, period: 24 * time.Hour, utilization: 80, want: "10Gi"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := NewForecast(tt.samples, 14400, now)
+			if err != nil {
+				t.Fatalf("NewForecast() error = %v", err)
+			}
+			got := f.SizeFor(current, tt.period, tt.utilization)
+			if want := resource.MustParse(tt.want); got.Cmp(want) != 0 {
+				t.Errorf("SizeFor() = %s, want %s", got.String(), want.String())
+			}
+		})
+	}
+}
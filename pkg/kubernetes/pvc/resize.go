@@ -3,6 +3,9 @@ package pvc
 import (
 	"context"
 	"fmt"
+	"math"
+	"time"
+
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
@@ -10,33 +13,293 @@ import (
 	"k8s.io/client-go/kubernetes"
 )
 
-// ResizePVC resizes the PVC by 50% if its usage exceeds 50%.
+// GrowthStrategy selects how the new size of a PVC is calculated.
+type GrowthStrategy string
 
-func ResizePVC(clientset *kubernetes.Clientset, pvcName, namespace string) error {
-	// Fetch the existing PVC
+const (
+	// GrowthPercentage adds GrowthPercent of the current request.
+	GrowthPercentage GrowthStrategy = "percentage"
+	// GrowthFixed adds a fixed Increment such as 10Gi.
+	GrowthFixed GrowthStrategy = "fixed"
+	// GrowthTargetUtilization grows the PVC so the current usage ends up at
+	// TargetUtilization percent of the new size.
+	GrowthTargetUtilization GrowthStrategy = "target-utilization"
+)
+
+// ParseGrowthStrategy validates a strategy name. An empty name selects
+// GrowthPercentage.
+func ParseGrowthStrategy(s string) (GrowthStrategy, error) {
+	switch GrowthStrategy(s) {
+	case "":
+		return GrowthPercentage, nil
+	case GrowthPercentage, GrowthFixed, GrowthTargetUtilization:
+		return GrowthStrategy(s), nil
+	}
+	return "", fmt.Errorf("unknown growth strategy %q, expected %s, %s or %s", s, GrowthPercentage, GrowthFixed, GrowthTargetUtilization)
+}
+
+// gi is the boundary sizes are rounded up to when RoundToGi is set.
+const gi = 1 << 30
+
+// ResizeOptions controls how much a PVC is grown.
+type ResizeOptions struct {
+	// Strategy selects the growth calculation. Empty means GrowthPercentage.
+	Strategy GrowthStrategy
+	// GrowthPercent is the percentage of the current request added by
+	// GrowthPercentage.
+	GrowthPercent int
+	// Increment is the amount added by GrowthFixed.
+	Increment resource.Quantity
+	// TargetUtilization is the usage percentage GrowthTargetUtilization
+	// aims for after the resize.
+	TargetUtilization int
+	// UsagePercent is the current disk usage, used by GrowthTargetUtilization.
+	UsagePercent float64
+	// MinStep is the smallest amount a PVC is grown by. Zero means no minimum.
+	MinStep resource.Quantity
+	// RoundToGi rounds the new size up to a whole number of GiB.
+	RoundToGi bool
+	// MaxSize caps the new size. Zero means unbounded.
+	MaxSize resource.Quantity
+	// Forecast, when set, grows the PVC at least enough to keep its
+	// projected usage at or below ForecastUtilization percent for
+	// CoverPeriod.
+	Forecast            *Forecast
+	CoverPeriod         time.Duration
+	ForecastUtilization int
+	// MinInterval is the minimum time between two resizes of a PVC and
+	// MaxResizesPerDay the most resizes within a day. Zero means no limit.
+	MinInterval      time.Duration
+	MaxResizesPerDay int
+	// Reason is recorded on the PVC with a resize.
+	Reason string
+}
+
+// DefaultResizeOptions grows PVCs by 50% without an upper bound.
+var DefaultResizeOptions = ResizeOptions{Strategy: GrowthPercentage, GrowthPercent: 50}
+
+// Status is the outcome of a resize.
+type Status string
+
+const (
+	// Resized means the PVC request was grown, or would be in a plan.
+	Resized Status = "Resized"
+	// Skipped means the PVC was left alone for the reason in Result.Reason.
+	Skipped Status = "Skipped"
+	// Failed means the resize was attempted or checked and hit an error.
+	Failed Status = "Failed"
+)
+
+// SkipReason explains why a PVC was not resized.
+type SkipReason string
+
+const (
+	SkipNoStorageClass       SkipReason = "NoStorageClass"
+	SkipExpansionNotAllowed  SkipReason = "ExpansionNotAllowed"
+	SkipNotBound             SkipReason = "NotBound"
+	SkipResizePending        SkipReason = "ResizePending"
+	SkipRequestAboveCapacity SkipReason = "RequestAboveCapacity"
+	SkipMaxSize              SkipReason = "MaxSizeReached"
+	SkipNoGrowth             SkipReason = "NoGrowth"
+	SkipMinInterval          SkipReason = "MinIntervalNotElapsed"
+	SkipDailyLimit           SkipReason = "DailyLimitReached"
+)
+
+// Result describes the outcome of PlanResize or ResizePVC.
+type Result struct {
+	Status Status
+	// Reason and Message are set when Status is Skipped.
+	Reason  SkipReason
+	Message string
+	// Current is the request before the resize and Size the request after it.
+	Current resource.Quantity
+	Size    resource.Quantity
+	// Capped is true when Size was limited by the maximum size.
+	Capped bool
+	// Err is set when Status is Failed.
+	Err error
+}
+
+func skipped(current resource.Quantity, reason SkipReason, format string, args ...interface{}) Result {
+	return Result{Status: Skipped, Reason: reason, Message: fmt.Sprintf(format, args...), Current: current, Size: current}
+}
+
+func failed(err error) Result {
+	return Result{Status: Failed, Err: err}
+}
+
+// growth returns the number of bytes the strategy adds to current.
+func growth(current int64, opts ResizeOptions) int64 {
+	switch opts.Strategy {
+	case GrowthFixed:
+		return opts.Increment.Value()
+	case GrowthTargetUtilization:
+		if opts.TargetUtilization <= 0 || opts.UsagePercent <= 0 {
+			return 0
+		}
+		used := float64(current) * opts.UsagePercent / 100
+		target := int64(math.Ceil(used * 100 / float64(opts.TargetUtilization)))
+		return target - current
+	default:
+		growthPercent := opts.GrowthPercent
+		if growthPercent <= 0 {
+			growthPercent = DefaultResizeOptions.GrowthPercent
+		}
+		return current * int64(growthPercent) / 100
+	}
+}
+
+// NewSize returns the size a PVC is grown to. The returned bool is true when
+// the new size was capped by MaxSize.
+func NewSize(pvc *v1.PersistentVolumeClaim, opts ResizeOptions) (current, proposed resource.Quantity, capped bool) {
+	current = pvc.Spec.Resources.Requests[v1.ResourceStorage]
+	currentSizeValue := current.Value()
+
+	step := growth(currentSizeValue, opts)
+	if step < opts.MinStep.Value() {
+		step = opts.MinStep.Value()
+	}
+	newSize := currentSizeValue
+	if step > 0 {
+		newSize += step
+	}
+	if opts.Forecast != nil {
+		if forecast := opts.Forecast.SizeFor(current, opts.CoverPeriod, opts.ForecastUtilization); newSize < forecast.Value() {
+			newSize = forecast.Value()
+		}
+	}
+	if opts.RoundToGi && newSize%gi != 0 {
+		newSize = (newSize/gi + 1) * gi
+	}
+
+	if !opts.MaxSize.IsZero() && newSize > opts.MaxSize.Value() {
+		newSize = opts.MaxSize.Value()
+		capped = true
+	}
+	if newSize < currentSizeValue {
+		newSize = currentSizeValue
+	}
+	return current, *resource.NewQuantity(newSize, resource.BinarySI), capped
+}
+
+// getPVC fetches a PVC and wraps lookup errors.
+func getPVC(clientset kubernetes.Interface, pvcName, namespace string) (*v1.PersistentVolumeClaim, error) {
 	pvc, err := clientset.CoreV1().PersistentVolumeClaims(namespace).Get(context.TODO(), pvcName, metaV1.GetOptions{})
 	if err != nil {
 		if errors.IsNotFound(err) {
-			return fmt.Errorf("PVC %s not found in namespace %s", pvcName, namespace)
+			return nil, fmt.Errorf("PVC %s not found in namespace %s", pvcName, namespace)
 		}
-		return fmt.Errorf("error getting PVC %s: %v", pvcName, err)
+		return nil, fmt.Errorf("error getting PVC %s: %v", pvcName, err)
 	}
+	return pvc, nil
+}
 
-	// Get current PVC size
-	currentSize := pvc.Spec.Resources.Requests[v1.ResourceStorage]
-	currentSizeValue := currentSize.Value()
+// preflight checks that the PVC can be expanded right now. It returns a
+// Skipped or Failed result when it cannot, and nil otherwise.
+func preflight(clientset kubernetes.Interface, pvc *v1.PersistentVolumeClaim) *Result {
+	current := pvc.Spec.Resources.Requests[v1.ResourceStorage]
 
-	// Calculate the new size (increase by 50%)
-	newSize := currentSizeValue + (currentSizeValue / 2)
+	if pvc.Spec.StorageClassName == nil || *pvc.Spec.StorageClassName == "" {
+		r := skipped(current, SkipNoStorageClass, "PVC %s has no StorageClass", pvc.Name)
+		return &r
+	}
+	className := *pvc.Spec.StorageClassName
+	class, err := clientset.StorageV1().StorageClasses().Get(context.TODO(), className, metaV1.GetOptions{})
+	if err != nil {
+		r := failed(fmt.Errorf("error getting StorageClass %s of PVC %s: %v", className, pvc.Name, err))
+		return &r
+	}
+	if class.AllowVolumeExpansion == nil || !*class.AllowVolumeExpansion {
+		r := skipped(current, SkipExpansionNotAllowed, "StorageClass %s of PVC %s does not allow volume expansion", className, pvc.Name)
+		return &r
+	}
 
-	// Update the PVC size
-	pvc.Spec.Resources.Requests[v1.ResourceStorage] = *resource.NewQuantity(newSize, resource.DecimalSI)
+	for _, condition := range pvc.Status.Conditions {
+		if condition.Status != v1.ConditionTrue {
+			continue
+		}
+		if condition.Type == v1.PersistentVolumeClaimResizing || condition.Type == v1.PersistentVolumeClaimFileSystemResizePending {
+			r := skipped(current, SkipResizePending, "PVC %s has a pending %s condition", pvc.Name, condition.Type)
+			return &r
+		}
+	}
+
+	if pvc.Spec.VolumeName == "" {
+		r := skipped(current, SkipNotBound, "PVC %s is not bound to a volume", pvc.Name)
+		return &r
+	}
+	pv, err := clientset.CoreV1().PersistentVolumes().Get(context.TODO(), pvc.Spec.VolumeName, metaV1.GetOptions{})
+	if err != nil {
+		r := failed(fmt.Errorf("error getting volume %s of PVC %s: %v", pvc.Spec.VolumeName, pvc.Name, err))
+		return &r
+	}
+	capacity := pv.Spec.Capacity[v1.ResourceStorage]
+	if current.Cmp(capacity) > 0 {
+		r := skipped(current, SkipRequestAboveCapacity, "PVC %s requests %s but its volume only has %s, a previous resize is still in progress", pvc.Name, current.String(), capacity.String())
+		return &r
+	}
+	return nil
+}
+
+// PlanResize returns the result ResizePVC would have, without updating the PVC.
+func PlanResize(clientset kubernetes.Interface, pvcName, namespace string, opts ResizeOptions) Result {
+	pvc, err := getPVC(clientset, pvcName, namespace)
+	if err != nil {
+		return failed(err)
+	}
+	if r := preflight(clientset, pvc); r != nil {
+		return *r
+	}
+	now := time.Now()
+	if r := checkState(pvc, opts, now); r != nil {
+		return *r
+	}
+
+	current, newSize, capped := NewSize(pvc, opts)
+	if newSize.Cmp(current) <= 0 {
+		if capped {
+			return skipped(current, SkipMaxSize, "PVC %s is already at its maximum size %s", pvcName, opts.MaxSize.String())
+		}
+		return skipped(current, SkipNoGrowth, "growth strategy %s does not grow PVC %s", opts.Strategy, pvcName)
+	}
+	return Result{Status: Resized, Current: current, Size: newSize, Capped: capped}
+}
+
+// ResizePVC grows the PVC storage request according to opts. PVCs whose
+// StorageClass does not allow expansion, that are still being resized, that
+// are at their maximum size or that were resized too recently or too often
+// are skipped. The resize is recorded in the PVC's annotations.
+func ResizePVC(clientset kubernetes.Interface, pvcName, namespace string, opts ResizeOptions) Result {
+	// Fetch the existing PVC
+	pvc, err := getPVC(clientset, pvcName, namespace)
+	if err != nil {
+		return failed(err)
+	}
+	if r := preflight(clientset, pvc); r != nil {
+		return *r
+	}
+	now := time.Now()
+	if r := checkState(pvc, opts, now); r != nil {
+		return *r
+	}
+
+	current, newSize, capped := NewSize(pvc, opts)
+	if newSize.Cmp(current) <= 0 {
+		if capped {
+			return skipped(current, SkipMaxSize, "PVC %s is already at its maximum size %s", pvcName, opts.MaxSize.String())
+		}
+		return skipped(current, SkipNoGrowth, "growth strategy %s does not grow PVC %s", opts.Strategy, pvcName)
+	}
+
+	// Update the PVC size, recording the resize in the same update
+	pvc.Spec.Resources.Requests[v1.ResourceStorage] = newSize
+	ReadState(pvc, now).record(now, current.String(), opts.Reason).write(pvc)
 
 	// Attempt to update the PVC
 	_, err = clientset.CoreV1().PersistentVolumeClaims(namespace).Update(context.TODO(), pvc, metaV1.UpdateOptions{})
 	if err != nil {
-		return fmt.Errorf("error updating PVC %s: %v", pvcName, err)
+		return failed(fmt.Errorf("error updating PVC %s: %v", pvcName, err))
 	}
 
-	return nil
+	return Result{Status: Resized, Current: current, Size: newSize, Capped: capped}
 }
@@ -0,0 +1,190 @@
+package pvc
+
+import (
+	"context"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// claimOf returns a PVC requesting size.
+func claimOf(size string) *v1.PersistentVolumeClaim {
+	return &v1.PersistentVolumeClaim{
+		ObjectMeta: metaV1.ObjectMeta{Namespace: "shop", Name: "data"},
+		Spec: v1.PersistentVolumeClaimSpec{
+			Resources: v1.VolumeResourceRequirements{
+				Requests: v1.ResourceList{v1.ResourceStorage: resource.MustParse(size)},
+			},
+		},
+	}
+}
+
+func TestNewSize(t *testing.T) {
+	tests := []struct {
+		name       string
+		current    string
+		opts       ResizeOptions
+		want       string
+		wantCapped bool
+	}{
+		{name: "percentage", current: "10Gi", opts: ResizeOptions{Strategy: GrowthPercentage, GrowthPercent: 20}, want: "12Gi"},
+		{name: "percentage default", current: "10Gi", opts: ResizeOptions{Strategy: GrowthPercentage}, want: "15Gi"},
+		{name: "empty strategy is percentage", current: "10Gi", opts: ResizeOptions{GrowthPercent: 10}, want: "11Gi"},
+		{name: "fixed", current: "10Gi", opts: ResizeOptions{Strategy: GrowthFixed, Increment: resource.MustParse("5Gi")}, want: "15Gi"},
+		{name: "fixed without increment", current: "10Gi", opts: ResizeOptions{Strategy: GrowthFixed}, want: "10Gi"},
+		{name: "target utilization", current: "10Gi", opts: ResizeOptions{Strategy: GrowthTargetUtilization, TargetUtilization: 60, UsagePercent: 90}, want: "15Gi"},
+		{name: "target utilization below usage", current: "10Gi", opts: ResizeOptions{Strategy: GrowthTargetUtilization, TargetUtilization: 80, UsagePercent: 40}, want: "10Gi"},
+		{name: "target utilization without usage", current: "10Gi", opts: ResizeOptions{Strategy: GrowthTargetUtilization, TargetUtilization: 60}, want: "10Gi"},
+		{name: "min step", current: "10Gi", opts: ResizeOptions{Strategy: GrowthPercentage, GrowthPercent: 10, MinStep: resource.MustParse("5Gi")}, want: "15Gi"},
+		{name: "min step below growth", current: "10Gi", opts: ResizeOptions{Strategy: GrowthPercentage, GrowthPercent: 50, MinStep: resource.MustParse("1Gi")}, want: "15Gi"},
+		{name: "round to Gi", current: "10Gi", opts: ResizeOptions{Strategy: GrowthPercentage, GrowthPercent: 15, RoundToGi: true}, want: "12Gi"},
+		{name: "round to Gi on a boundary", current: "10Gi", opts: ResizeOptions{Strategy: GrowthPercentage, GrowthPercent: 20, RoundToGi: true}, want: "12Gi"},
+		{name: "no rounding", current: "10Gi", opts: ResizeOptions{Strategy: GrowthPercentage, GrowthPercent: 15}, want: "11776Mi"},
+		{name: "max size caps", current: "10Gi", opts: ResizeOptions{Strategy: GrowthPercentage, GrowthPercent: 50, MaxSize: resource.MustParse("12Gi")}, want: "12Gi", wantCapped: true},
+		{name: "max size caps rounding", current: "10Gi", opts: ResizeOptions{Strategy: GrowthPercentage, GrowthPercent: 15, RoundToGi: true, MaxSize: resource.MustParse("11.5Gi")}, want: "11.5Gi", wantCapped: true},
+		{name: "max size above growth", current: "10Gi", opts: ResizeOptions{Strategy: GrowthPercentage, GrowthPercent: 50, MaxSize: resource.MustParse("20Gi")}, want: "15Gi"},
+		{name: "at max size", current: "20Gi", opts: ResizeOptions{Strategy: GrowthPercentage, GrowthPercent: 50, MaxSize: resource.MustParse("20Gi")}, want: "20Gi", wantCapped: true},
+		{name: "above max size never shrinks", current: "30Gi", opts: ResizeOptions{Strategy: GrowthPercentage, GrowthPercent: 50, MaxSize: resource.MustParse("20Gi")}, want: "30Gi", wantCapped: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			current, proposed, capped := NewSize(claimOf(tt.current), tt.opts)
+			if current.Cmp(resource.MustParse(tt.current)) != 0 {
+				t.Errorf("NewSize() current = %s, want %s", current.String(), tt.current)
+			}
+			if proposed.Cmp(resource.MustParse(tt.want)) != 0 {
+				t.Errorf("NewSize() proposed = %s, want %s", proposed.String(), tt.want)
+			}
+			if capped != tt.wantCapped {
+				t.Errorf("NewSize() capped = %v, want %v", capped, tt.wantCapped)
+			}
+		})
+	}
+}
+
+func TestParseGrowthStrategy(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    GrowthStrategy
+		wantErr bool
+	}{
+		{value: "", want: GrowthPercentage},
+		{value: "percentage", want: GrowthPercentage},
+		{value: "fixed", want: GrowthFixed},
+		{value: "target-utilization", want: GrowthTargetUtilization},
+		{value: "linear", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseGrowthStrategy(tt.value)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseGrowthStrategy(%q) = %q, %v, want %q, error %v", tt.value, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+// volume is a PVC bound to a volume of a StorageClass, as seen by the
+// preflight checks.
+type volume struct {
+	claim *v1.PersistentVolumeClaim
+	pv    *v1.PersistentVolume
+	class *storagev1.StorageClass
+}
+
+// boundVolume returns a 10Gi PVC bound to a 10Gi volume of a StorageClass
+// that allows expansion.
+func boundVolume() volume {
+	className := "standard"
+	allow := true
+	claim := claimOf("10Gi")
+	claim.Spec.StorageClassName = &className
+	claim.Spec.VolumeName = "pv-data"
+	claim.Status.Capacity = v1.ResourceList{v1.ResourceStorage: resource.MustParse("10Gi")}
+	return volume{
+		claim: claim,
+		pv: &v1.PersistentVolume{
+			ObjectMeta: metaV1.ObjectMeta{Name: "pv-data"},
+			Spec:       v1.PersistentVolumeSpec{Capacity: v1.ResourceList{v1.ResourceStorage: resource.MustParse("10Gi")}},
+		},
+		class: &storagev1.StorageClass{ObjectMeta: metaV1.ObjectMeta{Name: className}, AllowVolumeExpansion: &allow},
+	}
+}
+
+// clientset returns a fake clientset holding the objects of the volume that
+// are set.
+func (v volume) clientset() *fake.Clientset {
+	var objects []runtime.Object
+	if v.claim != nil {
+		objects = append(objects, v.claim)
+	}
+	if v.pv != nil {
+		objects = append(objects, v.pv)
+	}
+	if v.class != nil {
+		objects = append(objects, v.class)
+	}
+	return fake.NewSimpleClientset(objects...)
+}
+
+func TestPreflight(t *testing.T) {
+	tests := []struct {
+		name       string
+		modify     func(v *volume)
+		wantStatus Status
+		wantReason SkipReason
+	}{
+		{name: "expandable", modify: func(v *volume) {}, wantStatus: Resized},
+		{name: "no StorageClass", modify: func(v *volume) { v.claim.Spec.StorageClassName = nil }, wantStatus: Skipped, wantReason: SkipNoStorageClass},
+		{name: "expansion not allowed", modify: func(v *volume) {
+			allow := false
+			v.class.AllowVolumeExpansion = &allow
+		}, wantStatus: Skipped, wantReason: SkipExpansionNotAllowed},
+		{name: "expansion unset", modify: func(v *volume) { v.class.AllowVolumeExpansion = nil }, wantStatus: Skipped, wantReason: SkipExpansionNotAllowed},
+		{name: "Resizing condition", modify: func(v *volume) {
+			v.claim.Status.Conditions = []v1.PersistentVolumeClaimCondition{{Type: v1.PersistentVolumeClaimResizing, Status: v1.ConditionTrue}}
+		}, wantStatus: Skipped, wantReason: SkipResizePending},
+		{name: "FileSystemResizePending condition", modify: func(v *volume) {
+			v.claim.Status.Conditions = []v1.PersistentVolumeClaimCondition{{Type: v1.PersistentVolumeClaimFileSystemResizePending, Status: v1.ConditionTrue}}
+		}, wantStatus: Skipped, wantReason: SkipResizePending},
+		{name: "false Resizing condition", modify: func(v *volume) {
+			v.claim.Status.Conditions = []v1.PersistentVolumeClaimCondition{{Type: v1.PersistentVolumeClaimResizing, Status: v1.ConditionFalse}}
+		}, wantStatus: Resized},
+		{name: "not bound", modify: func(v *volume) { v.claim.Spec.VolumeName = "" }, wantStatus: Skipped, wantReason: SkipNotBound},
+		{name: "request above capacity", modify: func(v *volume) {
+			v.claim.Spec.Resources.Requests[v1.ResourceStorage] = resource.MustParse("15Gi")
+		}, wantStatus: Skipped, wantReason: SkipRequestAboveCapacity},
+		{name: "missing StorageClass", modify: func(v *volume) { v.class = nil }, wantStatus: Failed},
+		{name: "missing volume", modify: func(v *volume) { v.pv = nil }, wantStatus: Failed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := boundVolume()
+			tt.modify(&v)
+			clientset := v.clientset()
+
+			r := ResizePVC(clientset, "data", "shop", DefaultResizeOptions)
+			if r.Status != tt.wantStatus || r.Reason != tt.wantReason {
+				t.Fatalf("ResizePVC() = %s (%s), want %s (%s): %s %v", r.Status, r.Reason, tt.wantStatus, tt.wantReason, r.Message, r.Err)
+			}
+			if r.Status == Failed && r.Err == nil {
+				t.Errorf("ResizePVC() failed without an error")
+			}
+
+			claim, err := clientset.CoreV1().PersistentVolumeClaims("shop").Get(context.Background(), "data", metaV1.GetOptions{})
+			if err != nil {
+				t.Fatalf("error getting the PVC: %v", err)
+			}
+			want := v.claim.Spec.Resources.Requests[v1.ResourceStorage]
+			if tt.wantStatus == Resized {
+				want = resource.MustParse("15Gi")
+			}
+			if got := claim.Spec.Resources.Requests[v1.ResourceStorage]; got.Cmp(want) != 0 {
+				t.Errorf("PVC request = %s, want %s", got.String(), want.String())
+			}
+		})
+	}
+}
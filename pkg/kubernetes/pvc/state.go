@@ -0,0 +1,107 @@
+package pvc
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// Annotations recording the resize history on the PVC itself, so it
+// survives restarts of the autoscaler.
+const (
+	LastResizeTimeAnnotation   = "autoscaler/last-resize-time"
+	PreviousSizeAnnotation     = "autoscaler/previous-size"
+	LastResizeReasonAnnotation = "autoscaler/last-resize-reason"
+	// RecentResizesAnnotation lists the times of the resizes within the
+	// last day, comma separated.
+	RecentResizesAnnotation = "autoscaler/recent-resizes"
+)
+
+// day is the period MaxResizesPerDay applies to.
+const day = 24 * time.Hour
+
+// State is the resize history recorded on a PVC.
+type State struct {
+	LastResize   time.Time
+	PreviousSize string
+	Reason       string
+	// Resizes are the times of the resizes within the last day.
+	Resizes []time.Time
+}
+
+// ReadState reads the resize history from the PVC's annotations. Malformed
+// values are ignored.
+func ReadState(pvc *v1.PersistentVolumeClaim, now time.Time) State {
+	annotations := pvc.Annotations
+	state := State{
+		PreviousSize: annotations[PreviousSizeAnnotation],
+		Reason:       annotations[LastResizeReasonAnnotation],
+	}
+	if t, err := time.Parse(time.RFC3339, annotations[LastResizeTimeAnnotation]); err == nil {
+		state.LastResize = t
+	}
+	for _, s := range strings.Split(annotations[RecentResizesAnnotation], ",") {
+		t, err := time.Parse(time.RFC3339, strings.TrimSpace(s))
+		if err == nil && now.Sub(t) < day {
+			state.Resizes = append(state.Resizes, t)
+		}
+	}
+	sort.Slice(state.Resizes, func(i, j int) bool { return state.Resizes[i].Before(state.Resizes[j]) })
+	return state
+}
+
+// record adds a resize from previous at now to the state.
+func (s State) record(now time.Time, previous, reason string) State {
+	resizes := []time.Time{}
+	for _, t := range s.Resizes {
+		if now.Sub(t) < day {
+			resizes = append(resizes, t)
+		}
+	}
+	return State{
+		LastResize:   now,
+		PreviousSize: previous,
+		Reason:       reason,
+		Resizes:      append(resizes, now),
+	}
+}
+
+// write stores the state in the PVC's annotations.
+func (s State) write(pvc *v1.PersistentVolumeClaim) {
+	if pvc.Annotations == nil {
+		pvc.Annotations = map[string]string{}
+	}
+	times := make([]string, 0, len(s.Resizes))
+	for _, t := range s.Resizes {
+		times = append(times, t.UTC().Format(time.RFC3339))
+	}
+	pvc.Annotations[LastResizeTimeAnnotation] = s.LastResize.UTC().Format(time.RFC3339)
+	pvc.Annotations[PreviousSizeAnnotation] = s.PreviousSize
+	pvc.Annotations[LastResizeReasonAnnotation] = s.Reason
+	pvc.Annotations[RecentResizesAnnotation] = strings.Join(times, ",")
+}
+
+// checkState returns a Skipped result when the PVC was resized less than
+// MinInterval ago or already MaxResizesPerDay times within the last day,
+// and nil otherwise.
+func checkState(pvc *v1.PersistentVolumeClaim, opts ResizeOptions, now time.Time) *Result {
+	current := pvc.Spec.Resources.Requests[v1.ResourceStorage]
+	state := ReadState(pvc, now)
+
+	if opts.MinInterval > 0 && !state.LastResize.IsZero() {
+		if since := now.Sub(state.LastResize); since < opts.MinInterval {
+			r := skipped(current, SkipMinInterval, "PVC %s was resized %s ago from %s (%s), less than the minimum interval %s",
+				pvc.Name, since.Round(time.Second), state.PreviousSize, state.Reason, opts.MinInterval)
+			return &r
+		}
+	}
+	if opts.MaxResizesPerDay > 0 && len(state.Resizes) >= opts.MaxResizesPerDay {
+		next := state.Resizes[len(state.Resizes)-opts.MaxResizesPerDay].Add(day)
+		r := skipped(current, SkipDailyLimit, "PVC %s was already resized %d times within the last day, the limit is %d until %s",
+			pvc.Name, len(state.Resizes), opts.MaxResizesPerDay, next.UTC().Format(time.RFC3339))
+		return &r
+	}
+	return nil
+}
@@ -0,0 +1,199 @@
+package pvc
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+var stateNow = time.Date(2024, 1, 2, 12, 0, 0, 0, time.UTC)
+
+func TestReadState(t *testing.T) {
+	claim := claimOf("15Gi")
+	claim.Annotations = map[string]string{
+		LastResizeTimeAnnotation:   "2024-01-02T11:00:00Z",
+		PreviousSizeAnnotation:     "10Gi",
+		LastResizeReasonAnnotation: "disk usage 90.00% > 80%",
+		// Unordered, with one resize older than a day and one malformed
+		RecentResizesAnnotation: "2024-01-02T11:00:00Z,2024-01-01T10:00:00Z, 2024-01-02T06:00:00Z,yesterday",
+	}
+
+	state := ReadState(claim, stateNow)
+	if want := time.Date(2024, 1, 2, 11, 0, 0, 0, time.UTC); !state.LastResize.Equal(want) {
+		t.Errorf("LastResize = %s, want %s", state.LastResize, want)
+	}
+	if state.PreviousSize != "10Gi" || state.Reason != "disk usage 90.00% > 80%" {
+		t.Errorf("PreviousSize, Reason = %q, %q, want 10Gi and the usage reason", state.PreviousSize, state.Reason)
+	}
+	want := []time.Time{
+		time.Date(2024, 1, 2, 6, 0, 0, 0, time.UTC),
+		time.Date(2024, 1, 2, 11, 0, 0, 0, time.UTC),
+	}
+	if len(state.Resizes) != len(want) || !state.Resizes[0].Equal(want[0]) || !state.Resizes[1].Equal(want[1]) {
+		t.Errorf("Resizes = %v, want %v", state.Resizes, want)
+	}
+
+	if state := ReadState(claimOf("10Gi"), stateNow); !state.LastResize.IsZero() || len(state.Resizes) != 0 {
+		t.Errorf("ReadState() of a PVC without annotations = %+v, want an empty state", state)
+	}
+}
+
+func TestStateRecordRoundTrip(t *testing.T) {
+	claim := claimOf("15Gi")
+	old := stateNow.Add(-25 * time.Hour)
+	earlier := stateNow.Add(-2 * time.Hour)
+	State{LastResize: earlier, Resizes: []time.Time{old, earlier}}.record(stateNow, "10Gi", "forecast").write(claim)
+
+	state := ReadState(claim, stateNow)
+	if !state.LastResize.Equal(stateNow) || state.PreviousSize != "10Gi" || state.Reason != "forecast" {
+		t.Errorf("state = %+v, want the resize at %s from 10Gi for forecast", state, stateNow)
+	}
+	if len(state.Resizes) != 2 || !state.Resizes[0].Equal(earlier) || !state.Resizes[1].Equal(stateNow) {
+		t.Errorf("Resizes = %v, want the resizes within the last day", state.Resizes)
+	}
+	if got := claim.Annotations[RecentResizesAnnotation]; strings.Contains(got, old.Format(time.RFC3339)) {
+		t.Errorf("%s = %q, want resizes older than a day dropped", RecentResizesAnnotation, got)
+	}
+}
+
+func TestCheckState(t *testing.T) {
+	resizedAt := func(times ...time.Time) *v1.PersistentVolumeClaim {
+		claim := claimOf("15Gi")
+		if len(times) > 0 {
+			State{LastResize: times[len(times)-1], PreviousSize: "10Gi", Reason: "disk usage", Resizes: times}.write(claim)
+		}
+		return claim
+	}
+
+	tests := []struct {
+		name       string
+		claim      *v1.PersistentVolumeClaim
+		opts       ResizeOptions
+		wantReason SkipReason
+	}{
+		{name: "never resized", claim: resizedAt(), opts: ResizeOptions{MinInterval: time.Hour, MaxResizesPerDay: 1}},
+		{name: "within min interval", claim: resizedAt(stateNow.Add(-30 * time.Minute)), opts: ResizeOptions{MinInterval: time.Hour}, wantReason: SkipMinInterval},
+		{name: "after min interval", claim: resizedAt(stateNow.Add(-2 * time.Hour)), opts: ResizeOptions{MinInterval: time.Hour}},
+		{name: "no min interval", claim: resizedAt(stateNow.Add(-time.Minute)), opts: ResizeOptions{}},
+		{name: "daily limit reached", claim: resizedAt(stateNow.Add(-3*time.Hour), stateNow.Add(-2*time.Hour)), opts: ResizeOptions{MaxResizesPerDay: 2}, wantReason: SkipDailyLimit},
+		{name: "below daily limit", claim: resizedAt(stateNow.Add(-2 * time.Hour)), opts: ResizeOptions{MaxResizesPerDay: 2}},
+		{name: "daily limit of older resizes", claim: resizedAt(stateNow.Add(-30*time.Hour), stateNow.Add(-2*time.Hour)), opts: ResizeOptions{MaxResizesPerDay: 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := checkState(tt.claim, tt.opts, stateNow)
+			if tt.wantReason == "" {
+				if r != nil {
+					t.Errorf("checkState() = %s (%s): %s, want no skip", r.Status, r.Reason, r.Message)
+				}
+				return
+			}
+			if r == nil || r.Status != Skipped || r.Reason != tt.wantReason {
+				t.Fatalf("checkState() = %+v, want Skipped (%s)", r, tt.wantReason)
+			}
+			if tt.wantReason == SkipMinInterval && !strings.Contains(r.Message, "10Gi") {
+				t.Errorf("message %q does not name the previous size", r.Message)
+			}
+		})
+	}
+}
+
+// expand sets the capacity of the PVC and its volume to its request, as
+// the driver does when the resize finishes.
+func expand(t *testing.T, clientset *fake.Clientset) {
+	t.Helper()
+	ctx := context.Background()
+	claims := clientset.CoreV1().PersistentVolumeClaims("shop")
+	claim, err := claims.Get(ctx, "data", metaV1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	size := claim.Spec.Resources.Requests[v1.ResourceStorage]
+	claim.Status.Capacity = v1.ResourceList{v1.ResourceStorage: size}
+	if _, err := claims.Update(ctx, claim, metaV1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	pv, err := clientset.CoreV1().PersistentVolumes().Get(ctx, claim.Spec.VolumeName, metaV1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pv.Spec.Capacity = v1.ResourceList{v1.ResourceStorage: size}
+	if _, err := clientset.CoreV1().PersistentVolumes().Update(ctx, pv, metaV1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestResizeWithinMinInterval resizes a PVC, lets the driver expand it and
+// asks for a second resize right away. The history written with the first
+// resize must hold off the second.
+func TestResizeWithinMinInterval(t *testing.T) {
+	clientset := boundVolume().clientset()
+	opts := DefaultResizeOptions
+	opts.MinInterval = time.Hour
+	opts.Reason = "disk usage 90.00% > 80%"
+
+	if r := ResizePVC(clientset, "data", "shop", opts); r.Status != Resized {
+		t.Fatalf("first ResizePVC() = %s (%s): %s %v, want Resized", r.Status, r.Reason, r.Message, r.Err)
+	}
+	claim, err := clientset.CoreV1().PersistentVolumeClaims("shop").Get(context.Background(), "data", metaV1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	state := ReadState(claim, time.Now())
+	if state.PreviousSize != "10Gi" || state.Reason != opts.Reason || len(state.Resizes) != 1 || time.Since(state.LastResize) > time.Minute {
+		t.Errorf("state after the resize = %+v, want a resize from 10Gi just now", state)
+	}
+
+	expand(t, clientset)
+	r := ResizePVC(clientset, "data", "shop", opts)
+	if r.Status != Skipped || r.Reason != SkipMinInterval {
+		t.Errorf("second ResizePVC() = %s (%s), want Skipped (%s)", r.Status, r.Reason, SkipMinInterval)
+	}
+}
+
+// TestResizeAfterRestartMidResize starts from a PVC an earlier process
+// resized before it was restarted: the history is on the PVC but the volume
+// has not been expanded yet. The resize in progress must be detected from
+// the PVC alone and reported before the minimum interval.
+func TestResizeAfterRestartMidResize(t *testing.T) {
+	tests := []struct {
+		name       string
+		condition  v1.PersistentVolumeClaimConditionType
+		wantReason SkipReason
+	}{
+		{name: "request above capacity", wantReason: SkipRequestAboveCapacity},
+		{name: "resizing condition", condition: v1.PersistentVolumeClaimResizing, wantReason: SkipResizePending},
+		{name: "file system resize pending", condition: v1.PersistentVolumeClaimFileSystemResizePending, wantReason: SkipResizePending},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := boundVolume()
+			v.claim.Spec.Resources.Requests[v1.ResourceStorage] = resource.MustParse("15Gi")
+			State{}.record(time.Now().Add(-10*time.Minute), "10Gi", "disk usage").write(v.claim)
+			if tt.condition != "" {
+				v.claim.Status.Conditions = []v1.PersistentVolumeClaimCondition{{Type: tt.condition, Status: v1.ConditionTrue}}
+			}
+			clientset := v.clientset()
+
+			opts := DefaultResizeOptions
+			opts.MinInterval = time.Hour
+			r := ResizePVC(clientset, "data", "shop", opts)
+			if r.Status != Skipped || r.Reason != tt.wantReason {
+				t.Fatalf("ResizePVC() = %s (%s): %s %v, want Skipped (%s)", r.Status, r.Reason, r.Message, r.Err, tt.wantReason)
+			}
+			claim, err := clientset.CoreV1().PersistentVolumeClaims("shop").Get(context.Background(), "data", metaV1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := claim.Spec.Resources.Requests[v1.ResourceStorage]; got.Cmp(resource.MustParse("15Gi")) != 0 {
+				t.Errorf("PVC request = %s, want it unchanged at 15Gi", got.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package pvc
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+)
+
+// DefaultResizeTimeout is how long a resize is tracked when no timeout is
+// given.
+const DefaultResizeTimeout = 2 * time.Minute
+
+// resizePollInterval is how often WaitForResize reads the PVC.
+var resizePollInterval = 2 * time.Second
+
+// FileSystemResizePending reports whether the PVC has a true
+// FileSystemResizePending condition.
+func FileSystemResizePending(pvc *v1.PersistentVolumeClaim) bool {
+	for _, condition := range pvc.Status.Conditions {
+		if condition.Type == v1.PersistentVolumeClaimFileSystemResizePending && condition.Status == v1.ConditionTrue {
+			return true
+		}
+	}
+	return false
+}
+
+// ResizeDone reports whether the capacity of the PVC reached size and its
+// filesystem has been expanded. When the volume was expanded but the
+// filesystem resize stays pending, the driver only supports offline
+// expansion and the pod using the PVC must be restarted to finish it.
+func ResizeDone(pvc *v1.PersistentVolumeClaim, size resource.Quantity) bool {
+	capacity := pvc.Status.Capacity[v1.ResourceStorage]
+	return capacity.Cmp(size) >= 0 && !FileSystemResizePending(pvc)
+}
+
+// WaitForResize waits until the PVC reached size and its filesystem has been
+// expanded, for at most timeout (DefaultResizeTimeout when not positive).
+// When the volume was expanded but the filesystem resize is still pending
+// once the timeout expires, it returns restartNeeded: the driver only
+// expands offline and the pod using the PVC has to be restarted. Any other
+// timeout, an error reading the PVC or the end of ctx is returned as err.
+func WaitForResize(ctx context.Context, clientset kubernetes.Interface, namespace, pvcName string, size resource.Quantity, timeout time.Duration) (restartNeeded bool, err error) {
+	if timeout <= 0 {
+		timeout = DefaultResizeTimeout
+	}
+	var claim *v1.PersistentVolumeClaim
+	err = wait.PollUntilContextTimeout(ctx, resizePollInterval, timeout, true, func(ctx context.Context) (bool, error) {
+		c, err := clientset.CoreV1().PersistentVolumeClaims(namespace).Get(ctx, pvcName, metaV1.GetOptions{})
+		if err != nil {
+			return false, fmt.Errorf("error getting PVC %s in namespace %s: %v", pvcName, namespace, err)
+		}
+		claim = c
+		return ResizeDone(c, size), nil
+	})
+	switch {
+	case err == nil:
+		return false, nil
+	case ctx.Err() != nil:
+		return false, ctx.Err()
+	case !wait.Interrupted(err) || claim == nil:
+		return false, err
+	case FileSystemResizePending(claim):
+		return true, nil
+	}
+	capacity := claim.Status.Capacity[v1.ResourceStorage]
+	return false, fmt.Errorf("timed out waiting for PVC %s in namespace %s to grow from %s to %s", pvcName, namespace, capacity.String(), size.String())
+}
@@ -0,0 +1,94 @@
+package pvc
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// resizingClaim returns a PVC requesting 15Gi with the given capacity and
+// conditions.
+func resizingClaim(capacity string, conditions ...v1.PersistentVolumeClaimConditionType) *v1.PersistentVolumeClaim {
+	claim := claimOf("15Gi")
+	claim.Status.Phase = v1.ClaimBound
+	claim.Status.Capacity = v1.ResourceList{v1.ResourceStorage: resource.MustParse(capacity)}
+	for _, condition := range conditions {
+		claim.Status.Conditions = append(claim.Status.Conditions, v1.PersistentVolumeClaimCondition{Type: condition, Status: v1.ConditionTrue})
+	}
+	return claim
+}
+
+func TestWaitForResize(t *testing.T) {
+	defer func(interval time.Duration) { resizePollInterval = interval }(resizePollInterval)
+	resizePollInterval = 10 * time.Millisecond
+
+	tests := []struct {
+		name        string
+		claim       *v1.PersistentVolumeClaim
+		wantRestart bool
+		wantErr     bool
+	}{
+		{name: "expanded", claim: resizingClaim("15Gi")},
+		{name: "capacity above the size", claim: resizingClaim("16Gi")},
+		// A Bound PVC is not done while its capacity is below the request
+		{name: "volume not expanded", claim: resizingClaim("10Gi", v1.PersistentVolumeClaimResizing), wantErr: true},
+		{name: "offline filesystem resize", claim: resizingClaim("15Gi", v1.PersistentVolumeClaimFileSystemResizePending), wantRestart: true},
+		{name: "missing PVC", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var objects []runtime.Object
+			if tt.claim != nil {
+				objects = append(objects, tt.claim)
+			}
+			clientset := fake.NewSimpleClientset(objects...)
+
+			restart, err := WaitForResize(context.Background(), clientset, "shop", "data", resource.MustParse("15Gi"), 50*time.Millisecond)
+			if restart != tt.wantRestart || (err != nil) != tt.wantErr {
+				t.Errorf("WaitForResize() = %v, %v, want restart needed %v and error %v", restart, err, tt.wantRestart, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestWaitForResizeUntilExpanded checks that the wait returns once the
+// driver expands the volume and the filesystem.
+func TestWaitForResizeUntilExpanded(t *testing.T) {
+	defer func(interval time.Duration) { resizePollInterval = interval }(resizePollInterval)
+	resizePollInterval = 10 * time.Millisecond
+
+	clientset := fake.NewSimpleClientset(resizingClaim("10Gi", v1.PersistentVolumeClaimResizing))
+	gets := 0
+	clientset.PrependReactor("get", "persistentvolumeclaims", func(k8stesting.Action) (bool, runtime.Object, error) {
+		gets++
+		if gets < 3 {
+			return false, nil, nil
+		}
+		return true, resizingClaim("15Gi"), nil
+	})
+
+	restart, err := WaitForResize(context.Background(), clientset, "shop", "data", resource.MustParse("15Gi"), time.Minute)
+	if restart || err != nil {
+		t.Fatalf("WaitForResize() = %v, %v, want the resize done", restart, err)
+	}
+	if gets != 3 {
+		t.Errorf("read the PVC %d times, want 3", gets)
+	}
+}
+
+func TestWaitForResizeCancelled(t *testing.T) {
+	clientset := fake.NewSimpleClientset(resizingClaim("10Gi", v1.PersistentVolumeClaimResizing))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	restart, err := WaitForResize(ctx, clientset, "shop", "data", resource.MustParse("15Gi"), time.Minute)
+	if restart || err != context.Canceled {
+		t.Errorf("WaitForResize() = %v, %v, want %v", restart, err, context.Canceled)
+	}
+}
@@ -0,0 +1,27 @@
+package statefulset
+
+import (
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// TemplateDrift compares the storage request of a volumeClaimTemplate with
+// size, the size a PVC created from it was grown to. It returns the request
+// of the template and whether it is below size, so replicas created later
+// would start smaller than the existing ones.
+//
+// volumeClaimTemplates are immutable, so the drift can only be reported; the
+// StatefulSet is never recreated to change it.
+func TemplateDrift(sts *appsv1.StatefulSet, template string, size resource.Quantity) (resource.Quantity, bool, error) {
+	for _, t := range sts.Spec.VolumeClaimTemplates {
+		if t.Name != template {
+			continue
+		}
+		current := t.Spec.Resources.Requests[v1.ResourceStorage]
+		return current, current.Cmp(size) < 0, nil
+	}
+	return resource.Quantity{}, false, fmt.Errorf("statefulset %s has no volumeClaimTemplate %s", sts.Name, template)
+}
@@ -0,0 +1,54 @@
+package statefulset
+
+import (
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestTemplateDrift(t *testing.T) {
+	sts := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "db"},
+		Spec: appsv1.StatefulSetSpec{VolumeClaimTemplates: []v1.PersistentVolumeClaim{
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: "data"},
+				Spec: v1.PersistentVolumeClaimSpec{Resources: v1.VolumeResourceRequirements{
+					Requests: v1.ResourceList{v1.ResourceStorage: resource.MustParse("10Gi")},
+				}},
+			},
+			{ObjectMeta: metav1.ObjectMeta{Name: "scratch"}},
+		}},
+	}
+
+	tests := []struct {
+		name        string
+		template    string
+		size        string
+		wantCurrent string
+		wantDrift   bool
+		wantErr     bool
+	}{
+		{name: "grown beyond the template", template: "data", size: "15Gi", wantCurrent: "10Gi", wantDrift: true},
+		{name: "template large enough", template: "data", size: "10Gi", wantCurrent: "10Gi"},
+		{name: "template larger", template: "data", size: "8Gi", wantCurrent: "10Gi"},
+		{name: "template without a request", template: "scratch", size: "1Gi", wantCurrent: "0", wantDrift: true},
+		{name: "missing template", template: "logs", size: "15Gi", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			current, drift, err := TemplateDrift(sts, tt.template, resource.MustParse(tt.size))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("TemplateDrift() error = %v, want error %t", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if current.Cmp(resource.MustParse(tt.wantCurrent)) != 0 || drift != tt.wantDrift {
+				t.Errorf("TemplateDrift() = %s, %t, want %s, %t", current.String(), drift, tt.wantCurrent, tt.wantDrift)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package log
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Level is the severity of a log entry.
+type Level int32
+
+// Levels in increasing order of severity.
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarning
+	LevelError
+	LevelFatal
+)
+
+var levelNames = map[Level]string{
+	LevelDebug:   "debug",
+	LevelInfo:    "info",
+	LevelWarning: "warning",
+	LevelError:   "error",
+	LevelFatal:   "fatal",
+}
+
+func (l Level) String() string {
+	if name, ok := levelNames[l]; ok {
+		return name
+	}
+	return fmt.Sprintf("level(%d)", int32(l))
+}
+
+// ParseLevel parses a level name such as "info" or "warning".
+func ParseLevel(name string) (Level, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "warn" {
+		return LevelWarning, nil
+	}
+	for l, n := range levelNames {
+		if n == name {
+			return l, nil
+		}
+	}
+	return LevelInfo, fmt.Errorf("unknown log level %q, expected debug, info, warning, error or fatal", name)
+}
+
+// color returns the ANSI color of the level on a terminal.
+func (l Level) color() string {
+	switch l {
+	case LevelDebug:
+		return BrightBlue
+	case LevelInfo:
+		return BrightGreen
+	case LevelWarning:
+		return BrightYellow
+	}
+	return BrightRed
+}
+
+// emoji returns the marker appended to entries of the level on a terminal.
+func (l Level) emoji() string {
+	switch l {
+	case LevelDebug:
+		return "🔍"
+	case LevelInfo:
+		return "😊"
+	case LevelWarning:
+		return "⚠️"
+	case LevelError:
+		return "❌"
+	}
+	return "💀"
+}
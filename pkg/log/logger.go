@@ -1,17 +1,18 @@
 package log
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
-	"log"
+	"io"
 	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
-var (
-	FileLogger    *log.Logger
-	ConsoleLogger *log.Logger
-)
-
 const (
 	Reset        = "\033[0m"
 	BrightRed    = "\033[1;31m" // Bright Red
@@ -20,56 +21,280 @@ const (
 	BrightBlue   = "\033[1;34m" // Bright Blue
 )
 
-// Init initializes the loggers for file and console
-func Init() {
-	// Attempt to remove the old log file if it exists
-	if err := os.Remove("application.log"); err != nil && !os.IsNotExist(err) {
-		fmt.Printf("Failed to delete old log file: %v\n", err)
-		return
+// Output formats.
+const (
+	FormatConsole = "console"
+	FormatJSON    = "json"
+)
+
+// Options configures the logger.
+type Options struct {
+	// Level is the minimum level written. It can be changed at runtime with SetLevel.
+	Level Level
+	// Format is FormatConsole or FormatJSON.
+	Format string
+	// File is an optional file every entry is also written to. It is
+	// appended to and rotated when it reaches MaxSizeMB.
+	File       string
+	MaxSizeMB  int
+	MaxBackups int
+}
+
+// Default rotation settings of the log file.
+const (
+	DefaultMaxSizeMB  = 100
+	DefaultMaxBackups = 3
+)
+
+// output holds the global logger configuration.
+type output struct {
+	mu      sync.Mutex
+	format  string
+	console io.Writer
+	color   bool
+	file    io.WriteCloser
+}
+
+var (
+	level = int32(LevelInfo)
+	out   = &output{format: FormatConsole, console: os.Stdout, color: isTerminal(os.Stdout)}
+	root  = &Logger{}
+)
+
+// Init configures the logger. Colors and emoji are only written when stdout
+// is a terminal.
+func Init(opts Options) error {
+	if opts.Format == "" {
+		opts.Format = FormatConsole
+	}
+	if opts.Format != FormatConsole && opts.Format != FormatJSON {
+		return fmt.Errorf("unknown log format %q, expected %s or %s", opts.Format, FormatConsole, FormatJSON)
 	}
 
-	file, err := os.OpenFile("application.log", os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0666)
-	if err != nil {
-		fmt.Printf("Failed to open log file: %v\n", err)
-		return
+	var file io.WriteCloser
+	if opts.File != "" {
+		if opts.MaxSizeMB <= 0 {
+			opts.MaxSizeMB = DefaultMaxSizeMB
+		}
+		if opts.MaxBackups < 0 {
+			opts.MaxBackups = DefaultMaxBackups
+		}
+		f, err := openRotatingFile(opts.File, int64(opts.MaxSizeMB)<<20, opts.MaxBackups)
+		if err != nil {
+			return err
+		}
+		file = f
 	}
 
-	// Set up loggers without prefixes
-	FileLogger = log.New(file, "", 0)         // No prefix and no flags
-	ConsoleLogger = log.New(os.Stdout, "", 0) // No prefix and no flags
+	out.mu.Lock()
+	defer out.mu.Unlock()
+	if out.file != nil {
+		out.file.Close()
+	}
+	out.format = opts.Format
+	out.file = file
+	SetLevel(opts.Level)
+	return nil
+}
+
+// isTerminal reports whether f is a character device such as a terminal.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// SetLevel changes the minimum level written. It is safe to call at any time.
+func SetLevel(l Level) {
+	atomic.StoreInt32(&level, int32(l))
+}
+
+// GetLevel returns the minimum level written.
+func GetLevel() Level {
+	return Level(atomic.LoadInt32(&level))
+}
+
+// Logger writes entries with a fixed set of key/value fields.
+type Logger struct {
+	fields []interface{}
 }
 
-// currentTimestamp returns the current date and time in the desired format
-func currentTimestamp() string {
-	return time.Now().Format("2006/01/02 15:04:05")
+// With returns a Logger adding the key/value pairs to every entry. Pairs
+// with an empty string value are left out, so optional fields such as the
+// cluster name can be passed unconditionally.
+func With(keysAndValues ...interface{}) *Logger {
+	return root.With(keysAndValues...)
+}
+
+// With returns a copy of the Logger with further key/value fields.
+func (l *Logger) With(keysAndValues ...interface{}) *Logger {
+	fields := append([]interface{}(nil), l.fields...)
+	for i := 0; i < len(keysAndValues); i += 2 {
+		key := fmt.Sprint(keysAndValues[i])
+		var value interface{} = "<missing>"
+		if i+1 < len(keysAndValues) {
+			value = keysAndValues[i+1]
+		}
+		if s, ok := value.(string); ok && s == "" {
+			continue
+		}
+		fields = append(fields, key, value)
+	}
+	return &Logger{fields: fields}
+}
+
+type contextKey struct{}
+
+// IntoContext returns a context carrying the logger.
+func IntoContext(ctx context.Context, l *Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, l)
+}
+
+// FromContext returns the logger stored in ctx, or one without fields.
+func FromContext(ctx context.Context) *Logger {
+	if l, ok := ctx.Value(contextKey{}).(*Logger); ok {
+		return l
+	}
+	return root
+}
+
+// Debug logs a debug message
+func (l *Logger) Debug(msg string, args ...interface{}) {
+	l.log(LevelDebug, fmt.Sprintf(msg, args...))
+}
+
+// Info logs an informational message
+func (l *Logger) Info(msg string, args ...interface{}) {
+	l.log(LevelInfo, fmt.Sprintf(msg, args...))
+}
+
+// Warning logs a warning message
+func (l *Logger) Warning(msg string, args ...interface{}) {
+	l.log(LevelWarning, fmt.Sprintf(msg, args...))
+}
+
+// Error logs an error message and returns it as an error, so callers can
+// log and return in one step. Use %w to wrap an error.
+func (l *Logger) Error(msg string, args ...interface{}) error {
+	err := fmt.Errorf(msg, args...)
+	l.log(LevelError, err.Error())
+	return err
+}
+
+// Fatal logs a fatal message and exits the program
+func (l *Logger) Fatal(msg string, args ...interface{}) {
+	l.log(LevelFatal, fmt.Sprintf(msg, args...))
+	os.Exit(1)
+}
+
+// Debug logs a debug message
+func Debug(msg string, args ...interface{}) {
+	root.log(LevelDebug, fmt.Sprintf(msg, args...))
 }
 
 // Info logs informational messages in the specified format
 func Info(msg string, args ...interface{}) {
-	msgFormatted := fmt.Sprintf("[INFO]   %s - %s 😊", currentTimestamp(), fmt.Sprintf(msg, args...))
-	ConsoleLogger.Println(BrightGreen + msgFormatted + Reset)
-	FileLogger.Println(msgFormatted)
+	root.log(LevelInfo, fmt.Sprintf(msg, args...))
 }
 
 // Warning logs warning messages in the specified format
 func Warning(msg string, args ...interface{}) {
-	msgFormatted := fmt.Sprintf("[WARNING] %s - %s ⚠️", currentTimestamp(), fmt.Sprintf(msg, args...))
-	ConsoleLogger.Println(BrightYellow + msgFormatted + Reset)
-	FileLogger.Println(msgFormatted)
+	root.log(LevelWarning, fmt.Sprintf(msg, args...))
 }
 
-// Error logs error messages in the specified format
+// Error logs error messages in the specified format and returns them as an error
 func Error(msg string, args ...interface{}) error {
-	msgFormatted := fmt.Sprintf("[ERROR]  %s - %s ❌", currentTimestamp(), fmt.Sprintf(msg, args...))
-	ConsoleLogger.Println(BrightRed + msgFormatted + Reset)
-	FileLogger.Println(msgFormatted)
-	return nil
+	err := fmt.Errorf(msg, args...)
+	root.log(LevelError, err.Error())
+	return err
 }
 
 // Fatal logs fatal messages in the specified format and exits the program
 func Fatal(msg string, args ...interface{}) {
-	msgFormatted := fmt.Sprintf("[FATAL]  %s - %s 💀", currentTimestamp(), fmt.Sprintf(msg, args...))
-	ConsoleLogger.Println(BrightRed + msgFormatted + Reset)
-	FileLogger.Println(msgFormatted)
+	root.log(LevelFatal, fmt.Sprintf(msg, args...))
 	os.Exit(1)
 }
+
+func (l *Logger) log(lvl Level, msg string) {
+	if lvl < GetLevel() {
+		return
+	}
+	now := time.Now()
+
+	out.mu.Lock()
+	defer out.mu.Unlock()
+	if out.format == FormatJSON {
+		line := formatJSON(now, lvl, msg, l.fields)
+		out.console.Write(line)
+		if out.file != nil {
+			out.file.Write(line)
+		}
+		return
+	}
+
+	line := formatConsole(now, lvl, msg, l.fields)
+	if out.color {
+		fmt.Fprintf(out.console, "%s%s %s%s\n", lvl.color(), line, lvl.emoji(), Reset)
+	} else {
+		fmt.Fprintln(out.console, line)
+	}
+	if out.file != nil {
+		fmt.Fprintln(out.file, line)
+	}
+}
+
+// formatConsole formats an entry as "[LEVEL] time - message key=value ...".
+func formatConsole(t time.Time, lvl Level, msg string, fields []interface{}) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%-9s %s - %s", "["+strings.ToUpper(lvl.String())+"]", t.Format("2006/01/02 15:04:05"), msg)
+	for i := 0; i+1 < len(fields); i += 2 {
+		value := formatValue(fields[i+1])
+		if strings.ContainsAny(value, " \"=\t\n") || value == "" {
+			value = strconv.Quote(value)
+		}
+		fmt.Fprintf(&b, " %s=%s", fields[i], value)
+	}
+	return b.String()
+}
+
+// formatJSON formats an entry as a single JSON object followed by a newline.
+func formatJSON(t time.Time, lvl Level, msg string, fields []interface{}) []byte {
+	var b strings.Builder
+	writePair := func(key string, value interface{}) {
+		k, _ := json.Marshal(key)
+		v, err := json.Marshal(value)
+		if err != nil {
+			v, _ = json.Marshal(fmt.Sprint(value))
+		}
+		b.Write(k)
+		b.WriteByte(':')
+		b.Write(v)
+	}
+
+	b.WriteByte('{')
+	writePair("time", t.Format(time.RFC3339Nano))
+	b.WriteByte(',')
+	writePair("level", lvl.String())
+	b.WriteByte(',')
+	writePair("msg", msg)
+	for i := 0; i+1 < len(fields); i += 2 {
+		b.WriteByte(',')
+		value := fields[i+1]
+		switch value.(type) {
+		case error, fmt.Stringer:
+			value = formatValue(value)
+		}
+		writePair(fmt.Sprint(fields[i]), value)
+	}
+	b.WriteString("}\n")
+	return []byte(b.String())
+}
+
+func formatValue(value interface{}) string {
+	switch v := value.(type) {
+	case error:
+		return v.Error()
+	case fmt.Stringer:
+		return v.String()
+	}
+	return fmt.Sprint(value)
+}
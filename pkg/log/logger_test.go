@@ -0,0 +1,168 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// capture redirects the console output to a buffer in the given format
+// until the test ends.
+func capture(t *testing.T, format string, lvl Level) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	out.mu.Lock()
+	savedFormat, savedConsole, savedColor, savedFile := out.format, out.console, out.color, out.file
+	out.format, out.console, out.color, out.file = format, &buf, false, nil
+	out.mu.Unlock()
+	savedLevel := GetLevel()
+	SetLevel(lvl)
+	t.Cleanup(func() {
+		out.mu.Lock()
+		if out.file != nil {
+			out.file.Close()
+		}
+		out.format, out.console, out.color, out.file = savedFormat, savedConsole, savedColor, savedFile
+		out.mu.Unlock()
+		SetLevel(savedLevel)
+	})
+	return &buf
+}
+
+func TestParseLevel(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    Level
+		wantErr bool
+	}{
+		{name: "debug", want: LevelDebug},
+		{name: "INFO", want: LevelInfo},
+		{name: " warning ", want: LevelWarning},
+		{name: "warn", want: LevelWarning},
+		{name: "error", want: LevelError},
+		{name: "fatal", want: LevelFatal},
+		{name: "verbose", want: LevelInfo, wantErr: true},
+		{name: "", want: LevelInfo, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseLevel(tt.name)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("ParseLevel(%q) = %s, %v, want %s and error %t", tt.name, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestLevelFiltering(t *testing.T) {
+	buf := capture(t, FormatConsole, LevelWarning)
+	logger := With("cluster", "east")
+	logger.Debug("debug entry")
+	logger.Info("info entry")
+	logger.Warning("warning entry")
+	logger.Error("error entry")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("wrote %d entries at level warning, want 2:\n%s", len(lines), buf)
+	}
+	for i, want := range []string{"[WARNING] ", "[ERROR]   "} {
+		if !strings.HasPrefix(lines[i], want) || !strings.HasSuffix(lines[i], "entry cluster=east") {
+			t.Errorf("entry %d = %q, want a %s entry with the cluster field", i, lines[i], strings.TrimSpace(want))
+		}
+	}
+
+	buf.Reset()
+	SetLevel(LevelDebug)
+	logger.Debug("debug entry")
+	if !strings.HasPrefix(buf.String(), "[DEBUG]") {
+		t.Errorf("wrote %q after SetLevel(debug), want the debug entry", buf.String())
+	}
+}
+
+func TestJSONFields(t *testing.T) {
+	buf := capture(t, FormatJSON, LevelInfo)
+	With("cluster", "east", "namespace", "", "replicas", 3).
+		With("err", errors.New("quota exceeded"), "after", 2*time.Second).
+		Info("Scaled %s", "shop/web")
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("entry %q is not a JSON object: %v", buf.String(), err)
+	}
+	if _, err := time.Parse(time.RFC3339Nano, entry["time"].(string)); err != nil {
+		t.Errorf("time %q is not RFC 3339: %v", entry["time"], err)
+	}
+	want := map[string]interface{}{
+		"level":    "info",
+		"msg":      "Scaled shop/web",
+		"cluster":  "east",
+		"replicas": 3.0,
+		"err":      "quota exceeded",
+		"after":    "2s",
+	}
+	for key, value := range want {
+		if entry[key] != value {
+			t.Errorf("%s = %v, want %v", key, entry[key], value)
+		}
+	}
+	if _, ok := entry["namespace"]; ok {
+		t.Error("the empty namespace field was written")
+	}
+	if !bytes.HasSuffix(buf.Bytes(), []byte("}\n")) || bytes.Count(buf.Bytes(), []byte("\n")) != 1 {
+		t.Errorf("entry %q is not a single line", buf.String())
+	}
+}
+
+func TestErrorReturnsError(t *testing.T) {
+	buf := capture(t, FormatConsole, LevelInfo)
+	cause := errors.New("connection refused")
+	err := With("cluster", "east").Error("error querying Prometheus: %w", cause)
+
+	if err == nil || err.Error() != "error querying Prometheus: connection refused" {
+		t.Fatalf("Error() = %v, want the formatted message", err)
+	}
+	if !errors.Is(err, cause) {
+		t.Error("Error() does not wrap the %w argument")
+	}
+	if !strings.Contains(buf.String(), "[ERROR]") || !strings.Contains(buf.String(), err.Error()) {
+		t.Errorf("wrote %q, want the error entry", buf.String())
+	}
+
+	buf.Reset()
+	SetLevel(LevelFatal)
+	if err := Error("dropped: %d", 1); err == nil || err.Error() != "dropped: 1" {
+		t.Errorf("Error() below the level = %v, want the error returned anyway", err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("wrote %q below the level", buf.String())
+	}
+}
+
+func TestInit(t *testing.T) {
+	capture(t, FormatConsole, LevelInfo)
+	if err := Init(Options{Format: "yaml"}); err == nil {
+		t.Error("Init() with format yaml succeeded, want an error")
+	}
+
+	path := filepath.Join(t.TempDir(), "autoscaler.log")
+	if err := Init(Options{Level: LevelWarning, Format: FormatJSON, File: path}); err != nil {
+		t.Fatalf("Init() error = %v", err)
+	}
+	if GetLevel() != LevelWarning {
+		t.Errorf("level = %s, want warning", GetLevel())
+	}
+	Info("not written")
+	Warning("disk almost full")
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSpace(string(data)), "\n"); len(lines) != 1 || !strings.Contains(lines[0], `"msg":"disk almost full"`) {
+		t.Errorf("log file = %q, want the warning as JSON", data)
+	}
+}
@@ -0,0 +1,100 @@
+package log
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// readLog returns the content of a log file, or "" when it does not exist.
+func readLog(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return ""
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestRotatingFile(t *testing.T) {
+	tests := []struct {
+		name       string
+		maxBackups int
+		// want is the content of the file and each backup after writing
+		// entries 1 to 5, two per file.
+		want []string
+	}{
+		{name: "two backups", maxBackups: 2, want: []string{"entry 5\n", "entry 3\nentry 4\n", "entry 1\nentry 2\n", ""}},
+		{name: "one backup", maxBackups: 1, want: []string{"entry 5\n", "entry 3\nentry 4\n", ""}},
+		{name: "no backups", maxBackups: 0, want: []string{"entry 5\n", ""}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "autoscaler.log")
+			f, err := openRotatingFile(path, 16, tt.maxBackups)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			for i := 1; i <= 5; i++ {
+				if _, err := fmt.Fprintf(f, "entry %d\n", i); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			for i, want := range tt.want {
+				name := path
+				if i > 0 {
+					name = fmt.Sprintf("%s.%d", path, i)
+				}
+				if got := readLog(t, name); got != want {
+					t.Errorf("%s = %q, want %q", filepath.Base(name), got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestRotatingFileAppends(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "autoscaler.log")
+	if err := os.WriteFile(path, []byte("entry 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The size of the existing file counts towards the limit
+	f, err := openRotatingFile(path, 16, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	for i := 2; i <= 3; i++ {
+		if _, err := fmt.Fprintf(f, "entry %d\n", i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, want := readLog(t, path), "entry 3\n"; got != want {
+		t.Errorf("log file = %q, want %q", got, want)
+	}
+	if got, want := readLog(t, path+".1"), "entry 1\nentry 2\n"; got != want {
+		t.Errorf("backup = %q, want %q", got, want)
+	}
+
+	// An entry larger than the limit is written to an empty file as is
+	long := "an entry longer than the limit\n"
+	if _, err := f.Write([]byte(long)); err != nil {
+		t.Fatal(err)
+	}
+	if got := readLog(t, path); got != long {
+		t.Errorf("log file = %q, want only the long entry", got)
+	}
+}
+
+func TestOpenRotatingFileError(t *testing.T) {
+	if _, err := openRotatingFile(filepath.Join(t.TempDir(), "missing", "autoscaler.log"), 16, 1); err == nil {
+		t.Error("openRotatingFile() in a missing directory succeeded, want an error")
+	}
+}
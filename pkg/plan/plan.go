@@ -0,0 +1,122 @@
+package plan
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// Action kinds recorded in a plan.
+const (
+	ResizePVC = "resize-pvc"
+	Scale     = "scale"
+)
+
+// Action describes a single change the autoscaler would make.
+type Action struct {
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace"`
+	Workload  string `json:"workload"`
+	Target    string `json:"target"`
+	Current   string `json:"current"`
+	Proposed  string `json:"proposed"`
+	Reason    string `json:"reason"`
+}
+
+// Plan collects the actions of one monitoring cycle. It is safe for
+// concurrent use by several workers.
+type Plan struct {
+	mu      sync.Mutex
+	Cluster string    `json:"cluster,omitempty"`
+	Started time.Time `json:"started"`
+	Actions []Action  `json:"actions"`
+}
+
+// New returns an empty plan for a cycle starting now.
+func New() *Plan {
+	return &Plan{Started: time.Now(), Actions: []Action{}}
+}
+
+// Add records an action in the plan.
+func (p *Plan) Add(action Action) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.Actions = append(p.Actions, action)
+}
+
+// sorted returns a copy of the actions ordered by namespace, workload and target.
+func (p *Plan) sorted() []Action {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	actions := append([]Action(nil), p.Actions...)
+	sort.SliceStable(actions, func(i, j int) bool {
+		if actions[i].Namespace != actions[j].Namespace {
+			return actions[i].Namespace < actions[j].Namespace
+		}
+		if actions[i].Workload != actions[j].Workload {
+			return actions[i].Workload < actions[j].Workload
+		}
+		return actions[i].Target < actions[j].Target
+	})
+	return actions
+}
+
+// WriteTable writes the plan as a human readable table.
+func (p *Plan) WriteTable(w io.Writer) error {
+	actions := p.sorted()
+	title := "Plan"
+	if p.Cluster != "" {
+		title = fmt.Sprintf("Plan of cluster %s", p.Cluster)
+	}
+	if len(actions) == 0 {
+		_, err := fmt.Fprintf(w, "%s for cycle started %s: no changes.\n", title, p.Started.Format(time.RFC3339))
+		return err
+	}
+
+	fmt.Fprintf(w, "%s for cycle started %s: %d change(s).\n", title, p.Started.Format(time.RFC3339), len(actions))
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "KIND\tNAMESPACE\tWORKLOAD\tTARGET\tCURRENT\tPROPOSED\tREASON")
+	for _, a := range actions {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", a.Kind, a.Namespace, a.Workload, a.Target, a.Current, a.Proposed, a.Reason)
+	}
+	return tw.Flush()
+}
+
+// WriteJSON writes the plan as indented JSON.
+func (p *Plan) WriteJSON(w io.Writer) error {
+	out := struct {
+		Cluster string    `json:"cluster,omitempty"`
+		Started time.Time `json:"started"`
+		Actions []Action  `json:"actions"`
+	}{Cluster: p.Cluster, Started: p.Started, Actions: p.sorted()}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
+
+// Write writes the plan in the given format ("table" or "json"). The plan
+// is written in a single call so plans of several clusters written at the
+// same time do not interleave.
+func (p *Plan) Write(w io.Writer, format string) error {
+	var buf bytes.Buffer
+	var err error
+	switch format {
+	case "json":
+		err = p.WriteJSON(&buf)
+	case "table", "":
+		err = p.WriteTable(&buf)
+	default:
+		return fmt.Errorf("unknown plan output format %q", format)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(buf.Bytes())
+	return err
+}
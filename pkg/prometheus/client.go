@@ -0,0 +1,281 @@
+package prometheus
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Defaults applied by New to unset Config fields.
+const (
+	DefaultTimeout      = 10 * time.Second
+	DefaultRetryBackoff = 500 * time.Millisecond
+)
+
+// BasicAuth holds HTTP basic auth credentials. PasswordFile takes precedence
+// over Password and is re-read on every request.
+type BasicAuth struct {
+	Username     string
+	Password     string
+	PasswordFile string
+}
+
+// TLSConfig configures the TLS connection to Prometheus. CertFile and
+// KeyFile enable mTLS.
+type TLSConfig struct {
+	CAFile             string
+	CertFile           string
+	KeyFile            string
+	ServerName         string
+	InsecureSkipVerify bool
+}
+
+// Config configures a Client.
+type Config struct {
+	// URL is the base URL of the Prometheus (or Thanos) API.
+	URL string
+	// BearerToken is sent in the Authorization header. BearerTokenFile takes
+	// precedence and is re-read on every request, so rotated tokens are
+	// picked up.
+	BearerToken     string
+	BearerTokenFile string
+	BasicAuth       *BasicAuth
+	// Headers are added to every request.
+	Headers map[string]string
+	TLS     TLSConfig
+	// Timeout bounds a single request attempt.
+	Timeout time.Duration
+	// Retries is the number of times a failed request is retried.
+	Retries int
+	// RetryBackoff is the wait before the first retry. It doubles with
+	// every further retry.
+	RetryBackoff time.Duration
+	// Observe, when set, is called after every query with its duration,
+	// retries included, and its final error.
+	Observe func(duration time.Duration, err error)
+}
+
+// Client queries the Prometheus HTTP API.
+type Client struct {
+	baseURL *url.URL
+	http    *http.Client
+	config  Config
+}
+
+// New creates a Client for the given config.
+func New(cfg Config) (*Client, error) {
+	if cfg.URL == "" {
+		return nil, fmt.Errorf("prometheus URL is not set")
+	}
+	baseURL, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid prometheus URL %q: %v", cfg.URL, err)
+	}
+	if cfg.BearerToken != "" && cfg.BasicAuth != nil {
+		return nil, fmt.Errorf("bearer token and basic auth are mutually exclusive")
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+	if cfg.RetryBackoff <= 0 {
+		cfg.RetryBackoff = DefaultRetryBackoff
+	}
+
+	tlsConfig, err := newTLSConfig(cfg.TLS)
+	if err != nil {
+		return nil, err
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+
+	return &Client{
+		baseURL: baseURL,
+		http:    &http.Client{Transport: transport},
+		config:  cfg,
+	}, nil
+}
+
+// newTLSConfig loads the CA and client certificates.
+func newTLSConfig(cfg TLSConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		ServerName:         cfg.ServerName,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	}
+	if cfg.CAFile != "" {
+		ca, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading CA file %s: %v", cfg.CAFile, err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificates found in CA file %s", cfg.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if (cfg.CertFile == "") != (cfg.KeyFile == "") {
+		return nil, fmt.Errorf("TLS certFile and keyFile must be set together")
+	}
+	if cfg.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("error loading client certificate: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// apiResponse is the envelope of every Prometheus API response.
+type apiResponse struct {
+	Status    string          `json:"status"`
+	Data      json.RawMessage `json:"data"`
+	ErrorType string          `json:"errorType"`
+	Error     string          `json:"error"`
+}
+
+// Query evaluates an instant query at ts. A zero ts means now.
+func (c *Client) Query(ctx context.Context, query string, ts time.Time) (*Result, error) {
+	params := url.Values{"query": {query}}
+	if !ts.IsZero() {
+		params.Set("time", formatTime(ts))
+	}
+	return c.do(ctx, "/api/v1/query", query, params)
+}
+
+// QueryRange evaluates a range query between start and end with the given
+// resolution step.
+func (c *Client) QueryRange(ctx context.Context, query string, start, end time.Time, step time.Duration) (*Result, error) {
+	params := url.Values{
+		"query": {query},
+		"start": {formatTime(start)},
+		"end":   {formatTime(end)},
+		"step":  {strconv.FormatFloat(step.Seconds(), 'f', -1, 64)},
+	}
+	return c.do(ctx, "/api/v1/query_range", query, params)
+}
+
+func formatTime(t time.Time) string {
+	return strconv.FormatFloat(float64(t.UnixNano())/1e9, 'f', -1, 64)
+}
+
+// do posts the query, retrying transport errors, 5xx and 429 responses with
+// exponential backoff.
+func (c *Client) do(ctx context.Context, path, query string, params url.Values) (result *Result, err error) {
+	if c.config.Observe != nil {
+		start := time.Now()
+		defer func() { c.config.Observe(time.Since(start), err) }()
+	}
+
+	backoff := c.config.RetryBackoff
+	var lastErr error
+	for attempt := 0; attempt <= c.config.Retries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+		}
+
+		result, retry, err := c.attempt(ctx, path, params)
+		if err == nil {
+			return result, nil
+		}
+		lastErr = err
+		if !retry || ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, fmt.Errorf("query %q failed: %v", query, lastErr)
+}
+
+// attempt performs a single request. The returned bool reports whether the
+// error is worth retrying.
+func (c *Client) attempt(ctx context.Context, path string, params url.Values) (*Result, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.config.Timeout)
+	defer cancel()
+
+	endpoint := *c.baseURL
+	endpoint.Path = strings.TrimSuffix(endpoint.Path, "/") + path
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.String(), strings.NewReader(params.Encode()))
+	if err != nil {
+		return nil, false, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if err := c.authorize(req); err != nil {
+		return nil, false, err
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, true, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, true, fmt.Errorf("error reading response: %v", err)
+	}
+	if resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests {
+		return nil, true, fmt.Errorf("server returned %s", resp.Status)
+	}
+
+	var envelope apiResponse
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		if resp.StatusCode != http.StatusOK {
+			return nil, false, fmt.Errorf("server returned %s", resp.Status)
+		}
+		return nil, false, fmt.Errorf("error unmarshalling response: %v", err)
+	}
+	if envelope.Status != "success" {
+		return nil, false, fmt.Errorf("%s: %s", envelope.ErrorType, envelope.Error)
+	}
+
+	result, err := parseResult(envelope.Data)
+	if err != nil {
+		return nil, false, err
+	}
+	return result, false, nil
+}
+
+// authorize adds the configured credentials and headers to the request.
+func (c *Client) authorize(req *http.Request) error {
+	for name, value := range c.config.Headers {
+		req.Header.Set(name, value)
+	}
+
+	token := c.config.BearerToken
+	if c.config.BearerTokenFile != "" {
+		data, err := os.ReadFile(c.config.BearerTokenFile)
+		if err != nil {
+			return fmt.Errorf("error reading bearer token file %s: %v", c.config.BearerTokenFile, err)
+		}
+		token = strings.TrimSpace(string(data))
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	if auth := c.config.BasicAuth; auth != nil {
+		password := auth.Password
+		if auth.PasswordFile != "" {
+			data, err := os.ReadFile(auth.PasswordFile)
+			if err != nil {
+				return fmt.Errorf("error reading password file %s: %v", auth.PasswordFile, err)
+			}
+			password = strings.TrimSpace(string(data))
+		}
+		req.SetBasicAuth(auth.Username, password)
+	}
+	return nil
+}
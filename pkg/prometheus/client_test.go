@@ -0,0 +1,340 @@
+package prometheus
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeServer serves canned responses, one per request with the last one
+// repeated, and records the requests it receives.
+type fakeServer struct {
+	mu        sync.Mutex
+	responses []cannedResponse
+	requests  []*http.Request
+	forms     []map[string]string
+}
+
+type cannedResponse struct {
+	status int
+	body   string
+}
+
+func ok(body string) cannedResponse {
+	return cannedResponse{http.StatusOK, body}
+}
+
+func (f *fakeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	form := map[string]string{}
+	for name := range r.PostForm {
+		form[name] = r.PostForm.Get(name)
+	}
+
+	f.mu.Lock()
+	i := len(f.requests)
+	f.requests = append(f.requests, r)
+	f.forms = append(f.forms, form)
+	if i >= len(f.responses) {
+		i = len(f.responses) - 1
+	}
+	response := f.responses[i]
+	f.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(response.status)
+	w.Write([]byte(response.body))
+}
+
+func (f *fakeServer) count() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.requests)
+}
+
+// newTestClient starts a server answering with responses and returns a
+// client for it. cfg.URL is filled in and backoffs are kept short.
+func newTestClient(t *testing.T, cfg Config, responses ...cannedResponse) (*Client, *fakeServer) {
+	t.Helper()
+	f := &fakeServer{responses: responses}
+	server := httptest.NewServer(f)
+	t.Cleanup(server.Close)
+
+	cfg.URL = server.URL
+	if cfg.RetryBackoff == 0 {
+		cfg.RetryBackoff = time.Millisecond
+	}
+	client, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	return client, f
+}
+
+const (
+	vectorOne = `{"status":"success","data":{"resultType":"vector","result":[
+		{"metric":{"persistentvolumeclaim":"data"},"value":[1700000000.5,"42.5"]}]}}`
+	vectorTwo = `{"status":"success","data":{"resultType":"vector","result":[
+		{"metric":{"pod":"web-1"},"value":[1700000000,"1"]},
+		{"metric":{"pod":"web-2"},"value":[1700000000,"2"]}]}}`
+	vectorEmpty = `{"status":"success","data":{"resultType":"vector","result":[]}}`
+	scalar      = `{"status":"success","data":{"resultType":"scalar","result":[1700000000,"7"]}}`
+	matrix      = `{"status":"success","data":{"resultType":"matrix","result":[
+		{"metric":{"pvc":"data"},"values":[[1700000000,"1"],[1700000060,"2"]]}]}}`
+)
+
+func TestQueryVector(t *testing.T) {
+	client, f := newTestClient(t, Config{}, ok(vectorOne))
+	result, err := client.Query(context.Background(), "disk_usage", time.Time{})
+	if err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	if result.Type != ValueVector || len(result.Vector) != 1 {
+		t.Fatalf("Query() = %+v, want a vector with one sample", result)
+	}
+	sample := result.Vector[0]
+	if sample.Metric["persistentvolumeclaim"] != "data" || sample.Value != 42.5 {
+		t.Errorf("sample = %+v, want data at 42.5", sample)
+	}
+	if want := time.Unix(1700000000, 500000000); !sample.Time.Equal(want) {
+		t.Errorf("sample time = %s, want %s", sample.Time, want)
+	}
+	if value, err := result.Single(); err != nil || value != 42.5 {
+		t.Errorf("Single() = %v, %v, want 42.5", value, err)
+	}
+
+	r := f.requests[0]
+	if r.Method != http.MethodPost || r.URL.Path != "/api/v1/query" {
+		t.Errorf("request %s %s, want POST /api/v1/query", r.Method, r.URL.Path)
+	}
+	if f.forms[0]["query"] != "disk_usage" {
+		t.Errorf("query parameter = %q, want disk_usage", f.forms[0]["query"])
+	}
+	if _, ok := f.forms[0]["time"]; ok {
+		t.Errorf("time parameter sent for a zero time")
+	}
+}
+
+func TestQueryScalar(t *testing.T) {
+	client, f := newTestClient(t, Config{}, ok(scalar))
+	result, err := client.Query(context.Background(), "scalar(up)", time.Unix(1700000000, 0))
+	if err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	if result.Type != ValueScalar || result.Scalar.Value != 7 {
+		t.Fatalf("Query() = %+v, want the scalar 7", result)
+	}
+	if value, err := result.Single(); err != nil || value != 7 {
+		t.Errorf("Single() = %v, %v, want 7", value, err)
+	}
+	if got := f.forms[0]["time"]; got != "1700000000" {
+		t.Errorf("time parameter = %q, want 1700000000", got)
+	}
+}
+
+func TestQueryRangeMatrix(t *testing.T) {
+	client, f := newTestClient(t, Config{}, ok(matrix))
+	start := time.Unix(1700000000, 0)
+	result, err := client.QueryRange(context.Background(), "used_bytes", start, start.Add(time.Minute), 30*time.Second)
+	if err != nil {
+		t.Fatalf("QueryRange() error = %v", err)
+	}
+	if result.Type != ValueMatrix || len(result.Matrix) != 1 || len(result.Matrix[0].Points) != 2 {
+		t.Fatalf("QueryRange() = %+v, want a matrix with one series of two points", result)
+	}
+	points := result.Matrix[0].Points
+	if points[0].Value != 1 || points[1].Value != 2 || !points[1].Time.Equal(start.Add(time.Minute)) {
+		t.Errorf("points = %+v, want 1 and 2 a minute apart", points)
+	}
+	if _, err := result.Single(); err == nil {
+		t.Errorf("Single() of a matrix succeeded, want an error")
+	}
+
+	if f.requests[0].URL.Path != "/api/v1/query_range" {
+		t.Errorf("request path = %s, want /api/v1/query_range", f.requests[0].URL.Path)
+	}
+	want := map[string]string{"query": "used_bytes", "start": "1700000000", "end": "1700000060", "step": "30"}
+	for name, value := range want {
+		if got := f.forms[0][name]; got != value {
+			t.Errorf("%s parameter = %q, want %q", name, got, value)
+		}
+	}
+}
+
+func TestSingle(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		want    float64
+		wantErr func(error) bool
+	}{
+		{name: "one sample", body: vectorOne, want: 42.5},
+		{name: "no samples", body: vectorEmpty, wantErr: func(err error) bool { return errors.Is(err, ErrNoData) }},
+		{name: "multiple series", body: vectorTwo, wantErr: func(err error) bool {
+			var multiple *MultipleSeriesError
+			return errors.As(err, &multiple) && multiple.Count == 2
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, _ := newTestClient(t, Config{}, ok(tt.body))
+			result, err := client.Query(context.Background(), "q", time.Time{})
+			if err != nil {
+				t.Fatalf("Query() error = %v", err)
+			}
+			value, err := result.Single()
+			if tt.wantErr != nil {
+				if !tt.wantErr(err) {
+					t.Errorf("Single() error = %v, want a different error", err)
+				}
+				return
+			}
+			if err != nil || value != tt.want {
+				t.Errorf("Single() = %v, %v, want %v", value, err, tt.want)
+			}
+		})
+	}
+
+	// The error names the series count so a missing aggregation is obvious
+	if msg := (&MultipleSeriesError{Count: 3}).Error(); !strings.Contains(msg, "3 series") {
+		t.Errorf("MultipleSeriesError = %q, want it to name the 3 series", msg)
+	}
+}
+
+func TestQueryAuthorization(t *testing.T) {
+	dir := t.TempDir()
+	tokenFile := filepath.Join(dir, "token")
+	passwordFile := filepath.Join(dir, "password")
+	if err := os.WriteFile(tokenFile, []byte("file-token\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(passwordFile, []byte("file-secret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		cfg   Config
+		check func(t *testing.T, r *http.Request)
+	}{
+		{name: "bearer token", cfg: Config{BearerToken: "token"}, check: func(t *testing.T, r *http.Request) {
+			if got := r.Header.Get("Authorization"); got != "Bearer token" {
+				t.Errorf("Authorization = %q, want Bearer token", got)
+			}
+		}},
+		{name: "bearer token file", cfg: Config{BearerToken: "ignored", BearerTokenFile: tokenFile}, check: func(t *testing.T, r *http.Request) {
+			if got := r.Header.Get("Authorization"); got != "Bearer file-token" {
+				t.Errorf("Authorization = %q, want Bearer file-token", got)
+			}
+		}},
+		{name: "basic auth", cfg: Config{BasicAuth: &BasicAuth{Username: "user", Password: "secret"}}, check: func(t *testing.T, r *http.Request) {
+			if user, password, ok := r.BasicAuth(); !ok || user != "user" || password != "secret" {
+				t.Errorf("basic auth = %q, %q, %v, want user, secret", user, password, ok)
+			}
+		}},
+		{name: "basic auth password file", cfg: Config{BasicAuth: &BasicAuth{Username: "user", PasswordFile: passwordFile}}, check: func(t *testing.T, r *http.Request) {
+			if user, password, ok := r.BasicAuth(); !ok || user != "user" || password != "file-secret" {
+				t.Errorf("basic auth = %q, %q, %v, want user, file-secret", user, password, ok)
+			}
+		}},
+		{name: "headers", cfg: Config{Headers: map[string]string{"X-Scope-OrgID": "tenant"}}, check: func(t *testing.T, r *http.Request) {
+			if got := r.Header.Get("X-Scope-OrgID"); got != "tenant" {
+				t.Errorf("X-Scope-OrgID = %q, want tenant", got)
+			}
+			if got := r.Header.Get("Authorization"); got != "" {
+				t.Errorf("Authorization = %q, want none", got)
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, f := newTestClient(t, tt.cfg, ok(vectorOne))
+			if _, err := client.Query(context.Background(), "q", time.Time{}); err != nil {
+				t.Fatalf("Query() error = %v", err)
+			}
+			tt.check(t, f.requests[0])
+		})
+	}
+
+	if _, err := New(Config{URL: "http://prometheus", BearerToken: "token", BasicAuth: &BasicAuth{Username: "user"}}); err == nil {
+		t.Errorf("New() with a bearer token and basic auth succeeded, want an error")
+	}
+}
+
+func TestQueryRetries(t *testing.T) {
+	unavailable := cannedResponse{http.StatusServiceUnavailable, "unavailable"}
+	tooMany := cannedResponse{http.StatusTooManyRequests, "slow down"}
+	badRequest := cannedResponse{http.StatusBadRequest, `{"status":"error","errorType":"bad_data","error":"parse error"}`}
+
+	tests := []struct {
+		name         string
+		retries      int
+		responses    []cannedResponse
+		wantErr      string
+		wantRequests int
+	}{
+		{name: "5xx then success", retries: 2, responses: []cannedResponse{unavailable, unavailable, ok(vectorOne)}, wantRequests: 3},
+		{name: "429 then success", retries: 1, responses: []cannedResponse{tooMany, ok(vectorOne)}, wantRequests: 2},
+		{name: "retries exhausted", retries: 2, responses: []cannedResponse{unavailable}, wantErr: "503", wantRequests: 3},
+		{name: "no retries", retries: 0, responses: []cannedResponse{unavailable, ok(vectorOne)}, wantErr: "503", wantRequests: 1},
+		{name: "4xx is not retried", retries: 2, responses: []cannedResponse{badRequest, ok(vectorOne)}, wantErr: "bad_data: parse error", wantRequests: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var observed []error
+			cfg := Config{Retries: tt.retries, Observe: func(_ time.Duration, err error) { observed = append(observed, err) }}
+			client, f := newTestClient(t, cfg, tt.responses...)
+			_, err := client.Query(context.Background(), "q", time.Time{})
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("Query() error = %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("Query() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+			if n := f.count(); n != tt.wantRequests {
+				t.Errorf("server received %d requests, want %d", n, tt.wantRequests)
+			}
+			if len(observed) != 1 || (observed[0] == nil) != (tt.wantErr == "") {
+				t.Errorf("Observe called with %v, want once with the final error", observed)
+			}
+		})
+	}
+}
+
+func TestQueryNonSuccessStatus(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		wantErr string
+	}{
+		{name: "error status", status: http.StatusOK, body: `{"status":"error","errorType":"execution","error":"query timed out"}`, wantErr: "execution: query timed out"},
+		{name: "unprocessable", status: http.StatusUnprocessableEntity, body: `{"status":"error","errorType":"execution","error":"many-to-many matching"}`, wantErr: "execution: many-to-many matching"},
+		{name: "not JSON", status: http.StatusNotFound, body: "404 page not found", wantErr: "404"},
+		{name: "invalid JSON", status: http.StatusOK, body: "{", wantErr: "error unmarshalling response"},
+		{name: "unsupported type", status: http.StatusOK, body: `{"status":"success","data":{"resultType":"string","result":[0,"a"]}}`, wantErr: "unsupported result type"},
+		{name: "invalid value", status: http.StatusOK, body: `{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[0,"high"]}]}}`, wantErr: "invalid sample value"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, f := newTestClient(t, Config{Retries: 2}, cannedResponse{tt.status, tt.body})
+			_, err := client.Query(context.Background(), "q", time.Time{})
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Query() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+			if n := f.count(); n != 1 {
+				t.Errorf("server received %d requests, want 1 without retries", n)
+			}
+		})
+	}
+}
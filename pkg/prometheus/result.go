@@ -0,0 +1,158 @@
+package prometheus
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+)
+
+// ValueType is the type of a query result.
+type ValueType string
+
+// Result types returned by the Prometheus API.
+const (
+	ValueVector ValueType = "vector"
+	ValueScalar ValueType = "scalar"
+	ValueMatrix ValueType = "matrix"
+	ValueString ValueType = "string"
+)
+
+// ErrNoData is returned by Single when a query returns no series.
+var ErrNoData = errors.New("query returned no data")
+
+// MultipleSeriesError is returned by Single when a query that should return
+// one series returns several, e.g. because it lacks an aggregation.
+type MultipleSeriesError struct {
+	Count int
+}
+
+func (e *MultipleSeriesError) Error() string {
+	return fmt.Sprintf("query returned %d series, expected one", e.Count)
+}
+
+// Point is a single value at a point in time.
+type Point struct {
+	Time  time.Time
+	Value float64
+}
+
+// Sample is a labelled point, an element of a vector.
+type Sample struct {
+	Metric map[string]string
+	Point
+}
+
+// Series is a labelled list of points, an element of a matrix.
+type Series struct {
+	Metric map[string]string
+	Points []Point
+}
+
+// Result is a parsed query result. Only the field matching Type is set.
+type Result struct {
+	Type   ValueType
+	Vector []Sample
+	Scalar Point
+	Matrix []Series
+}
+
+// Single returns the value of a scalar result or of a vector with exactly
+// one sample.
+func (r *Result) Single() (float64, error) {
+	switch r.Type {
+	case ValueScalar:
+		return r.Scalar.Value, nil
+	case ValueVector:
+		switch len(r.Vector) {
+		case 0:
+			return 0, ErrNoData
+		case 1:
+			return r.Vector[0].Value, nil
+		}
+		return 0, &MultipleSeriesError{Count: len(r.Vector)}
+	}
+	return 0, fmt.Errorf("expected a vector or scalar result, got %s", r.Type)
+}
+
+// parseResult decodes the data field of a query response.
+func parseResult(data json.RawMessage) (*Result, error) {
+	var raw struct {
+		ResultType ValueType       `json:"resultType"`
+		Result     json.RawMessage `json:"result"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("error unmarshalling result: %v", err)
+	}
+
+	result := &Result{Type: raw.ResultType}
+	switch raw.ResultType {
+	case ValueScalar:
+		point, err := parsePoint(raw.Result)
+		if err != nil {
+			return nil, err
+		}
+		result.Scalar = point
+	case ValueVector:
+		var samples []struct {
+			Metric map[string]string `json:"metric"`
+			Value  json.RawMessage   `json:"value"`
+		}
+		if err := json.Unmarshal(raw.Result, &samples); err != nil {
+			return nil, fmt.Errorf("error unmarshalling vector: %v", err)
+		}
+		for _, s := range samples {
+			point, err := parsePoint(s.Value)
+			if err != nil {
+				return nil, err
+			}
+			result.Vector = append(result.Vector, Sample{Metric: s.Metric, Point: point})
+		}
+	case ValueMatrix:
+		var series []struct {
+			Metric map[string]string `json:"metric"`
+			Values []json.RawMessage `json:"values"`
+		}
+		if err := json.Unmarshal(raw.Result, &series); err != nil {
+			return nil, fmt.Errorf("error unmarshalling matrix: %v", err)
+		}
+		for _, s := range series {
+			out := Series{Metric: s.Metric}
+			for _, v := range s.Values {
+				point, err := parsePoint(v)
+				if err != nil {
+					return nil, err
+				}
+				out.Points = append(out.Points, point)
+			}
+			result.Matrix = append(result.Matrix, out)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported result type %q", raw.ResultType)
+	}
+	return result, nil
+}
+
+// parsePoint decodes a [<unix time>, "<value>"] pair.
+func parsePoint(data json.RawMessage) (Point, error) {
+	var pair []interface{}
+	if err := json.Unmarshal(data, &pair); err != nil || len(pair) != 2 {
+		return Point{}, fmt.Errorf("invalid sample %s", string(data))
+	}
+	ts, ok := pair[0].(float64)
+	if !ok {
+		return Point{}, fmt.Errorf("invalid sample timestamp %v", pair[0])
+	}
+	s, ok := pair[1].(string)
+	if !ok {
+		return Point{}, fmt.Errorf("invalid sample value %v", pair[1])
+	}
+	value, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return Point{}, fmt.Errorf("invalid sample value %q: %v", s, err)
+	}
+	sec, frac := math.Modf(ts)
+	return Point{Time: time.Unix(int64(sec), int64(frac*1e9)), Value: value}, nil
+}
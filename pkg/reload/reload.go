@@ -0,0 +1,144 @@
+package reload
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s-resource-autoscaler/config"
+	"k8s-resource-autoscaler/pkg/log"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+// FilePollInterval is how often WatchFile checks the file for changes.
+// Polling the content also catches the symlink swap used by ConfigMap
+// volume mounts.
+const FilePollInterval = 10 * time.Second
+
+// ApplyFunc hands a new, validated configuration to its users. Returning an
+// error rejects the configuration.
+type ApplyFunc func(cfg *config.AutoscalerConfig) error
+
+// reloader parses each new version of the configuration and applies it when
+// it is valid and differs from the current one.
+type reloader struct {
+	mu      sync.Mutex
+	source  string
+	last    []byte
+	current *config.AutoscalerConfig
+	apply   ApplyFunc
+}
+
+func (r *reloader) handle(data []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.last != nil && bytes.Equal(data, r.last) {
+		return
+	}
+	r.last = data
+
+	cfg, err := config.Parse(data)
+	if err != nil {
+		log.Error("Rejected configuration from %s, keeping the last good configuration: %v", r.source, err)
+		return
+	}
+	changes := config.Diff(r.current, cfg)
+	if len(changes) == 0 {
+		return
+	}
+	if err := r.apply(cfg); err != nil {
+		log.Error("Rejected configuration from %s, keeping the last good configuration: %v", r.source, err)
+		return
+	}
+	r.current = cfg
+	log.Info("Reloaded configuration from %s:\n  %s", r.source, strings.Join(changes, "\n  "))
+}
+
+// WatchFile polls the configuration file until ctx is cancelled and applies
+// every valid change. current is the configuration already in use.
+func WatchFile(ctx context.Context, path string, current *config.AutoscalerConfig, apply ApplyFunc) {
+	r := &reloader{source: path, current: current, apply: apply}
+	if data, err := os.ReadFile(path); err == nil {
+		r.last = data
+	}
+
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			log.Warning("Error reading configuration file %s: %v", path, err)
+			return
+		}
+		r.handle(data)
+	}, FilePollInterval)
+}
+
+// WatchConfigMap watches the key of a ConfigMap through the API until ctx is
+// cancelled and applies every valid change. current is the configuration
+// already in use.
+func WatchConfigMap(ctx context.Context, clientset kubernetes.Interface, namespace, name, key string, current *config.AutoscalerConfig, apply ApplyFunc) {
+	r := &reloader{source: fmt.Sprintf("ConfigMap %s/%s", namespace, name), current: current, apply: apply}
+
+	handle := func(obj interface{}) {
+		cm, ok := obj.(*corev1.ConfigMap)
+		if !ok || cm.Name != name {
+			return
+		}
+		data, ok := cm.Data[key]
+		if !ok {
+			log.Warning("ConfigMap %s/%s has no key %s, keeping the last good configuration.", namespace, name, key)
+			return
+		}
+		r.handle([]byte(data))
+	}
+
+	selector := fields.OneTermEqualSelector("metadata.name", name).String()
+	lw := &cache.ListWatch{
+		ListFunc: func(opts metav1.ListOptions) (runtime.Object, error) {
+			opts.FieldSelector = selector
+			return clientset.CoreV1().ConfigMaps(namespace).List(ctx, opts)
+		},
+		WatchFunc: func(opts metav1.ListOptions) (watch.Interface, error) {
+			opts.FieldSelector = selector
+			return clientset.CoreV1().ConfigMaps(namespace).Watch(ctx, opts)
+		},
+	}
+	_, informer := cache.NewInformer(lw, &corev1.ConfigMap{}, 0, cache.ResourceEventHandlerFuncs{
+		AddFunc:    handle,
+		UpdateFunc: func(_, obj interface{}) { handle(obj) },
+	})
+	informer.Run(ctx.Done())
+}
+
+// ParseConfigMapRef splits a "namespace/name" reference.
+func ParseConfigMapRef(ref string) (namespace, name string, err error) {
+	parts := strings.Split(ref, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", fmt.Errorf("invalid ConfigMap reference %q, expected namespace/name", ref)
+	}
+	return parts[0], parts[1], nil
+}
+
+// LoadConfigMap reads and parses the configuration stored under key in a ConfigMap.
+func LoadConfigMap(ctx context.Context, clientset kubernetes.Interface, namespace, name, key string) (*config.AutoscalerConfig, error) {
+	cm, err := clientset.CoreV1().ConfigMaps(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("error getting ConfigMap %s/%s: %v", namespace, name, err)
+	}
+	data, ok := cm.Data[key]
+	if !ok {
+		return nil, fmt.Errorf("ConfigMap %s/%s has no key %s", namespace, name, key)
+	}
+	return config.Parse([]byte(data))
+}
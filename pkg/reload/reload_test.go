@@ -0,0 +1,198 @@
+package reload
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"k8s-resource-autoscaler/config"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// baseConfig leaves the interval at its default of 5 minutes.
+const baseConfig = `
+thresholds:
+  diskUsage:
+    resize: 80
+  networkUsage:
+    ingress:
+      scale: 100
+prometheus:
+  url: http://prometheus:9090
+  disk_usage_query: disk
+  network_usage_queries:
+    ingress: ingress
+`
+
+// withInterval returns baseConfig with the interval set.
+func withInterval(interval string) string {
+	return "interval: " + interval + "\n" + baseConfig
+}
+
+// applied records the configurations handed to an ApplyFunc.
+type applied struct {
+	mu   sync.Mutex
+	cfgs []*config.AutoscalerConfig
+	err  error
+}
+
+func (a *applied) apply(cfg *config.AutoscalerConfig) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.err != nil {
+		return a.err
+	}
+	a.cfgs = append(a.cfgs, cfg)
+	return nil
+}
+
+func (a *applied) intervals() []int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var intervals []int
+	for _, cfg := range a.cfgs {
+		intervals = append(intervals, cfg.Interval)
+	}
+	return intervals
+}
+
+func parse(t *testing.T, data string) *config.AutoscalerConfig {
+	t.Helper()
+	cfg, err := config.Parse([]byte(data))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	return cfg
+}
+
+func TestHandle(t *testing.T) {
+	tests := []struct {
+		name          string
+		versions      []string
+		applyErr      error
+		wantApplied   []int
+		wantCurrentAt int
+	}{
+		{
+			name:          "applies a change",
+			versions:      []string{withInterval("7")},
+			wantApplied:   []int{7},
+			wantCurrentAt: 7,
+		},
+		{
+			name:          "rejects an invalid config",
+			versions:      []string{withInterval("0"), "interval: [", withInterval("7")},
+			wantApplied:   []int{7},
+			wantCurrentAt: 7,
+		},
+		{
+			name:          "ignores unchanged bytes",
+			versions:      []string{withInterval("7"), withInterval("7"), withInterval("8"), withInterval("8")},
+			wantApplied:   []int{7, 8},
+			wantCurrentAt: 8,
+		},
+		{
+			name:          "ignores a reformatted config",
+			versions:      []string{baseConfig + "\n# comment\n"},
+			wantCurrentAt: 5,
+		},
+		{
+			name:          "keeps the last good config when apply fails",
+			versions:      []string{withInterval("7")},
+			applyErr:      errors.New("cannot reach the new Prometheus"),
+			wantCurrentAt: 5,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &applied{err: tt.applyErr}
+			r := &reloader{source: "test", last: []byte(baseConfig), current: parse(t, baseConfig), apply: a.apply}
+			for _, version := range tt.versions {
+				r.handle([]byte(version))
+			}
+
+			got := a.intervals()
+			if len(got) != len(tt.wantApplied) {
+				t.Fatalf("applied intervals %v, want %v", got, tt.wantApplied)
+			}
+			for i := range got {
+				if got[i] != tt.wantApplied[i] {
+					t.Fatalf("applied intervals %v, want %v", got, tt.wantApplied)
+				}
+			}
+			if r.current.Interval != tt.wantCurrentAt {
+				t.Errorf("current interval = %d, want %d", r.current.Interval, tt.wantCurrentAt)
+			}
+		})
+	}
+}
+
+func configMap(name, data string) *corev1.ConfigMap {
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "autoscaler"},
+		Data:       map[string]string{"config.yaml": data},
+	}
+}
+
+// eventually fails the test unless cond holds within a few seconds.
+func eventually(t *testing.T, desc string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", desc)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestWatchConfigMap(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	clientset := fake.NewSimpleClientset(configMap("autoscaler-config", baseConfig), configMap("other", withInterval("9")))
+	configMaps := clientset.CoreV1().ConfigMaps("autoscaler")
+
+	a := &applied{}
+	done := make(chan struct{})
+	go func() {
+		WatchConfigMap(ctx, clientset, "autoscaler", "autoscaler-config", "config.yaml", parse(t, baseConfig), a.apply)
+		close(done)
+	}()
+
+	update := func(cm *corev1.ConfigMap) {
+		t.Helper()
+		if _, err := configMaps.Update(ctx, cm, metav1.UpdateOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The informer must be watching before the updates, or they are only
+	// seen in the initial list
+	eventually(t, "the ConfigMap watch", func() bool {
+		for _, action := range clientset.Actions() {
+			if action.GetVerb() == "watch" {
+				return true
+			}
+		}
+		return false
+	})
+
+	update(configMap("autoscaler-config", withInterval("0")))
+	update(configMap("other", withInterval("8")))
+	update(&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "autoscaler-config", Namespace: "autoscaler"}})
+	update(configMap("autoscaler-config", withInterval("7")))
+	eventually(t, "the configuration with interval 7", func() bool { return len(a.intervals()) > 0 })
+	if got := a.intervals(); len(got) != 1 || got[0] != 7 {
+		t.Errorf("applied intervals %v, want [7]", got)
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("WatchConfigMap did not return after the context was cancelled")
+	}
+}
@@ -0,0 +1,69 @@
+package telemetry
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Registry holds the metrics served on /metrics: the autoscaler's own and
+// the Go runtime and process metrics.
+var Registry = prometheus.NewRegistry()
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// Results recorded by the counters.
+const (
+	ResultSuccess   = "success"
+	ResultFailure   = "failure"
+	ResultAttempted = "attempted"
+	ResultSucceeded = "succeeded"
+	ResultFailed    = "failed"
+)
+
+// durationBuckets cover fast API calls up to cycles of several minutes.
+var durationBuckets = []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300}
+
+// The autoscaler's own metrics. Every series is labeled with the cluster it
+// is about, which is empty when a single cluster is managed.
+var (
+	CycleDuration = promauto.With(Registry).NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "autoscaler_cycle_duration_seconds",
+		Help:    "Duration of a monitoring cycle.",
+		Buckets: durationBuckets,
+	}, []string{"cluster"})
+	CyclesTotal = promauto.With(Registry).NewCounterVec(prometheus.CounterOpts{
+		Name: "autoscaler_cycles_total",
+		Help: "Monitoring cycles by result: success or failure.",
+	}, []string{"cluster", "result"})
+	LastSuccessfulCycle = promauto.With(Registry).NewGaugeVec(prometheus.GaugeOpts{
+		Name: "autoscaler_last_successful_cycle_timestamp_seconds",
+		Help: "Unix time the last monitoring cycle completed successfully.",
+	}, []string{"cluster"})
+	WorkloadsDiscovered = promauto.With(Registry).NewGaugeVec(prometheus.GaugeOpts{
+		Name: "autoscaler_workloads_discovered",
+		Help: "Managed workloads found in the last monitoring cycle.",
+	}, []string{"cluster"})
+	PVCResizesTotal = promauto.With(Registry).NewCounterVec(prometheus.CounterOpts{
+		Name: "autoscaler_pvc_resizes_total",
+		Help: "PVC resizes by result: attempted, succeeded or failed. Attempts that neither succeeded nor failed were skipped by a preflight check.",
+	}, []string{"cluster", "namespace", "result"})
+	ScaleOperationsTotal = promauto.With(Registry).NewCounterVec(prometheus.CounterOpts{
+		Name: "autoscaler_scale_operations_total",
+		Help: "Deployment scale operations by result: success or failure.",
+	}, []string{"cluster", "namespace", "result"})
+	PrometheusQueryDuration = promauto.With(Registry).NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "autoscaler_prometheus_query_duration_seconds",
+		Help:    "Duration of Prometheus queries, including retries.",
+		Buckets: durationBuckets,
+	}, []string{"cluster"})
+	PrometheusQueryErrors = promauto.With(Registry).NewCounterVec(prometheus.CounterOpts{
+		Name: "autoscaler_prometheus_query_errors_total",
+		Help: "Prometheus queries that failed after all retries.",
+	}, []string{"cluster"})
+)
@@ -0,0 +1,87 @@
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"k8s-resource-autoscaler/pkg/log"
+)
+
+// ReadyFunc reports why the autoscaler is not ready, or nil when it is.
+type ReadyFunc func() error
+
+// Serve serves Handler on addr until ctx is cancelled.
+func Serve(ctx context.Context, addr string, ready ReadyFunc, allowLogLevelChange bool) error {
+	server := &http.Server{Addr: addr, Handler: Handler(ready, allowLogLevelChange), ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	log.Info("Serving metrics and health checks on %s", addr)
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		return fmt.Errorf("error serving metrics on %s: %v", addr, err)
+	}
+	return nil
+}
+
+// Handler serves /metrics, /healthz, /readyz and /loglevel. /healthz
+// succeeds while the process is serving; /readyz succeeds when ready returns
+// nil. GET /loglevel returns the log level; PUT /loglevel changes it only
+// when allowLogLevelChange is set, as the server is unauthenticated.
+func Handler(ready ReadyFunc, allowLogLevelChange bool) http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(Registry, promhttp.HandlerOpts{}))
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		if err := ready(); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	})
+	mux.HandleFunc("/loglevel", func(w http.ResponseWriter, r *http.Request) {
+		handleLogLevel(w, r, allowLogLevelChange)
+	})
+	return mux
+}
+
+// handleLogLevel returns the log level, or sets it from the body of a PUT
+// when allowChange is set.
+func handleLogLevel(w http.ResponseWriter, r *http.Request, allowChange bool) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut, http.MethodPost:
+		if !allowChange {
+			http.Error(w, "changing the log level is disabled, start the autoscaler with --allow-log-level-change", http.StatusForbidden)
+			return
+		}
+		body, err := io.ReadAll(io.LimitReader(r.Body, 64))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		level, err := log.ParseLevel(string(body))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if level != log.GetLevel() {
+			log.Info("Changing the log level from %s to %s.", log.GetLevel(), level)
+			log.SetLevel(level)
+		}
+	default:
+		w.Header().Set("Allow", "GET, PUT")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	fmt.Fprintln(w, log.GetLevel())
+}
@@ -0,0 +1,102 @@
+package telemetry
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"k8s-resource-autoscaler/pkg/log"
+)
+
+// request sends a request to server and returns the status and body.
+func request(t *testing.T, server *httptest.Server, method, path, body string) (int, string) {
+	t.Helper()
+	req, err := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := server.Client().Do(req)
+	if err != nil {
+		t.Fatalf("%s %s error = %v", method, path, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("error reading the response to %s %s: %v", method, path, err)
+	}
+	return resp.StatusCode, strings.TrimSpace(string(data))
+}
+
+func TestHealthz(t *testing.T) {
+	server := httptest.NewServer(Handler(func() error { return errors.New("not ready") }, false))
+	defer server.Close()
+
+	// Liveness does not depend on readiness
+	if status, body := request(t, server, http.MethodGet, "/healthz", ""); status != http.StatusOK || body != "ok" {
+		t.Errorf("GET /healthz = %d %q, want 200 \"ok\"", status, body)
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	tests := []struct {
+		name       string
+		ready      error
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "ready", wantStatus: http.StatusOK, wantBody: "ok"},
+		{name: "not ready", ready: errors.New("no successful cycle yet"), wantStatus: http.StatusServiceUnavailable, wantBody: "no successful cycle yet"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(Handler(func() error { return tt.ready }, false))
+			defer server.Close()
+
+			if status, body := request(t, server, http.MethodGet, "/readyz", ""); status != tt.wantStatus || body != tt.wantBody {
+				t.Errorf("GET /readyz = %d %q, want %d %q", status, body, tt.wantStatus, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestLogLevel(t *testing.T) {
+	saved := log.GetLevel()
+	defer log.SetLevel(saved)
+	log.SetLevel(log.LevelInfo)
+
+	tests := []struct {
+		name       string
+		allow      bool
+		method     string
+		body       string
+		wantStatus int
+		wantLevel  log.Level
+	}{
+		{name: "get", method: http.MethodGet, wantStatus: http.StatusOK, wantLevel: log.LevelInfo},
+		{name: "change forbidden", method: http.MethodPut, body: "debug", wantStatus: http.StatusForbidden, wantLevel: log.LevelInfo},
+		{name: "change allowed", allow: true, method: http.MethodPut, body: "debug\n", wantStatus: http.StatusOK, wantLevel: log.LevelDebug},
+		{name: "unknown level", allow: true, method: http.MethodPut, body: "verbose", wantStatus: http.StatusBadRequest, wantLevel: log.LevelInfo},
+		{name: "unsupported method", allow: true, method: http.MethodDelete, wantStatus: http.StatusMethodNotAllowed, wantLevel: log.LevelInfo},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			log.SetLevel(log.LevelInfo)
+			server := httptest.NewServer(Handler(func() error { return nil }, tt.allow))
+			defer server.Close()
+
+			status, body := request(t, server, tt.method, "/loglevel", tt.body)
+			if status != tt.wantStatus {
+				t.Errorf("%s /loglevel status = %d (%q), want %d", tt.method, status, body, tt.wantStatus)
+			}
+			if status == http.StatusOK && body != tt.wantLevel.String() {
+				t.Errorf("%s /loglevel body = %q, want %q", tt.method, body, tt.wantLevel.String())
+			}
+			if got := log.GetLevel(); got != tt.wantLevel {
+				t.Errorf("log level = %s, want %s", got, tt.wantLevel)
+			}
+		})
+	}
+}